@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/sorafujitani/wez-kv/internal/policy"
+)
+
+// runCheck implements "wkv check": it loads the keymap like the viewer
+// does and prints the ways it violates a policy file.
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("wkv check", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wkv check --policy FILE [flags]")
+		fs.PrintDefaults()
+	}
+	var sf sourceFlags
+	sf.register(fs)
+	policyFile := fs.String("policy", "", "check the keymap against the policy in `file`")
+	goos := fs.String("os", runtime.GOOS, "apply the policy entries for this operating `system`")
+	format := fs.String("format", "text", "print violations as `text` or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitFailure
+	}
+
+	if *policyFile == "" {
+		fmt.Fprintln(os.Stderr, "error: --policy is required")
+		return exitFailure
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "error: --format: want text or json, got %q\n", *format)
+		return exitFailure
+	}
+	if *goos == "macos" {
+		*goos = "darwin"
+	}
+	p, err := policy.Load(*policyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	result, src, err := loadKeymap(&sf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	findings := p.Check(result, *goos)
+	locate(findings, result, sf.configPath(src))
+	return report(findings, *format)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// sourceFlags are the flags that choose where the keymap comes from.
+// The viewer and the subcommands share them.
+type sourceFlags struct {
+	lua        bool
+	input      string
+	wezterm    string
+	configFile string
+	overrides  stringList
+	command    string
+	timeout    time.Duration
+	noCache    bool
+	builtin    bool
+	static     bool
+}
+
+func (f *sourceFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.lua, "lua", false, `read bindings from "wezterm show-keys --lua"`)
+	fs.StringVar(&f.input, "input", "", "read a show-keys dump or JSON snapshot from `path`, or - for stdin")
+	fs.StringVar(&f.wezterm, "wezterm", "", "run this wezterm `executable` instead of the one in PATH")
+	fs.StringVar(&f.configFile, "config-file", "", "pass --config-file `path` to wezterm (default $WEZTERM_CONFIG_FILE, unless --command is given)")
+	fs.Var(&f.overrides, "config", "pass a --config `name=value` override to wezterm; may be repeated")
+	fs.StringVar(&f.command, "command", "", "run wezterm through `cmd`, e.g. \"ssh devbox wezterm show-keys\"")
+	fs.DurationVar(&f.timeout, "timeout", 30*time.Second, "give up loading the keymap after `duration`; 0 disables")
+	fs.BoolVar(&f.noCache, "no-cache", false, "always run wezterm instead of starting from the parse cache")
+	fs.BoolVar(&f.builtin, "defaults", false, "show wezterm's built-in default keymap instead of your own")
+	fs.BoolVar(&f.static, "static", false, "derive the keymap from the Lua config without running wezterm")
+}
+
+// source picks where to load the keymap from, along with the wezterm
+// command the flags describe and a note to show about the keymap, if
+// any. The viewer is interactive: it reads a dump piped into stdin
+// without --input -, starts from the parse cache, and shows the bundled
+// defaults if wezterm is needed but not installed. The subcommands check
+// exactly the keymap they are told to, so they do none of that.
+func (f *sourceFlags) source(interactive bool) (source.Source, source.Exec, string, error) {
+	wez := source.Exec{Command: []string{"wezterm"}, ConfigFile: f.configFile, Overrides: f.overrides, Args: []string{"show-keys"}}
+	if wez.ConfigFile == "" && f.command == "" {
+		// $WEZTERM_CONFIG_FILE names a local file, which means nothing
+		// to a wezterm run elsewhere through --command.
+		wez.ConfigFile = os.Getenv("WEZTERM_CONFIG_FILE")
+	}
+	if f.lua {
+		wez.Args = append(wez.Args, "--lua")
+	}
+	switch {
+	case f.command != "":
+		cmd, err := source.SplitCommand(f.command)
+		if err != nil {
+			return nil, wez, "", fmt.Errorf("--command: %w", err)
+		}
+		wez.Command = cmd
+		wez.Remote = true
+	case f.wezterm != "":
+		wez.Command = []string{f.wezterm}
+	}
+
+	src := selectSource(f.input, wez, interactive && source.StdinIsPiped(), interactive && !f.noCache)
+	switch {
+	case f.builtin:
+		src = defaults.Builtin{}
+		return src, wez, "showing " + src.String(), nil
+	case f.static:
+		path := f.configFile
+		if path == "" {
+			path = source.DefaultConfigFile()
+		}
+		if path == "" {
+			return nil, wez, "", errors.New("--static: no wezterm config found; pass --config-file")
+		}
+		return luacfg.Static{Path: path}, wez, "", nil
+	case f.command == "" && isWezterm(src) && !wez.Installed():
+		if !interactive {
+			return nil, wez, "", errors.New("wezterm not found; pass --static to read the config without it, or --input")
+		}
+		src = defaults.Builtin{}
+		return src, wez, "wezterm not found, showing " + src.String(), nil
+	}
+	return src, wez, "", nil
+}
+
+// configPath returns the local Lua config the keymap of src is derived
+// from, or "" if it does not come from one. A config behind --command
+// lives on another machine or in a container.
+func (f *sourceFlags) configPath(src source.Source) string {
+	switch src := src.(type) {
+	case luacfg.Static:
+		return src.Path
+	case source.Exec, source.Cache:
+		if f.command != "" {
+			return ""
+		}
+		if f.configFile != "" {
+			return f.configFile
+		}
+		return source.DefaultConfigFile()
+	}
+	return ""
+}
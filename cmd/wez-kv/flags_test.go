@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestConfigFileEnv(t *testing.T) {
+	t.Setenv("WEZTERM_CONFIG_FILE", "/home/me/.wezterm.lua")
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "/home/me/.wezterm.lua"},
+		{[]string{"--config-file", "x.lua"}, "x.lua"},
+		{[]string{"--command", "ssh devbox wezterm"}, ""},
+		{[]string{"--command", "ssh devbox wezterm", "--config-file", "remote.lua"}, "remote.lua"},
+	}
+	for _, tt := range tests {
+		var sf sourceFlags
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		sf.register(fs)
+		if err := fs.Parse(append(tt.args, "--input", "keys.txt")); err != nil {
+			t.Fatal(err)
+		}
+		_, wez, _, err := sf.source(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wez.ConfigFile != tt.want {
+			t.Errorf("%q: config file %q, want %q", tt.args, wez.ConfigFile, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// Exit codes of the subcommands.
+const (
+	exitOK       = 0
+	exitFindings = 1 // the keymap has errors, or violates the policy
+	exitFailure  = 2 // bad usage, or the keymap could not be loaded
+)
+
+// runLint implements "wkv lint": it loads the keymap like the viewer
+// does, checks it with the lint rules and prints what they find.
+func runLint(args []string) int {
+	fs := flag.NewFlagSet("wkv lint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: wkv lint [flags]")
+		fs.PrintDefaults()
+	}
+	var sf sourceFlags
+	sf.register(fs)
+	format := fs.String("format", "text", "print findings as `text` or json")
+	var enable, disable, severities stringList
+	fs.Var(&enable, "enable", "run `rules` that are off by default, comma-separated; may be repeated")
+	fs.Var(&disable, "disable", "do not run `rules`, comma-separated; may be repeated")
+	fs.Var(&severities, "severity", "report a rule's findings as `rule=level`: info, warning or error; may be repeated")
+	list := fs.Bool("rules", false, "list the rules and exit")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitFailure
+	}
+
+	if *list {
+		printRules()
+		return exitOK
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "error: --format: want text or json, got %q\n", *format)
+		return exitFailure
+	}
+	cfg, err := lintConfig(enable, disable, severities)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	result, src, err := loadKeymap(&sf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+
+	findings := cfg.Run(result)
+	locate(findings, result, sf.configPath(src))
+	return report(findings, *format)
+}
+
+// loadKeymap loads the keymap a subcommand checks. Lines that could not
+// be parsed are printed as warnings, and a keymap without bindings is an
+// error: the input was empty or not a keymap at all, and checking it
+// would pass.
+func loadKeymap(sf *sourceFlags) (parser.ParseResult, source.Source, error) {
+	src, _, _, err := sf.source(false)
+	if err != nil {
+		return parser.ParseResult{}, nil, err
+	}
+	result, err := load(src, sf.timeout)
+	if err != nil {
+		return result, src, err
+	}
+	for _, d := range result.Diagnostics {
+		fmt.Fprintf(os.Stderr, "warning: %s: %s\n", src, d)
+	}
+	if len(result.Bindings) == 0 {
+		return result, src, fmt.Errorf("%s: no bindings found", src)
+	}
+	return result, src, nil
+}
+
+// report prints findings in format and returns the exit code for them.
+func report(findings []lint.Finding, format string) int {
+	var err error
+	if format == "json" {
+		err = lint.WriteJSON(os.Stdout, findings)
+	} else {
+		err = lint.WriteText(os.Stdout, findings)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitFailure
+	}
+	if lint.HasErrors(findings) {
+		return exitFindings
+	}
+	return exitOK
+}
+
+// lintConfig builds the rule selection from the --enable, --disable and
+// --severity flags.
+func lintConfig(enable, disable, severities stringList) (lint.Config, error) {
+	cfg := lint.Config{Enabled: make(map[string]bool), Severities: make(map[string]lint.Severity)}
+	for _, names := range enable {
+		for _, name := range strings.Split(names, ",") {
+			cfg.Enabled[strings.TrimSpace(name)] = true
+		}
+	}
+	for _, names := range disable {
+		for _, name := range strings.Split(names, ",") {
+			cfg.Enabled[strings.TrimSpace(name)] = false
+		}
+	}
+	for _, s := range severities {
+		name, level, ok := strings.Cut(s, "=")
+		if !ok {
+			return cfg, fmt.Errorf("--severity: want rule=level, got %q", s)
+		}
+		sev, err := lint.ParseSeverity(level)
+		if err != nil {
+			return cfg, fmt.Errorf("--severity: %w", err)
+		}
+		cfg.Severities[name] = sev
+	}
+	return cfg, cfg.Validate()
+}
+
+// locate fills in where the config defines the first binding of each
+// finding. It is best effort: a config that cannot be analyzed leaves
+// the findings without locations.
+func locate(findings []lint.Finding, result parser.ParseResult, path string) {
+	if path == "" {
+		return
+	}
+	cfg, err := luacfg.Analyze(context.Background(), path)
+	if err != nil {
+		return
+	}
+	for i, f := range findings {
+		if len(f.Bindings) == 0 {
+			continue
+		}
+		if loc, ok := cfg.Locations.Lookup(result.Bindings[f.Bindings[0]]); ok {
+			findings[i].File, findings[i].Line = loc.File, loc.Line
+		}
+	}
+}
+
+func printRules() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, r := range lint.Rules() {
+		state := "on"
+		if !r.Default {
+			state = "off"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, r.Severity, state, r.Description)
+	}
+	w.Flush()
+}
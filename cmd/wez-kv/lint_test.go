@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+const cleanKeymap = `Default key table
+-----------------
+
+	CTRL    Char('t')    ->   SpawnTab(CurrentPaneDomain)
+	CTRL    Char('w')    ->   CloseCurrentTab { confirm: true }
+`
+
+const conflictingKeymap = `Default key table
+-----------------
+
+	CTRL    Char('x')    ->   CloseCurrentPane { confirm: true }
+	CTRL    Char('x')    ->   CloseCurrentTab { confirm: true }
+`
+
+// run runs a subcommand with stdin reading from input, and returns its
+// exit code and what it printed to stdout.
+func run(t *testing.T, cmd func([]string) int, input string, args ...string) (int, string) {
+	t.Helper()
+	dir := t.TempDir()
+	in := filepath.Join(dir, "stdin")
+	if err := os.WriteFile(in, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = stdin, stdout
+	defer func() { os.Stdin, os.Stdout = oldStdin, oldStdout }()
+
+	code := cmd(args)
+	out, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(out)
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLintExitCodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{"clean", cleanKeymap, []string{"--input", "-"}, exitOK},
+		{"conflict", conflictingKeymap, []string{"--input", "-"}, exitFindings},
+		{"conflict demoted", conflictingKeymap, []string{"--input", "-", "--severity", "conflict=warning"}, exitOK},
+		{"file", "", []string{"--input", writeFile(t, "keys.txt", conflictingKeymap)}, exitFindings},
+		{"empty", "", []string{"--input", "-"}, exitFailure},
+		{"garbage", "not a keymap\n\x00\x01\n", []string{"--input", "-"}, exitFailure},
+		{"missing file", "", []string{"--input", filepath.Join(t.TempDir(), "missing.txt")}, exitFailure},
+		{"bad flag", cleanKeymap, []string{"--input", "-", "--format", "xml"}, exitFailure},
+		{"unknown rule", cleanKeymap, []string{"--input", "-", "--enable", "nope"}, exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := run(t, runLint, tt.stdin, tt.args...); got != tt.want {
+				t.Errorf("exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintOutput(t *testing.T) {
+	code, out := run(t, runLint, conflictingKeymap, "--input", "-", "--format", "json")
+	if code != exitFindings {
+		t.Errorf("exit code %d, want %d", code, exitFindings)
+	}
+	if !strings.Contains(out, `"rule": "conflict"`) {
+		t.Errorf("expected a conflict finding, got %s", out)
+	}
+}
+
+func TestCheckExitCodes(t *testing.T) {
+	forbidCtrlX := writeFile(t, "policy.json", `{"forbidden": [{"mods": "CTRL", "key": "x"}]}`)
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{"clean", cleanKeymap, []string{"--policy", forbidCtrlX, "--input", "-"}, exitOK},
+		{"violation", conflictingKeymap, []string{"--policy", forbidCtrlX, "--input", "-"}, exitFindings},
+		{"empty", "", []string{"--policy", forbidCtrlX, "--input", "-"}, exitFailure},
+		{"garbage", "not a keymap\n", []string{"--policy", forbidCtrlX, "--input", "-"}, exitFailure},
+		{"no policy", cleanKeymap, []string{"--input", "-"}, exitFailure},
+		{"bad policy", cleanKeymap, []string{"--policy", writeFile(t, "bad.json", `{"forbidden": [{}]}`), "--input", "-"}, exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := run(t, runCheck, tt.stdin, tt.args...); got != tt.want {
+				t.Errorf("exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectSource(t *testing.T) {
+	wez := source.Exec{Command: []string{"wezterm"}}
+	if _, ok := selectSource("-", wez, false, false).(source.Stdin); !ok {
+		t.Error("expected --input - to read stdin")
+	}
+	if _, ok := selectSource("", wez, true, true).(source.Stdin); !ok {
+		t.Error("expected piped stdin to be read")
+	}
+	if _, ok := selectSource("", wez, false, false).(source.Exec); !ok {
+		t.Error("expected wezterm to run when stdin is not to be read and the cache is off")
+	}
+	if _, ok := selectSource("keys.json", wez, true, true).(source.Snapshot); !ok {
+		t.Error("expected a .json input to be read as a snapshot")
+	}
+}
@@ -1,13 +1,78 @@
 // wez-kv is a fuzzy-searchable TUI viewer for wezterm keybindings.
 //
 // It runs "wezterm show-keys", parses the output, and displays it
-// in a color-coded, filterable table powered by Bubble Tea.
+// in a color-coded, filterable table powered by Bubble Tea. A saved dump
+// or JSON snapshot can be viewed instead, from a file or piped into stdin:
+//
+//	wezterm show-keys > keys.txt
+//	wkv --input keys.txt
+//	wezterm show-keys | wkv
 //
 // # Usage
 //
-//	wkv
+//	wkv [flags]
+//
+// Flags:
+//
+//	--diagnostics    Print show-keys lines that could not be parsed and exit
+//	--lua            Read bindings from "wezterm show-keys --lua" instead
+//	--input PATH     Read a show-keys dump or JSON snapshot from PATH, or - for stdin
+//	--export PATH    Write the loaded keymap as a JSON snapshot to PATH and exit
+//	--wezterm PATH   Run this wezterm executable instead of the one in PATH
+//	--config-file F  Pass --config-file F to wezterm (default: $WEZTERM_CONFIG_FILE,
+//	                 unless --command is given)
+//	--config N=V     Pass a --config N=V override to wezterm; may be repeated
+//	--command CMD    Run wezterm through CMD, e.g. "ssh devbox wezterm show-keys"
+//	--timeout D      Give up loading the keymap after D (default: 30s; 0 disables)
+//	--no-watch       Do not reload when the wezterm config or input file changes
+//	--no-cache       Always run wezterm instead of starting from the parse cache
+//	--defaults       Show wezterm's built-in default keymap instead of your own
+//	--static         Derive the keymap from the Lua config without running wezterm
+//	--policy FILE    Mark the bindings that violate the policy in FILE
+//
+// Unless --input is given or a dump is piped into stdin, wezterm is run
+// from your PATH. If it is not installed, the default keymap bundled with
+// wez-kv is shown instead.
+//
+// With --static, wez-kv reads the config named by --config-file, or the
+// one wezterm would load, and evaluates it itself. Values that depend on
+// the running terminal, such as wezterm.target_triple, are unknown; the
+// bindings they affect are reported by --diagnostics.
+//
+// # Lint
+//
+//	wkv lint [flags]
+//
+// checks the keymap for conflicts, key tables that cannot be left or are
+// never used, and other mistakes, and prints what it finds. It takes the
+// same flags as the viewer to choose the keymap, and:
+//
+//	--format F       Print findings as text or json (default: text)
+//	--enable RULES   Run rules that are off by default, comma-separated
+//	--disable RULES  Do not run these rules, comma-separated
+//	--severity R=L   Report rule R's findings as info, warning or error
+//	--rules          List the rules and exit
+//
+// Unlike the viewer, it reads stdin only with --input -, always runs
+// wezterm rather than trusting the parse cache, and fails if wezterm is
+// not installed. It exits with 1 if there is a finding of severity
+// error, and with 2 if the keymap could not be loaded or has no
+// bindings. Lines that could not be parsed are printed as warnings.
+//
+// # Policy
+//
+//	wkv check --policy FILE [flags]
 //
-// Requires wezterm to be installed and available in your PATH.
+// checks the keymap against a team's conventions in a JSON policy file:
+// bindings that must stay as they are, chords that must not be bound,
+// and the modifiers bindings must or must not use. It takes the same
+// flags as the viewer to choose the keymap, and:
+//
+//	--os NAME        Apply the policy entries for this OS (default: this one)
+//	--format F       Print violations as text or json (default: text)
+//
+// It loads the keymap and exits like wkv lint. The viewer marks violating bindings when given
+// the same file with --policy.
 //
 // # Keybindings
 //
@@ -21,6 +86,13 @@
 //	Escape         Exit search / clear filter
 //	Tab            Next section filter
 //	Shift+Tab      Previous section filter
+//	o              Cycle the origin filter: default, overridden, added, removed
+//	c              Show customized bindings only
+//	e              Open the selected binding's definition in $EDITOR
+//	x              Show conflicting and shadowed bindings only
+//	n / N          Jump to the next / previous conflicting or shadowed binding
+//	p              Show bindings that need an enhanced keyboard protocol only
+//	R              Reload the keymap
 //	q / Ctrl+c     Quit
 //
 // # Install
@@ -38,27 +110,176 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sorafujitani/wez-kv/internal/defaults"
 	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/policy"
+	"github.com/sorafujitani/wez-kv/internal/source"
 	"github.com/sorafujitani/wez-kv/internal/tui"
 )
 
+// watchInterval is how often the config and input files are checked
+// for changes.
+const watchInterval = time.Second
+
 func main() {
-	output, err := exec.Command("wezterm", "show-keys").Output()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		}
+	}
+
+	var sf sourceFlags
+	sf.register(flag.CommandLine)
+	diagnostics := flag.Bool("diagnostics", false, "print show-keys lines that could not be parsed and exit")
+	export := flag.String("export", "", "write the loaded keymap as a JSON snapshot to `path` and exit")
+	noWatch := flag.Bool("no-watch", false, "do not reload when the wezterm config or input file changes")
+	policyFile := flag.String("policy", "", "mark the bindings that violate the policy in `file`")
+	flag.Parse()
+
+	src, wez, banner, err := sf.source(true)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: failed to run 'wezterm show-keys': %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(2)
+	}
+	if banner != "" && !sf.builtin {
+		fmt.Fprintf(os.Stderr, "%s\n", banner)
 	}
 
-	result := parser.Parse(string(output))
+	if *diagnostics || *export != "" {
+		result, err := load(src, sf.timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if *diagnostics {
+			for _, d := range result.Diagnostics {
+				fmt.Println(d)
+			}
+			fmt.Fprintf(os.Stderr, "%d bindings parsed, %d lines skipped\n", len(result.Bindings), len(result.Diagnostics))
+			return
+		}
+		if err := writeSnapshot(*export, result); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	p := tea.NewProgram(tui.New(result), tea.WithAltScreen())
+	opts := []tea.ProgramOption{tea.WithAltScreen()}
+	var modelOpts []tui.Option
+	switch {
+	case banner != "":
+		modelOpts = append(modelOpts, tui.WithBanner(banner))
+	case sf.static:
+		// The static keymap is layered over the bundled defaults, so
+		// classify against the same ones.
+		modelOpts = append(modelOpts, tui.WithDefaults(defaults.Builtin{}))
+	default:
+		modelOpts = append(modelOpts, tui.WithDefaults(defaults.Wezterm{Exec: wez}))
+	}
+	if _, ok := src.(source.Stdin); ok {
+		// stdin carries the dump, so read keys from the terminal instead.
+		opts = append(opts, tea.WithInputTTY())
+		modelOpts = append(modelOpts, tui.WithoutReload())
+	}
+	// A config behind --command lives on another machine or in a
+	// container, so there is nothing local to watch.
+	if w, ok := src.(source.Watchable); ok && !*noWatch && sf.command == "" {
+		modelOpts = append(modelOpts, tui.WithWatch(w.Files, watchInterval))
+	}
+	if path := sf.configPath(src); path != "" {
+		modelOpts = append(modelOpts, tui.WithConfig(path))
+	}
+	if *policyFile != "" {
+		p, err := policy.Load(*policyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		modelOpts = append(modelOpts, tui.WithPolicy(p, runtime.GOOS))
+	}
+	p := tea.NewProgram(tui.NewLoader(src, sf.timeout, modelOpts...), opts...)
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// load loads the keymap from src, giving up after timeout unless it is zero.
+func load(src source.Source, timeout time.Duration) (parser.ParseResult, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return src.Load(ctx)
+}
+
+// selectSource picks where to load the keymap from: an explicit input
+// file or stdin, a dump piped into stdin if piped is set, or wezterm
+// itself, through the parse cache if cache is set.
+func selectSource(input string, wez source.Exec, piped, cache bool) source.Source {
+	switch {
+	case input == "-":
+		return source.Stdin{}
+	case input != "" && filepath.Ext(input) == ".json":
+		return source.Snapshot{Path: input}
+	case input != "":
+		return source.File{Path: input}
+	case piped:
+		return source.Stdin{}
+	}
+	if cache {
+		if dir, err := source.CacheDir(); err == nil {
+			return source.Cache{Exec: wez, Dir: dir}
+		}
+	}
+	return wez
+}
+
+// isWezterm reports whether src runs wezterm.
+func isWezterm(src source.Source) bool {
+	switch src.(type) {
+	case source.Exec, source.Cache:
+		return true
+	}
+	return false
+}
+
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func writeSnapshot(path string, result parser.ParseResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := source.WriteSnapshot(f, result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,208 @@
+package analysis
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+func binding(table, mods, key, action string) parser.Keybinding {
+	m, err := parser.ParseModifiers(mods)
+	if err != nil {
+		panic(err)
+	}
+	b := parser.NewKeybinding(table, m, parser.ParseKey(key), action)
+	b.RawModifiers = mods
+	return b
+}
+
+func TestConflicts(t *testing.T) {
+	bindings := []parser.Keybinding{
+		binding("Default", "CTRL|SHIFT", "c", "CopyTo(Clipboard)"),              // 0
+		binding("Default", "CTRL", "t", "SpawnTab(CurrentPaneDomain)"),          // 1
+		binding("Default", "SHIFT|CTRL", "c", "CopyTo(Clipboard)"),              // 2
+		binding("Default", "LEADER", "x", "CloseCurrentPane { confirm: true }"), // 3
+		binding("Default", "LEADER", "x", "CloseCurrentTab { confirm: true }"),  // 4
+		binding("copy_mode", "CTRL", "t", "CopyMode(Close)"),                    // 5
+		binding("Default", "CTRL", "t", "SpawnTab(CurrentPaneDomain)"),          // 6
+		binding("Default", "LEADER", "x", "CloseCurrentPane { confirm: true }"), // 7
+		binding("Default", "CMD", "k", "ClearScrollback(ScrollbackOnly)"),       // 8
+		binding("Default", "SUPER", "k", "ClearScrollback(ScrollbackOnly)"),     // 9
+		binding("Default", "CTRL | SHIFT", "v", "PasteFrom(Clipboard)"),         // 10
+		binding("Default", "CTRL|SHIFT", "v", "PasteFrom(Clipboard)"),           // 11
+	}
+
+	type want struct {
+		kind     Kind
+		chord    string
+		bindings []int
+	}
+	wants := []want{
+		{KindEquivalent, "SHIFT+CTRL+c", []int{0, 2}},
+		{KindDuplicate, "CTRL+t", []int{1, 6}},
+		{KindConflict, "LEADER+x", []int{3, 4, 7}},
+		{KindEquivalent, "SUPER+k", []int{8, 9}},
+		// Spacing is not a different spelling.
+		{KindDuplicate, "SHIFT+CTRL+v", []int{10, 11}},
+	}
+
+	findings := Conflicts(bindings)
+	if len(findings) != len(wants) {
+		t.Fatalf("expected %d findings, got %v", len(wants), findings)
+	}
+	for i, f := range findings {
+		w := wants[i]
+		if f.Kind != w.kind || f.Chord.String() != w.chord || !slices.Equal(f.Bindings, w.bindings) {
+			t.Errorf("finding %d: got %s %s %v, want %s %s %v", i, f.Kind, f.Chord, f.Bindings, w.kind, w.chord, w.bindings)
+		}
+	}
+	if w := findings[2].Winner(); w != 7 {
+		t.Errorf("expected the last binding to win, got %d", w)
+	}
+	if s := findings[2].String(); s != "conflict: LEADER+x is bound to 3 different actions in Default" {
+		t.Errorf("unexpected description %q", s)
+	}
+
+	by := ByBinding(findings)
+	if i, ok := by[4]; !ok || i != 2 {
+		t.Errorf("expected binding 4 in finding 2, got %d, %v", i, ok)
+	}
+	if _, ok := by[5]; ok {
+		t.Error("expected the copy_mode binding to be unaffected")
+	}
+}
+
+func TestConflictsCanonical(t *testing.T) {
+	// Bindings read from wezterm's output have no spelling of their own.
+	a := parser.NewKeybinding("Default", parser.ModCtrl|parser.ModShift, parser.ParseKey("c"), "Nop")
+	b := a
+	b.RawModifiers = "SHIFT|CTRL"
+	findings := Conflicts([]parser.Keybinding{a, b})
+	if len(findings) != 1 || findings[0].Kind != KindDuplicate {
+		t.Errorf("expected a duplicate, got %v", findings)
+	}
+	if findings := Conflicts(nil); findings != nil {
+		t.Errorf("expected no findings, got %v", findings)
+	}
+}
+
+func TestEquivalents(t *testing.T) {
+	bindings := []parser.Keybinding{
+		binding("Default", "SHIFT", "a", "Nop"),                            // 0
+		binding("Default", "", "A", "ActivateCopyMode"),                    // 1
+		binding("Default", "CTRL", "mapped:b", "Nop"),                      // 2
+		binding("Default", "CTRL", "phys:B", "QuickSelect"),                // 3
+		binding("Default", "CTRL", "b", "ShowLauncher"),                    // 4
+		binding("Default", "CTRL", "c", "CopyTo(Clipboard)"),               // 5
+		binding("Default", "CTRL", "c", "Nop"),                             // 6
+		binding("Default", "CTRL|SHIFT", "phys:C", "PasteFrom(Clipboard)"), // 7
+		binding("Default", "CTRL", "C", "CopyTo(Clipboard)"),               // 8
+		binding("copy_mode", "", "a", "Nop"),                               // 9
+		binding("copy_mode", "", "phys:Tab", "Nop"),                        // 10
+		binding("copy_mode", "", "Tab", "CopyMode(Close)"),                 // 11
+		binding("copy_mode", "", "raw:38", "Nop"),                          // 12
+	}
+	for i := range bindings {
+		bindings[i].Key = parser.LuaKey(bindings[i].Key.Raw)
+	}
+
+	type want struct {
+		bindings []int
+		winner   int
+		physical bool
+	}
+	wants := []want{
+		{[]int{0, 1}, 1, false},
+		{[]int{2, 3, 4}, 3, true},
+		{[]int{7, 8}, 7, true},
+		{[]int{10, 11}, 10, true},
+	}
+	shadows := Equivalents(bindings)
+	if len(shadows) != len(wants) {
+		t.Fatalf("expected %d shadows, got %v", len(wants), shadows)
+	}
+	for i, s := range shadows {
+		w := wants[i]
+		if !slices.Equal(s.Bindings, w.bindings) || s.Winner != w.winner || s.Physical != w.physical {
+			t.Errorf("shadow %d: got %v won by %d (physical %v), want %v won by %d (physical %v)",
+				i, s.Bindings, s.Winner, s.Physical, w.bindings, w.winner, w.physical)
+		}
+	}
+	if got := shadows[1].Shadowed(); !slices.Equal(got, []int{2, 4}) {
+		t.Errorf("expected 2 and 4 to be shadowed, got %v", got)
+	}
+	if s := shadows[1].String(); s != "CTRL+phys:B shadows CTRL+mapped:b, CTRL+b in Default: physical keys are matched first" {
+		t.Errorf("unexpected description %q", s)
+	}
+	if s := shadows[0].String(); s != "A shadows SHIFT+a in Default: it comes last" {
+		t.Errorf("unexpected description %q", s)
+	}
+
+	same := [][2]int{{0, 1}, {2, 3}, {7, 8}, {10, 11}, {12, 12}}
+	for _, p := range same {
+		if !SameKeystroke(bindings[p[0]].Chord(), bindings[p[1]].Chord()) {
+			t.Errorf("expected %s and %s to be the same keystroke", bindings[p[0]].Chord(), bindings[p[1]].Chord())
+		}
+	}
+	k1 := parser.Chord{Mods: parser.ModAlt, Key: parser.ParseKey("Phys(K1)")}
+	for _, key := range []string{"1", "mapped:1"} {
+		if c := (parser.Chord{Mods: parser.ModAlt, Key: parser.LuaKey(key)}); !SameKeystroke(k1, c) {
+			t.Errorf("expected %s and %s to be the same keystroke", k1, c)
+		}
+	}
+	if SameKeystroke(k1, parser.Chord{Mods: parser.ModAlt, Key: parser.LuaKey("2")}) {
+		t.Error("expected phys:K1 and 2 to differ")
+	}
+	if SameKeystroke(bindings[5].Chord(), bindings[8].Chord()) || SameKeystroke(bindings[9].Chord(), bindings[12].Chord()) {
+		t.Error("expected different keystrokes")
+	}
+}
+
+func TestAmbiguous(t *testing.T) {
+	tests := []struct {
+		mods, key string
+		like      string // "" if unambiguous
+	}{
+		{"CTRL", "i", "Tab"},
+		{"CTRL", "phys:I", "Tab"},
+		{"CTRL", "[", "Escape"},
+		{"CTRL", "m", "Enter"},
+		{"CTRL|ALT", "i", "Tab"},
+		{"LEADER|CTRL", "i", "Tab"},
+		{"CTRL|SHIFT", "c", "CTRL+c"},
+		{"CTRL", "C", "CTRL+c"},
+		{"CTRL", "mapped:V", "CTRL+v"},
+		{"SHIFT", "Enter", "Enter"},
+		{"CTRL", "Tab", "Tab"},
+		{"CTRL|SHIFT", "Tab", "Tab"},
+		{"SHIFT", "Tab", ""},
+		{"CTRL", "h", "CTRL+Backspace"},
+		{"CTRL", "@", "CTRL+Space"},
+		{"CTRL", "1", ""},
+		{"CTRL", "2", ""},
+		{"CTRL", "3", ""},
+		{"CTRL", "8", ""},
+		{"CTRL", "j", ""},
+		{"CTRL", "c", ""},
+		{"CTRL", "phys:C", ""},
+		{"ALT", "i", ""},
+		{"SHIFT", "a", ""},
+		{"", "Enter", ""},
+		{"LEADER", "i", ""},
+		{"CTRL", "raw:23", ""},
+	}
+	for _, tt := range tests {
+		mods, _ := parser.ParseModifiers(tt.mods)
+		c := parser.Chord{Mods: mods, Key: parser.LuaKey(tt.key)}
+		a, ok := Ambiguous(c)
+		if ok != (tt.like != "") || a.Like != tt.like {
+			t.Errorf("%s %s: got %q, %v, want %q", tt.mods, tt.key, a.Like, ok, tt.like)
+		}
+	}
+
+	a, _ := Ambiguous(parser.Chord{Mods: parser.ModCtrl, Key: parser.LuaKey("i")})
+	if s := a.String(); s != "CTRL+i is sent as Tab unless an enhanced keyboard protocol (kitty or CSI-u) is enabled" {
+		t.Errorf("unexpected description %q", s)
+	}
+}
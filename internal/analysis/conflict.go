@@ -0,0 +1,135 @@
+// Package analysis finds problems in a keymap that wezterm accepts
+// without complaint, such as a chord bound twice in the same table.
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Kind classifies a Finding.
+type Kind int
+
+const (
+	// KindDuplicate is a chord bound more than once to the same action.
+	KindDuplicate Kind = iota
+	// KindConflict is a chord bound to different actions.
+	KindConflict
+	// KindEquivalent is a chord bound more than once to the same action
+	// with its modifiers written differently, e.g. "CTRL|SHIFT" and
+	// "SHIFT|CTRL", which are easy to miss when reading the config.
+	KindEquivalent
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindDuplicate:
+		return "duplicate"
+	case KindConflict:
+		return "conflict"
+	case KindEquivalent:
+		return "equivalent"
+	default:
+		return "unknown"
+	}
+}
+
+// Finding is a chord bound more than once in a table.
+type Finding struct {
+	Kind  Kind
+	Table string
+	Chord parser.Chord
+	// Bindings holds the indices of the bindings involved, in keymap
+	// order.
+	Bindings []int
+}
+
+// Winner returns the index of the binding wezterm uses. Later entries
+// replace earlier ones for the same chord, so it is the last one.
+func (f Finding) Winner() int {
+	return f.Bindings[len(f.Bindings)-1]
+}
+
+func (f Finding) String() string {
+	n := len(f.Bindings)
+	switch f.Kind {
+	case KindConflict:
+		return fmt.Sprintf("%s: %s is bound to %d different actions in %s", f.Kind, f.Chord, n, f.Table)
+	case KindEquivalent:
+		return fmt.Sprintf("%s: %s is bound %d times in %s, with modifiers written differently", f.Kind, f.Chord, n, f.Table)
+	default:
+		return fmt.Sprintf("%s: %s is bound %d times in %s to the same action", f.Kind, f.Chord, n, f.Table)
+	}
+}
+
+// Conflicts finds the chords that are bound more than once in the same
+// table, in the order of their first binding. Bindings are compared by
+// their parsed modifiers, so the order and aliases the config uses to
+// spell them do not matter.
+func Conflicts(bindings []parser.Keybinding) []Finding {
+	var findings []Finding
+	byChord := make(map[string]int) // index into findings
+	for i, b := range bindings {
+		id := b.Table + "\x00" + b.Chord().String()
+		j, ok := byChord[id]
+		if !ok {
+			byChord[id] = len(findings)
+			findings = append(findings, Finding{Table: b.Table, Chord: b.Chord(), Bindings: []int{i}})
+			continue
+		}
+		findings[j].Bindings = append(findings[j].Bindings, i)
+	}
+
+	findings = slices.DeleteFunc(findings, func(f Finding) bool {
+		return len(f.Bindings) < 2
+	})
+	for i, f := range findings {
+		findings[i].Kind = kindOf(bindings, f.Bindings)
+	}
+	return findings
+}
+
+func kindOf(bindings []parser.Keybinding, indices []int) Kind {
+	first := bindings[indices[0]]
+	kind := KindDuplicate
+	for _, i := range indices[1:] {
+		b := bindings[i]
+		if b.Action != first.Action {
+			return KindConflict
+		}
+		if spelling(b) != spelling(first) {
+			kind = KindEquivalent
+		}
+	}
+	return kind
+}
+
+// spelling returns the modifiers of b as written, with spacing and NONE
+// removed.
+func spelling(b parser.Keybinding) string {
+	if b.RawModifiers == "" {
+		return strings.Join(b.Modifiers.Names(), "|")
+	}
+	var toks []string
+	for _, tok := range strings.Split(b.RawModifiers, "|") {
+		if tok = strings.TrimSpace(tok); tok != "" && tok != "NONE" {
+			toks = append(toks, tok)
+		}
+	}
+	return strings.Join(toks, "|")
+}
+
+// ByBinding maps the index of every binding involved in a finding to the
+// index of that finding.
+func ByBinding(findings []Finding) map[int]int {
+	m := make(map[int]int)
+	for i, f := range findings {
+		for _, b := range f.Bindings {
+			m[b] = i
+		}
+	}
+	return m
+}
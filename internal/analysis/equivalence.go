@@ -0,0 +1,199 @@
+package analysis
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Shadow is a set of bindings in a table whose chords look different
+// but match the same keystroke, so only one of them ever fires.
+type Shadow struct {
+	Table string
+	// Bindings holds the indices of the bindings involved, in keymap
+	// order, and Chords their chords.
+	Bindings []int
+	Chords   []parser.Chord
+	// Winner is the index of the binding wezterm uses.
+	Winner int
+	// Physical is set when the winner takes precedence because it names
+	// a physical key, rather than by coming last.
+	Physical bool
+}
+
+// Shadowed returns the indices of the bindings that never fire.
+func (s Shadow) Shadowed() []int {
+	var shadowed []int
+	for _, i := range s.Bindings {
+		if i != s.Winner {
+			shadowed = append(shadowed, i)
+		}
+	}
+	return shadowed
+}
+
+// Chord returns the chord of binding i, which must be involved.
+func (s Shadow) Chord(i int) parser.Chord {
+	for j, b := range s.Bindings {
+		if b == i {
+			return s.Chords[j]
+		}
+	}
+	return parser.Chord{}
+}
+
+func (s Shadow) String() string {
+	var others []string
+	for _, i := range s.Shadowed() {
+		if c := s.Chord(i).String(); c != s.Chord(s.Winner).String() && !slices.Contains(others, c) {
+			others = append(others, c)
+		}
+	}
+	reason := "it comes last"
+	if s.Physical {
+		reason = "physical keys are matched first"
+	}
+	return fmt.Sprintf("%s shadows %s in %s: %s", s.Chord(s.Winner), strings.Join(others, ", "), s.Table, reason)
+}
+
+// Equivalents finds bindings in the same table that match the same
+// keystroke although their chords differ, following the rules wezterm
+// applies when it looks up a key press:
+//
+//   - SHIFT with a letter is the same as the upper case letter alone, so
+//     SHIFT+a, SHIFT+A and A are one chord.
+//   - Char and Mapped keys are both resolved through the keyboard
+//     layout and are the same key.
+//   - A physical key is matched before a mapped one, so phys:A wins over
+//     a, phys:A with SHIFT over A, and phys:K1 over 1. Layouts are assumed
+//     to put letters and digits where a US layout does.
+//
+// Within the same kind of key the last binding wins. Raw key codes and
+// mouse events are not compared. Chords bound more than once exactly as
+// written are left to Conflicts, unless another spelling is involved.
+func Equivalents(bindings []parser.Keybinding) []Shadow {
+	var shadows []Shadow
+	byStroke := make(map[string]int) // index into shadows
+	for i, b := range bindings {
+		stroke, ok := keystroke(b.Chord())
+		if !ok {
+			continue
+		}
+		id := b.Table + "\x00" + stroke
+		j, ok := byStroke[id]
+		if !ok {
+			byStroke[id] = len(shadows)
+			shadows = append(shadows, Shadow{Table: b.Table})
+			j = len(shadows) - 1
+		}
+		shadows[j].Bindings = append(shadows[j].Bindings, i)
+		shadows[j].Chords = append(shadows[j].Chords, b.Chord())
+	}
+
+	var found []Shadow
+	for _, s := range shadows {
+		if !distinct(s.Chords) {
+			continue
+		}
+		s.Winner = s.Bindings[0]
+		winner := s.Chords[0]
+		for j, c := range s.Chords {
+			if physical(c) || !physical(winner) {
+				s.Winner, winner = s.Bindings[j], c
+			}
+		}
+		for _, c := range s.Chords {
+			if physical(winner) && !physical(c) {
+				s.Physical = true
+			}
+		}
+		found = append(found, s)
+	}
+	return found
+}
+
+// distinct reports whether the chords are not all written the same.
+func distinct(chords []parser.Chord) bool {
+	for _, c := range chords[1:] {
+		if c.String() != chords[0].String() {
+			return true
+		}
+	}
+	return false
+}
+
+func physical(c parser.Chord) bool {
+	return c.Key.Kind == parser.KeyPhys
+}
+
+// keystroke identifies the key press that c matches.
+func keystroke(c parser.Chord) (string, bool) {
+	mods, name := c.Mods, c.Key.Name
+	switch c.Key.Kind {
+	case parser.KeyPhys:
+		name = upperLetter(name)
+	case parser.KeyChar, parser.KeyMapped:
+		if isDigit(name) {
+			// wezterm names the physical digit keys K0 to K9.
+			name = "K" + name
+			break
+		}
+		if !isLetter(name) {
+			break
+		}
+		if mods.Has(parser.ModShift) {
+			// wezterm folds SHIFT into the letter.
+			name = strings.ToUpper(name)
+			mods &^= parser.ModShift
+		}
+		if name == strings.ToUpper(name) {
+			mods |= parser.ModShift
+		}
+		name = strings.ToUpper(name)
+	case parser.KeyNamed:
+	default:
+		return "", false
+	}
+	return parser.Chord{Mods: mods, Key: parser.Key{Kind: parser.KeyPhys, Name: name}}.String(), true
+}
+
+// SameKeystroke reports whether a and b match the same key press by the
+// rules Equivalents follows. Chords it does not compare, such as raw key
+// codes, are the same only if they are written the same.
+func SameKeystroke(a, b parser.Chord) bool {
+	sa, okA := keystroke(a)
+	sb, okB := keystroke(b)
+	if !okA || !okB {
+		return a.String() == b.String()
+	}
+	return sa == sb
+}
+
+func isLetter(s string) bool {
+	return len(s) == 1 && ('a' <= s[0] && s[0] <= 'z' || 'A' <= s[0] && s[0] <= 'Z')
+}
+
+func isDigit(s string) bool {
+	return len(s) == 1 && '0' <= s[0] && s[0] <= '9'
+}
+
+func upperLetter(s string) string {
+	if isLetter(s) {
+		return strings.ToUpper(s)
+	}
+	return s
+}
+
+// ShadowsByBinding maps the index of every binding involved in a shadow
+// to the index of that shadow.
+func ShadowsByBinding(shadows []Shadow) map[int]int {
+	m := make(map[int]int)
+	for i, s := range shadows {
+		for _, b := range s.Bindings {
+			m[b] = i
+		}
+	}
+	return m
+}
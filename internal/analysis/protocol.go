@@ -0,0 +1,80 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Ambiguity is a chord that the legacy keyboard encoding sends the same
+// way as another key press, so that a program reading it cannot tell
+// the two apart. An enhanced keyboard protocol, such as the kitty
+// keyboard protocol or CSI-u, encodes them differently.
+type Ambiguity struct {
+	Chord parser.Chord
+	// Like is the key press the chord is indistinguishable from.
+	Like string
+}
+
+func (a Ambiguity) String() string {
+	return fmt.Sprintf("%s is sent as %s unless an enhanced keyboard protocol (kitty or CSI-u) is enabled", a.Chord, a.Like)
+}
+
+// sameAsCtrl maps keys to the key press they cannot be told apart from
+// when combined with CTRL, because the legacy encoding sends both as the
+// same C0 control code: HT, CR, ESC, BS and NUL.
+var sameAsCtrl = map[string]string{
+	"i": "Tab",
+	"m": "Enter",
+	"[": "Escape",
+	"h": "CTRL+Backspace",
+	"@": "CTRL+Space",
+}
+
+// modifiedKeys are named keys whose legacy encoding drops CTRL and
+// SHIFT.
+var modifiedKeys = map[string]bool{
+	"Tab":       true,
+	"Enter":     true,
+	"Backspace": true,
+	"Escape":    true,
+}
+
+// Ambiguous reports whether c needs an enhanced keyboard protocol to be
+// told apart from another key press: CTRL with a letter or symbol that
+// shares its control code with a named key, as CTRL+i does with Tab;
+// CTRL+SHIFT with a letter, which is sent as CTRL with the letter; and
+// Tab, Enter, Backspace or Escape with CTRL or SHIFT, which are sent
+// unmodified. LEADER is ignored, since the leader is pressed on its own.
+func Ambiguous(c parser.Chord) (Ambiguity, bool) {
+	var name string
+	switch c.Key.Kind {
+	case parser.KeyChar, parser.KeyMapped, parser.KeyPhys, parser.KeyNamed:
+		name = c.Key.Name
+	default:
+		return Ambiguity{}, false
+	}
+	mods := c.Mods &^ parser.ModLeader
+	ctrl := mods&(parser.ModCtrl|parser.ModLeftCtrl|parser.ModRightCtrl) != 0
+	shift := mods&(parser.ModShift|parser.ModLeftShift|parser.ModRightShift) != 0
+
+	if isLetter(name) {
+		// Upper case letters are typed with SHIFT.
+		shift = shift || name == strings.ToUpper(name) && c.Key.Kind != parser.KeyPhys
+		name = strings.ToLower(name)
+	}
+	switch {
+	case modifiedKeys[name] && (ctrl || shift) && !(name == "Tab" && shift && !ctrl):
+		// SHIFT+Tab alone has a legacy encoding of its own.
+		return Ambiguity{Chord: c, Like: name}, true
+	case !ctrl:
+		return Ambiguity{}, false
+	case isLetter(name) && shift:
+		return Ambiguity{Chord: c, Like: "CTRL+" + name}, true
+	}
+	if like, ok := sameAsCtrl[name]; ok {
+		return Ambiguity{Chord: c, Like: like}, true
+	}
+	return Ambiguity{}, false
+}
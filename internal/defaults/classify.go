@@ -0,0 +1,130 @@
+package defaults
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// Origin tells how a binding relates to wezterm's default keymap.
+type Origin int
+
+const (
+	// OriginDefault is a binding exactly as wezterm ships it.
+	OriginDefault Origin = iota
+	// OriginOverridden is a default chord bound to a different action.
+	OriginOverridden
+	// OriginAdded is a chord wezterm does not bind by default.
+	OriginAdded
+	// OriginRemoved is a default binding the config takes away, either by
+	// leaving it out, as disable_default_key_bindings does, or through
+	// DisableDefaultAssignment.
+	OriginRemoved
+)
+
+func (o Origin) String() string {
+	switch o {
+	case OriginDefault:
+		return "default"
+	case OriginOverridden:
+		return "overridden"
+	case OriginAdded:
+		return "added"
+	case OriginRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Customized reports whether the binding differs from the defaults.
+func (o Origin) Customized() bool {
+	return o != OriginDefault
+}
+
+// Classification describes how a keymap differs from the defaults.
+type Classification struct {
+	// Origins holds the origin of each binding of the keymap, in order.
+	Origins []Origin
+	// Removed lists the default bindings whose chord the keymap does not
+	// bind at all.
+	Removed []parser.Keybinding
+}
+
+// Classify compares the bindings of a keymap with the default bindings.
+// Bindings are matched by table and chord, and actions are compared in
+// normalized form, so a keymap read from a Lua config matches the
+// show-keys defaults.
+func Classify(keymap, defaults []parser.Keybinding) Classification {
+	defaultActions := make(map[string][]string)
+	for _, b := range defaults {
+		id := chordID(b)
+		defaultActions[id] = append(defaultActions[id], actionID(b))
+	}
+
+	c := Classification{Origins: make([]Origin, len(keymap))}
+	bound := make(map[string]bool)
+	for i, b := range keymap {
+		id := chordID(b)
+		bound[id] = true
+		actions, ok := defaultActions[id]
+		switch {
+		case !ok:
+			c.Origins[i] = OriginAdded
+		case b.ActionName() == "DisableDefaultAssignment":
+			c.Origins[i] = OriginRemoved
+		case slices.Contains(actions, actionID(b)):
+			c.Origins[i] = OriginDefault
+		default:
+			c.Origins[i] = OriginOverridden
+		}
+	}
+	for _, b := range defaults {
+		if !bound[chordID(b)] {
+			c.Removed = append(c.Removed, b)
+		}
+	}
+	return c
+}
+
+func chordID(b parser.Keybinding) string {
+	return b.Table + "\x00" + b.Chord().String()
+}
+
+func actionID(b parser.Keybinding) string {
+	if id := b.ActionTree.Normalize().String(); id != "" {
+		return id
+	}
+	return b.Action
+}
+
+// Wezterm loads the default keymap by running wezterm without its config
+// ("wezterm -n show-keys"). If that fails, for example because wezterm
+// is not installed, it falls back to the bundled keymap for the
+// installed version, or the newest one.
+type Wezterm struct {
+	// Exec runs wezterm; its config options are ignored.
+	Exec source.Exec
+}
+
+func (w Wezterm) String() string {
+	return w.exec().String()
+}
+
+func (w Wezterm) exec() source.Exec {
+	return source.Exec{Command: w.Exec.Command, SkipConfig: true, Args: []string{"show-keys"}}
+}
+
+func (w Wezterm) Load(ctx context.Context) (parser.ParseResult, error) {
+	e := w.exec()
+	result, err := e.Load(ctx)
+	if err == nil {
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		return parser.ParseResult{}, ctx.Err()
+	}
+	return Keymap(e.Version(ctx))
+}
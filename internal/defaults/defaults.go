@@ -0,0 +1,87 @@
+// Package defaults bundles wezterm's default keymap, as printed by
+// "wezterm -n show-keys", for the releases wez-kv supports. It lets the
+// defaults be browsed without wezterm installed.
+//
+// Every file in keymaps is the unedited output of a wezterm release,
+// named after its version. To add one, install that release and run
+//
+//	wezterm -n show-keys > keymaps/$(wezterm --version | cut -d' ' -f2).txt
+//
+// Nothing is bundled for releases that were not captured this way; they
+// resolve to the nearest capture, see Resolve.
+package defaults
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+//go:embed keymaps/*.txt
+var keymaps embed.FS
+
+// Versions returns the wezterm versions with a bundled keymap, oldest
+// first.
+func Versions() []string {
+	entries, _ := keymaps.ReadDir("keymaps")
+	versions := make([]string, 0, len(entries))
+	for _, e := range entries {
+		versions = append(versions, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// Resolve returns the bundled version that best matches version. Each
+// capture stands for the releases from its own up to the next capture,
+// so this is the newest one released no later than version, or the
+// oldest one if version predates them all. An empty or unparsable
+// version selects the newest.
+func Resolve(version string) string {
+	versions := Versions()
+	if version == "" || version[0] < '0' || version[0] > '9' {
+		return versions[len(versions)-1]
+	}
+	// Versions start with the release date, so they sort chronologically.
+	i, found := slices.BinarySearch(versions, version)
+	switch {
+	case found:
+		return versions[i]
+	case i == 0:
+		return versions[0]
+	}
+	return versions[i-1]
+}
+
+// Keymap parses the bundled keymap for the given version, see Resolve.
+func Keymap(version string) (parser.ParseResult, error) {
+	version = Resolve(version)
+	data, err := keymaps.ReadFile(path.Join("keymaps", version+".txt"))
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	result, err := parser.ParseReaderOptions(context.Background(), strings.NewReader(string(data)), parser.Options{Version: version})
+	if err != nil {
+		return parser.ParseResult{}, fmt.Errorf("built-in defaults for wezterm %s: %w", version, err)
+	}
+	return result, nil
+}
+
+// Builtin is a source that serves the bundled default keymap.
+type Builtin struct {
+	// Version selects the keymap, see Resolve.
+	Version string
+}
+
+func (b Builtin) String() string {
+	return "built-in defaults for wezterm " + Resolve(b.Version)
+}
+
+func (b Builtin) Load(ctx context.Context) (parser.ParseResult, error) {
+	return Keymap(b.Version)
+}
@@ -0,0 +1,155 @@
+package defaults
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+func TestVersions(t *testing.T) {
+	want := []string{"20230712-072601-f4abf8fd", "20240203-110809-5046fc22"}
+	if got := Versions(); !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	cases := map[string]string{
+		"":                         "20240203-110809-5046fc22",
+		"nightly":                  "20240203-110809-5046fc22",
+		"20240203-110809-5046fc22": "20240203-110809-5046fc22",
+		"20250101-000000-00000000": "20240203-110809-5046fc22",
+		"20230901-000000-00000000": "20230712-072601-f4abf8fd",
+		"20230712-072601-f4abf8fd": "20230712-072601-f4abf8fd",
+		"20220624-141144-bd1b7c5d": "20230712-072601-f4abf8fd",
+	}
+	for version, want := range cases {
+		if got := Resolve(version); got != want {
+			t.Errorf("Resolve(%q): got %q, want %q", version, got, want)
+		}
+	}
+}
+
+func TestKeymap(t *testing.T) {
+	for _, version := range Versions() {
+		t.Run(version, func(t *testing.T) {
+			result, err := Keymap(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Diagnostics) != 0 {
+				t.Errorf("unexpected diagnostics: %v", result.Diagnostics)
+			}
+			if result.Version != version {
+				t.Errorf("expected version %q, got %q", version, result.Version)
+			}
+			want := []string{"Default", "copy_mode", "search_mode", "Mouse", "Mouse: alt_screen"}
+			if !slices.Equal(result.Tables, want) {
+				t.Errorf("tables: got %q, want %q", result.Tables, want)
+			}
+
+			var copyTo bool
+			for _, b := range result.Bindings {
+				if b.Table == "Default" && b.Modifiers == parser.ModSuper && b.Key.Name == "c" {
+					copyTo = b.ActionName() == "CopyTo"
+				}
+			}
+			if !copyTo {
+				t.Error("expected SUPER+c to copy")
+			}
+		})
+	}
+}
+
+func TestBuiltin(t *testing.T) {
+	b := Builtin{}
+	if got := b.String(); got != "built-in defaults for wezterm 20240203-110809-5046fc22" {
+		t.Errorf("unexpected String %q", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	kb := func(table string, mods parser.Modifiers, key, action string) parser.Keybinding {
+		return parser.NewKeybinding(table, mods, parser.ParseKey(key), action)
+	}
+	defaults := []parser.Keybinding{
+		kb("Default", parser.ModSuper, "c", "CopyTo(Clipboard)"),
+		kb("Default", parser.ModSuper, "v", "PasteFrom(Clipboard)"),
+		kb("Default", parser.ModCtrl, "Tab", "ActivateTabRelative(1)"),
+		kb("Default", parser.ModSuper, "m", "Hide"),
+		kb("copy_mode", 0, "q", "CopyMode(Close)"),
+	}
+	keymap := []parser.Keybinding{
+		kb("Default", parser.ModSuper, "c", "CopyTo(Clipboard)"),
+		kb("Default", parser.ModSuper, "v", "PasteFrom(PrimarySelection)"),
+		kb("Default", parser.ModSuper, "m", "DisableDefaultAssignment"),
+		kb("Default", parser.ModLeader, "c", "SpawnTab(CurrentPaneDomain)"),
+		kb("copy_mode", parser.ModSuper, "c", "CopyTo(Clipboard)"),
+		kb("copy_mode", 0, "q", "CopyMode(Close)"),
+	}
+
+	c := Classify(keymap, defaults)
+	want := []Origin{OriginDefault, OriginOverridden, OriginRemoved, OriginAdded, OriginAdded, OriginDefault}
+	if !slices.Equal(c.Origins, want) {
+		t.Errorf("origins: got %v, want %v", c.Origins, want)
+	}
+	if len(c.Removed) != 1 || c.Removed[0].Action != "ActivateTabRelative(1)" {
+		t.Errorf("expected CTRL+Tab to be removed, got %v", c.Removed)
+	}
+	if OriginDefault.Customized() || !OriginRemoved.Customized() {
+		t.Error("unexpected Customized")
+	}
+}
+
+func TestClassifyLua(t *testing.T) {
+	defaults, err := Keymap("20240203-110809-5046fc22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keymap, err := parser.ParseLua(context.Background(), `local act = require('wezterm').action
+return {
+  keys = {
+    { key = 'c', mods = 'SUPER', action = act.CopyTo 'Clipboard' },
+    { key = 'U', mods = 'SHIFT|CTRL', action = act.CharSelect { copy_to = 'ClipboardAndPrimarySelection', copy_on_select = true } },
+    { key = 'PageUp', mods = 'SHIFT', action = act.ScrollByPage(-1) },
+    { key = '%', mods = 'SHIFT|ALT|CTRL', action = act.SplitHorizontal { domain = 'CurrentPaneDomain' } },
+    { key = 'PageDown', mods = 'SHIFT', action = act.ScrollByPage(2) },
+  },
+  key_tables = {
+    copy_mode = {
+      { key = 'v', mods = 'CTRL', action = act.CopyMode { SetSelectionMode = 'Block' } },
+    },
+  },
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := Classify(keymap.Bindings, defaults.Bindings)
+	want := []Origin{OriginDefault, OriginDefault, OriginDefault, OriginDefault, OriginOverridden, OriginDefault}
+	if !slices.Equal(c.Origins, want) {
+		t.Errorf("origins: got %v, want %v", c.Origins, want)
+		for i, b := range keymap.Bindings {
+			t.Logf("%d: %s", i, b.Action)
+		}
+	}
+}
+
+func TestWeztermFallback(t *testing.T) {
+	w := Wezterm{Exec: source.Exec{Command: []string{filepath.Join(t.TempDir(), "missing")}, ConfigFile: "x.lua"}}
+	if s := w.String(); !strings.HasSuffix(s, "missing -n show-keys") {
+		t.Errorf("expected config to be skipped, got %q", s)
+	}
+	result, err := w.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Version != Resolve("") {
+		t.Errorf("expected bundled keymap, got version %q", result.Version)
+	}
+}
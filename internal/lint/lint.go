@@ -0,0 +1,178 @@
+// Package lint checks a keymap against a set of rules, so that mistakes
+// in a wezterm config can be caught in CI rather than by a binding that
+// silently does nothing.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Severity tells how serious a finding is. Only errors make a lint run
+// fail.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSeverity parses the name of a severity, as printed by String.
+func ParseSeverity(s string) (Severity, error) {
+	for _, sev := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if s == sev.String() {
+			return sev, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q; want info, warning or error", s)
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Finding is a problem a rule found in the keymap.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Table    string   `json:"table"`
+	// Chord is the chord involved, if the finding is about one.
+	Chord   string `json:"chord,omitempty"`
+	Message string `json:"message"`
+	// Bindings holds the indices of the bindings involved, if any.
+	Bindings []int `json:"-"`
+	// File and Line locate the finding in the config, when known. Run
+	// leaves them empty.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+func (f Finding) String() string {
+	var b strings.Builder
+	if f.File != "" {
+		fmt.Fprintf(&b, "%s:%d: ", f.File, f.Line)
+	}
+	fmt.Fprintf(&b, "%s: %s: %s [%s]", f.Severity, f.Table, f.Message, f.Rule)
+	return b.String()
+}
+
+// Rule is a check over a keymap.
+type Rule struct {
+	Name        string
+	Description string
+	// Severity is the severity of the rule's findings unless configured
+	// otherwise.
+	Severity Severity
+	// Default tells whether the rule runs unless configured otherwise.
+	Default bool
+	check   func(parser.ParseResult) []Finding
+}
+
+// Rules returns every rule, in the order they run.
+func Rules() []Rule {
+	return slices.Clone(rules)
+}
+
+// LookupRule returns the rule called name.
+func LookupRule(name string) (Rule, bool) {
+	i := slices.IndexFunc(rules, func(r Rule) bool { return r.Name == name })
+	if i < 0 {
+		return Rule{}, false
+	}
+	return rules[i], true
+}
+
+// Config selects the rules to run and their severities.
+type Config struct {
+	// Enabled turns rules on or off, overriding Rule.Default.
+	Enabled map[string]bool
+	// Severities overrides the severity of rules.
+	Severities map[string]Severity
+}
+
+// Validate reports rule names in c that do not exist.
+func (c Config) Validate() error {
+	var names []string
+	for name := range c.Enabled {
+		names = append(names, name)
+	}
+	for name := range c.Severities {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		if _, ok := LookupRule(name); !ok {
+			return fmt.Errorf("unknown rule %q", name)
+		}
+	}
+	return nil
+}
+
+// Run checks result with the enabled rules and returns their findings,
+// grouped by rule.
+func (c Config) Run(result parser.ParseResult) []Finding {
+	var findings []Finding
+	for _, r := range rules {
+		enabled, ok := c.Enabled[r.Name]
+		if !ok {
+			enabled = r.Default
+		}
+		if !enabled {
+			continue
+		}
+		sev, ok := c.Severities[r.Name]
+		if !ok {
+			sev = r.Severity
+		}
+		for _, f := range r.check(result) {
+			f.Rule, f.Severity = r.Name, sev
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(findings []Finding) bool {
+	return slices.ContainsFunc(findings, func(f Finding) bool {
+		return f.Severity == SeverityError
+	})
+}
+
+// WriteText writes one finding per line.
+func WriteText(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the findings as a JSON array.
+func WriteJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(findings)
+}
@@ -0,0 +1,162 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+const keymap = `Default key table
+-----------------
+
+	CTRL                 Char('a')          ->   ActivateKeyTable { name: "resize_pane", timeout_milliseconds: None, replace_current: false, one_shot: false, until_unknown: false, prevent_fallback: false }
+	CTRL                 Char('b')          ->   ActivateKeyTable { name: "panes", timeout_milliseconds: None, replace_current: false, one_shot: true, until_unknown: false, prevent_fallback: false }
+	CTRL                 Char('g')          ->   ActivateKeyTable { name: "missing", timeout_milliseconds: None, replace_current: false, one_shot: true, until_unknown: false, prevent_fallback: false }
+	CTRL                 Char('x')          ->   CloseCurrentPane { confirm: true }
+	CTRL                 Char('x')          ->   CloseCurrentTab { confirm: true }
+	CTRL                 Char('y')          ->   Nop
+	CTRL                 Char('y')          ->   Nop
+	CTRL                 Char('i')          ->   ActivateTabRelative(1)
+
+Key Table: resize_pane
+----------------------
+
+	        Char('h')    ->   AdjustPaneSize(Left, 1)
+
+Key Table: panes
+----------------
+
+	        Char('h')    ->   ActivatePaneDirection(Left)
+	        Char('t')    ->   DisableDefaultAssignment
+
+Key Table: forgotten
+--------------------
+
+	        Escape       ->   PopKeyTable
+
+Key Table: copy_mode
+--------------------
+
+	        Escape       ->   Multiple([ScrollToBottom, CopyMode(Close)])
+	        Char('t')    ->   DisableDefaultAssignment
+
+`
+
+func TestRun(t *testing.T) {
+	result := parser.Parse(keymap)
+	if len(result.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", result.Diagnostics)
+	}
+	findings := Config{}.Run(result)
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.String())
+	}
+	want := []string{
+		"error: Default: CTRL+x is bound to 2 different actions; the last one, CloseCurrentTab { confirm: true }, wins [conflict]",
+		"warning: Default: CTRL+y is bound 2 times to the same action [duplicate]",
+		"error: resize_pane: no binding leaves the table with PopKeyTable, ClearKeyTableStack or CopyMode(Close) [no-exit]",
+		"warning: forgotten: no binding activates the table with ActivateKeyTable [unused-table]",
+		`error: Default: CTRL+g activates the key table "missing", which does not exist [unknown-table]`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !HasErrors(findings) {
+		t.Error("expected errors")
+	}
+	if f := findings[0]; f.Chord != "CTRL+x" || len(f.Bindings) != 2 || f.Bindings[1] != 4 {
+		t.Errorf("unexpected conflict %+v", f)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	result := parser.Parse(keymap)
+	cfg := Config{
+		Enabled:    map[string]bool{"clutter": true, "enhanced-keys": true, "no-exit": false, "unknown-table": false, "conflict": false},
+		Severities: map[string]Severity{"unused-table": SeverityError, "duplicate": SeverityInfo},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	rules := make(map[string][]Finding)
+	for _, f := range cfg.Run(result) {
+		rules[f.Rule] = append(rules[f.Rule], f)
+	}
+	if len(rules["no-exit"]) != 0 || len(rules["conflict"]) != 0 || len(rules["unknown-table"]) != 0 {
+		t.Errorf("expected disabled rules not to run, got %v", rules)
+	}
+	// copy_mode has defaults to disable.
+	if fs := rules["clutter"]; len(fs) != 3 || fs[2].Message != "t is bound to DisableDefaultAssignment, but panes has no defaults" {
+		t.Errorf("unexpected clutter %v", fs)
+	}
+	if fs := rules["enhanced-keys"]; len(fs) != 1 || fs[0].Chord != "CTRL+i" {
+		t.Errorf("unexpected enhanced-keys findings %v", fs)
+	}
+	if fs := rules["unused-table"]; len(fs) != 1 || fs[0].Severity != SeverityError {
+		t.Errorf("expected unused-table to be an error, got %v", fs)
+	}
+	if fs := rules["duplicate"]; len(fs) != 1 || fs[0].Severity != SeverityInfo {
+		t.Errorf("expected duplicate to be info, got %v", fs)
+	}
+
+	if err := (Config{Enabled: map[string]bool{"typo": true}}).Validate(); err == nil {
+		t.Error("expected an unknown rule to be rejected")
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("expected an unknown severity to be rejected")
+	}
+}
+
+func TestDefaultsAreClean(t *testing.T) {
+	for _, v := range defaults.Versions() {
+		result, err := defaults.Keymap(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range (Config{}).Run(result) {
+			t.Errorf("%s: %s", v, f)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	findings := []Finding{{
+		Rule:     "conflict",
+		Severity: SeverityError,
+		Table:    "Default",
+		Chord:    "CTRL+x",
+		Message:  "CTRL+x is bound to 2 different actions",
+		File:     "keys.lua",
+		Line:     12,
+	}}
+
+	var text bytes.Buffer
+	if err := WriteText(&text, findings); err != nil {
+		t.Fatal(err)
+	}
+	if got := text.String(); got != "keys.lua:12: error: Default: CTRL+x is bound to 2 different actions [conflict]\n" {
+		t.Errorf("unexpected text %q", got)
+	}
+
+	var out bytes.Buffer
+	if err := WriteJSON(&out, findings); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0]["severity"] != "error" || decoded[0]["line"] != 12.0 {
+		t.Errorf("unexpected JSON %s", out.String())
+	}
+
+	out.Reset()
+	if err := WriteJSON(&out, nil); err != nil || strings.TrimSpace(out.String()) != "[]" {
+		t.Errorf("expected an empty array, got %q", out.String())
+	}
+}
@@ -0,0 +1,292 @@
+package lint
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+var rules = []Rule{
+	{
+		Name:        "conflict",
+		Description: "a chord is bound to different actions in the same table",
+		Severity:    SeverityError,
+		Default:     true,
+		check:       checkConflicts(analysis.KindConflict),
+	},
+	{
+		Name:        "duplicate",
+		Description: "a chord is bound to the same action more than once in the same table",
+		Severity:    SeverityWarning,
+		Default:     true,
+		check:       checkConflicts(analysis.KindDuplicate, analysis.KindEquivalent),
+	},
+	{
+		Name:        "shadowed",
+		Description: "a binding never fires because an equivalent chord takes precedence",
+		Severity:    SeverityWarning,
+		Default:     true,
+		check:       checkShadowed,
+	},
+	{
+		Name:        "no-exit",
+		Description: "a key table that stays active has no binding that leaves it",
+		Severity:    SeverityError,
+		Default:     true,
+		check:       checkNoExit,
+	},
+	{
+		Name:        "unused-table",
+		Description: "a key table is never activated by ActivateKeyTable",
+		Severity:    SeverityWarning,
+		Default:     true,
+		check:       checkUnusedTables,
+	},
+	{
+		Name:        "unknown-table",
+		Description: "ActivateKeyTable names a key table that does not exist",
+		Severity:    SeverityError,
+		Default:     true,
+		check:       checkUnknownTables,
+	},
+	{
+		Name:        "clutter",
+		Description: "a binding does nothing: Nop, or DisableDefaultAssignment where there is no default",
+		Severity:    SeverityInfo,
+		Default:     false,
+		check:       checkClutter,
+	},
+	{
+		Name:        "enhanced-keys",
+		Description: "a chord needs an enhanced keyboard protocol to be told apart from another key",
+		Severity:    SeverityInfo,
+		Default:     false,
+		check:       checkEnhancedKeys,
+	},
+}
+
+// modeTables are key tables that wezterm activates through their own
+// actions rather than ActivateKeyTable.
+var modeTables = map[string]string{
+	"copy_mode":   "ActivateCopyMode",
+	"search_mode": "Search",
+}
+
+func checkConflicts(kinds ...analysis.Kind) func(parser.ParseResult) []Finding {
+	return func(result parser.ParseResult) []Finding {
+		var findings []Finding
+		for _, c := range analysis.Conflicts(result.Bindings) {
+			if !slices.Contains(kinds, c.Kind) {
+				continue
+			}
+			msg := fmt.Sprintf("%s is bound %d times to the same action", c.Chord, len(c.Bindings))
+			switch c.Kind {
+			case analysis.KindConflict:
+				msg = fmt.Sprintf("%s is bound to %d different actions; the last one, %s, wins",
+					c.Chord, len(c.Bindings), result.Bindings[c.Winner()].Action)
+			case analysis.KindEquivalent:
+				msg += ", with modifiers written differently"
+			}
+			findings = append(findings, Finding{
+				Table:    c.Table,
+				Chord:    c.Chord.String(),
+				Message:  msg,
+				Bindings: c.Bindings,
+			})
+		}
+		return findings
+	}
+}
+
+func checkShadowed(result parser.ParseResult) []Finding {
+	var findings []Finding
+	for _, s := range analysis.Equivalents(result.Bindings) {
+		findings = append(findings, Finding{
+			Table:    s.Table,
+			Chord:    s.Chord(s.Shadowed()[0]).String(),
+			Message:  s.String(),
+			Bindings: s.Shadowed(),
+		})
+	}
+	return findings
+}
+
+// keyTables returns the key tables of result in order, leaving out the
+// Default and Mouse tables.
+func keyTables(result parser.ParseResult) []string {
+	var tables []string
+	for _, t := range result.Tables {
+		if t != "Default" && !parser.IsMouseTable(t) {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// activation is an ActivateKeyTable action of a binding.
+type activation struct {
+	binding int
+	node    parser.Node
+}
+
+func (a activation) table() string {
+	name, _ := a.node.Field("name")
+	return name.Value
+}
+
+// persistent reports whether the table stays active until a binding
+// leaves it: it is not one_shot, which is the default, has no timeout
+// and is not left on an unknown key.
+func (a activation) persistent() bool {
+	if v, ok := a.node.Field("one_shot"); !ok || v.Name != "false" {
+		return false
+	}
+	if v, ok := a.node.Field("timeout_milliseconds"); ok && v.Name != "None" {
+		return false
+	}
+	v, ok := a.node.Field("until_unknown")
+	return !ok || v.Name != "true"
+}
+
+func activations(result parser.ParseResult) []activation {
+	var found []activation
+	for i, b := range result.Bindings {
+		b.ActionTree.Walk(func(n parser.Node) bool {
+			if n.Kind == parser.NodeStruct && n.Name == "ActivateKeyTable" {
+				found = append(found, activation{binding: i, node: n})
+				return false
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// exits reports whether action leaves a key table.
+func exits(action parser.Node) bool {
+	found := false
+	action.Walk(func(n parser.Node) bool {
+		switch {
+		case n.Name == "PopKeyTable", n.Name == "ClearKeyTableStack":
+			found = true
+		case n.Kind == parser.NodeCall && n.Name == "CopyMode":
+			if arg, ok := n.Arg(0); ok && arg.Name == "Close" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func checkNoExit(result parser.ParseResult) []Finding {
+	persistent := make(map[string]bool)
+	for t := range modeTables {
+		persistent[t] = true
+	}
+	for _, a := range activations(result) {
+		if a.persistent() {
+			persistent[a.table()] = true
+		}
+	}
+
+	var findings []Finding
+	for _, t := range keyTables(result) {
+		if !persistent[t] {
+			continue
+		}
+		left := slices.ContainsFunc(result.Bindings, func(b parser.Keybinding) bool {
+			return b.Table == t && exits(b.ActionTree)
+		})
+		if !left {
+			findings = append(findings, Finding{
+				Table:   t,
+				Message: "no binding leaves the table with PopKeyTable, ClearKeyTableStack or CopyMode(Close)",
+			})
+		}
+	}
+	return findings
+}
+
+func checkUnusedTables(result parser.ParseResult) []Finding {
+	used := make(map[string]bool)
+	for _, a := range activations(result) {
+		used[a.table()] = true
+	}
+	var findings []Finding
+	for _, t := range keyTables(result) {
+		if _, ok := modeTables[t]; ok || used[t] {
+			continue
+		}
+		findings = append(findings, Finding{
+			Table:   t,
+			Message: "no binding activates the table with ActivateKeyTable",
+		})
+	}
+	return findings
+}
+
+func checkUnknownTables(result parser.ParseResult) []Finding {
+	tables := keyTables(result)
+	var findings []Finding
+	for _, a := range activations(result) {
+		if name := a.table(); !slices.Contains(tables, name) {
+			b := result.Bindings[a.binding]
+			findings = append(findings, Finding{
+				Table:    b.Table,
+				Chord:    b.Chord().String(),
+				Message:  fmt.Sprintf("%s activates the key table %q, which does not exist", b.Chord(), name),
+				Bindings: []int{a.binding},
+			})
+		}
+	}
+	return findings
+}
+
+func checkClutter(result parser.ParseResult) []Finding {
+	var findings []Finding
+	for i, b := range result.Bindings {
+		var msg string
+		switch b.ActionName() {
+		case "Nop":
+			msg = fmt.Sprintf("%s is bound to Nop, which swallows the key", b.Chord())
+		case "DisableDefaultAssignment":
+			if b.Table == "Default" || parser.IsMouseTable(b.Table) {
+				continue
+			}
+			if _, ok := modeTables[b.Table]; ok {
+				continue
+			}
+			msg = fmt.Sprintf("%s is bound to DisableDefaultAssignment, but %s has no defaults", b.Chord(), b.Table)
+		default:
+			continue
+		}
+		findings = append(findings, Finding{
+			Table:    b.Table,
+			Chord:    b.Chord().String(),
+			Message:  msg,
+			Bindings: []int{i},
+		})
+	}
+	return findings
+}
+
+func checkEnhancedKeys(result parser.ParseResult) []Finding {
+	var findings []Finding
+	for i, b := range result.Bindings {
+		if parser.IsMouseTable(b.Table) {
+			continue
+		}
+		if a, ok := analysis.Ambiguous(b.Chord()); ok {
+			findings = append(findings, Finding{
+				Table:    b.Table,
+				Chord:    b.Chord().String(),
+				Message:  a.String(),
+				Bindings: []int{i},
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,183 @@
+package lua
+
+// The syntax tree of a Lua chunk. Only what the evaluator needs is kept:
+// every node records the line it starts on for diagnostics.
+
+type expr interface {
+	exprLine() int
+}
+
+type (
+	nilExpr  struct{ line int }
+	boolExpr struct {
+		line  int
+		value bool
+	}
+	numberExpr struct {
+		line  int
+		value float64
+	}
+	stringExpr struct {
+		line  int
+		value string
+	}
+	varargExpr struct{ line int }
+	nameExpr   struct {
+		line int
+		name string
+	}
+	// indexExpr is obj[key]; obj.name is parsed with a stringExpr key.
+	indexExpr struct {
+		line     int
+		obj, key expr
+	}
+	callExpr struct {
+		line int
+		fn   expr
+		args []expr
+	}
+	// methodCallExpr is obj:name(args).
+	methodCallExpr struct {
+		line int
+		obj  expr
+		name string
+		args []expr
+	}
+	functionExpr struct {
+		line, endLine int
+		// start and end delimit the function's source text, and
+		// bodyStart is where its body begins.
+		start, end, bodyStart int
+		params                []string
+		vararg                bool
+		body                  []stmt
+	}
+	tableExpr struct {
+		line  int
+		items []tableItem
+	}
+	binopExpr struct {
+		line int
+		op   string
+		l, r expr
+	}
+	unopExpr struct {
+		line int
+		op   string
+		x    expr
+	}
+	// parenExpr truncates a multi-valued expression to one value.
+	parenExpr struct {
+		line int
+		x    expr
+	}
+)
+
+// tableItem is a field of a table constructor. key is nil for
+// positional items.
+type tableItem struct {
+	line  int
+	key   expr
+	value expr
+}
+
+func (e nilExpr) exprLine() int        { return e.line }
+func (e boolExpr) exprLine() int       { return e.line }
+func (e numberExpr) exprLine() int     { return e.line }
+func (e stringExpr) exprLine() int     { return e.line }
+func (e varargExpr) exprLine() int     { return e.line }
+func (e nameExpr) exprLine() int       { return e.line }
+func (e indexExpr) exprLine() int      { return e.line }
+func (e callExpr) exprLine() int       { return e.line }
+func (e methodCallExpr) exprLine() int { return e.line }
+func (e *functionExpr) exprLine() int  { return e.line }
+func (e tableExpr) exprLine() int      { return e.line }
+func (e binopExpr) exprLine() int      { return e.line }
+func (e unopExpr) exprLine() int       { return e.line }
+func (e parenExpr) exprLine() int      { return e.line }
+
+type stmt interface {
+	stmtLine() int
+}
+
+type (
+	localStmt struct {
+		line  int
+		names []string
+		exprs []expr
+	}
+	assignStmt struct {
+		line    int
+		targets []expr
+		exprs   []expr
+	}
+	callStmt struct {
+		line int
+		call expr
+	}
+	doStmt struct {
+		line int
+		body []stmt
+	}
+	whileStmt struct {
+		line int
+		cond expr
+		body []stmt
+	}
+	repeatStmt struct {
+		line int
+		body []stmt
+		cond expr
+	}
+	ifStmt struct {
+		line   int
+		conds  []expr
+		blocks [][]stmt
+		els    []stmt // nil without an else branch
+	}
+	numForStmt struct {
+		line               int
+		name               string
+		start, limit, step expr // step may be nil
+		body               []stmt
+	}
+	genForStmt struct {
+		line  int
+		names []string
+		exprs []expr
+		body  []stmt
+	}
+	localFunctionStmt struct {
+		line int
+		name string
+		fn   *functionExpr
+	}
+	returnStmt struct {
+		line  int
+		exprs []expr
+	}
+	breakStmt struct{ line int }
+	gotoStmt  struct {
+		line  int
+		label string
+	}
+	labelStmt struct {
+		line int
+		name string
+	}
+)
+
+func (s localStmt) stmtLine() int         { return s.line }
+func (s assignStmt) stmtLine() int        { return s.line }
+func (s callStmt) stmtLine() int          { return s.line }
+func (s doStmt) stmtLine() int            { return s.line }
+func (s whileStmt) stmtLine() int         { return s.line }
+func (s repeatStmt) stmtLine() int        { return s.line }
+func (s ifStmt) stmtLine() int            { return s.line }
+func (s numForStmt) stmtLine() int        { return s.line }
+func (s genForStmt) stmtLine() int        { return s.line }
+func (s localFunctionStmt) stmtLine() int { return s.line }
+func (s returnStmt) stmtLine() int        { return s.line }
+func (s breakStmt) stmtLine() int         { return s.line }
+func (s gotoStmt) stmtLine() int          { return s.line }
+func (s labelStmt) stmtLine() int         { return s.line }
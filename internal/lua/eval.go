@@ -0,0 +1,1211 @@
+// Package lua evaluates wezterm Lua configs, and the snippets printed by
+// "wezterm show-keys --lua", with a small Lua interpreter in which
+// everything that depends on the machine or the running terminal is
+// unknown. Values are represented as:
+//
+//	nil, bool, float64, string   Lua nil, booleans, numbers and strings
+//	*Table                       Lua tables
+//	*closure, *builtin           Lua and Go functions
+//	*Action                      wezterm.action constructors and their results
+//	Unknown                      a value that cannot be derived statically
+//
+// Constructs whose value cannot be derived are reported as diagnostics
+// rather than errors.
+package lua
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type value = any
+
+// Pos is a line in a Lua file.
+type Pos struct {
+	File string
+	Line int
+}
+
+// Unknown is a value only known at runtime, such as
+// wezterm.target_triple.
+type Unknown struct {
+	// What describes where the value comes from, for diagnostics.
+	What string
+}
+
+// Table is a Lua table. Pos is where its constructor is.
+type Table struct {
+	Pos
+	hash map[any]value
+	keys []any // insertion order, for pairs
+	// open names a module whose missing fields are unknown rather than
+	// nil, e.g. "wezterm".
+	open string
+}
+
+func newTable(file string, line int) *Table {
+	return &Table{hash: map[any]value{}, Pos: Pos{File: file, Line: line}}
+}
+
+// Get returns the value of t[k].
+func (t *Table) Get(k any) any {
+	v, ok := t.hash[k]
+	if !ok && t.open != "" {
+		if s, isString := k.(string); isString {
+			return Unknown{What: t.open + "." + s}
+		}
+	}
+	return v
+}
+
+func (t *Table) set(k, v value) {
+	if v == nil {
+		if _, ok := t.hash[k]; ok {
+			delete(t.hash, k)
+			for i, key := range t.keys {
+				if key == k {
+					t.keys = append(t.keys[:i], t.keys[i+1:]...)
+					break
+				}
+			}
+		}
+		return
+	}
+	if _, ok := t.hash[k]; !ok {
+		t.keys = append(t.keys, k)
+	}
+	t.hash[k] = v
+}
+
+// Keys returns the keys of t in insertion order.
+func (t *Table) Keys() []any {
+	return t.keys
+}
+
+// Fields returns the string keys of t in insertion order.
+func (t *Table) Fields() []string {
+	var names []string
+	for _, k := range t.keys {
+		if s, ok := k.(string); ok {
+			names = append(names, s)
+		}
+	}
+	return names
+}
+
+// Length returns the border of the array part, as the # operator does.
+func (t *Table) Length() int {
+	n := 0
+	for t.hash[float64(n+1)] != nil {
+		n++
+	}
+	return n
+}
+
+// List returns the array part of the table.
+func (t *Table) List() []any {
+	n := t.Length()
+	list := make([]value, n)
+	for i := range list {
+		list[i] = t.hash[float64(i+1)]
+	}
+	return list
+}
+
+type closure struct {
+	fn   *functionExpr
+	env  *scope
+	file string
+}
+
+type builtin struct {
+	name string
+	fn   func(e *Evaluator, line int, args []value) ([]value, error)
+}
+
+// Action is wezterm.action.Name, optionally called with arguments. Pos
+// is where it is created.
+type Action struct {
+	Pos
+	Name   string
+	Called bool
+	Args   []any
+}
+
+// actionNamespace is wezterm.action.
+type actionNamespace struct{}
+
+type cell struct {
+	v value
+}
+
+type scope struct {
+	vars   map[string]*cell
+	parent *scope
+}
+
+func (s *scope) lookup(name string) *cell {
+	for ; s != nil; s = s.parent {
+		if c, ok := s.vars[name]; ok {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *scope) declare(name string, v value) {
+	s.vars[name] = &cell{v: v}
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{vars: map[string]*cell{}, parent: parent}
+}
+
+type control int
+
+const (
+	ctrlNone control = iota
+	ctrlBreak
+	ctrlReturn
+	// ctrlGoto leaves blocks until one holds the label Evaluator.label.
+	ctrlGoto
+)
+
+const (
+	// maxSteps bounds the work done on one config, so that a loop whose
+	// exit depends on runtime state cannot hang the analysis.
+	maxSteps = 1_000_000
+	maxDepth = 200
+	// maxString bounds the length of the strings a config builds, since
+	// string.rep and .. can grow one exponentially within maxSteps.
+	maxString = 1 << 20
+	// ctxEvery is how many steps pass between checks of the context.
+	ctxEvery = 1024
+)
+
+// errBudget aborts evaluation once maxSteps is exceeded.
+var errBudget = fmt.Errorf("evaluation budget of %d steps exhausted", maxSteps)
+
+// checkLen raises a Lua error if a string of n bytes would be too long.
+func checkLen(n int) error {
+	if n > maxString {
+		return &Error{value: fmt.Sprintf("resulting string too large (over %d bytes)", maxString)}
+	}
+	return nil
+}
+
+// Evaluator runs Lua chunks in a shared global environment.
+type Evaluator struct {
+	ctx     context.Context // of the running chunk
+	dir     string          // config directory, for require
+	globals *Table
+	wezterm *Table
+	strings *Table
+	modules map[string][]value
+	loading map[string]bool
+	sources map[string]string
+	files   []string
+	diags   []Diagnostic
+	seen    map[Diagnostic]bool
+	steps   int
+	depth   int
+	file    string // file being evaluated
+	label   string // target of the goto being taken
+	// handlers collects wezterm.on handlers and action callbacks.
+	handlers []Handler
+	// callbacks counts wezterm.action_callback calls, which wezterm
+	// names user-defined-0, user-defined-1, ...
+	callbacks int
+}
+
+// Diagnostic is a construct whose value could not be derived.
+type Diagnostic struct {
+	Pos
+	Reason string
+}
+
+func (e *Evaluator) diag(line int, format string, args ...any) {
+	e.Diag(Pos{File: e.file, Line: line}, format, args...)
+}
+
+// Diag reports a construct at pos whose value cannot be used, once.
+func (e *Evaluator) Diag(pos Pos, format string, args ...any) {
+	d := Diagnostic{Pos: pos, Reason: fmt.Sprintf(format, args...)}
+	if !e.seen[d] {
+		e.seen[d] = true
+		e.diags = append(e.diags, d)
+	}
+}
+
+// Diagnostics returns what has been reported so far, in order.
+func (e *Evaluator) Diagnostics() []Diagnostic {
+	return e.diags
+}
+
+// Files lists the files evaluated so far: the chunk passed to RunFile
+// and the modules it required.
+func (e *Evaluator) Files() []string {
+	return e.files
+}
+
+// Handlers lists the wezterm.on handlers and action callbacks in the
+// order they were registered.
+func (e *Evaluator) Handlers() []Handler {
+	return e.handlers
+}
+
+// SourceLine returns the trimmed text of a line of an evaluated file.
+func (e *Evaluator) SourceLine(pos Pos) string {
+	lines := strings.Split(e.sources[pos.File], "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[pos.Line-1])
+}
+
+func (e *Evaluator) step() error {
+	e.steps++
+	if e.steps > maxSteps {
+		return errBudget
+	}
+	if e.steps%ctxEvery == 0 {
+		return e.ctx.Err()
+	}
+	return nil
+}
+
+// fatal reports whether err stops the evaluation as a whole rather than
+// the chunk or module that raised it.
+func (e *Evaluator) fatal(err error) bool {
+	return err == errBudget || err != nil && err == e.ctx.Err()
+}
+
+// NewEvaluator returns an evaluator that loads required modules from
+// the config directory dir. With an empty dir, no modules are found.
+func NewEvaluator(dir string) *Evaluator {
+	e := &Evaluator{
+		dir:     dir,
+		modules: map[string][]value{},
+		loading: map[string]bool{},
+		sources: map[string]string{},
+		seen:    map[Diagnostic]bool{},
+	}
+	e.globals = newTable("", 0)
+	e.wezterm = e.weztermModule()
+	installStdlib(e)
+	return e
+}
+
+// RunFile evaluates a Lua file and returns what it returns.
+func (e *Evaluator) RunFile(ctx context.Context, path string) ([]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.Run(ctx, path, string(data))
+}
+
+// Run evaluates the Lua chunk src and returns what it returns. name is
+// the file the chunk comes from, or empty. Evaluation stops with the
+// context's error if ctx is cancelled.
+func (e *Evaluator) Run(ctx context.Context, name, src string) ([]any, error) {
+	prevCtx := e.ctx
+	e.ctx = ctx
+	defer func() { e.ctx = prevCtx }()
+	body, err := parseChunk(src)
+	if err != nil {
+		if se, ok := err.(*SyntaxError); ok {
+			se.File = name
+		}
+		return nil, err
+	}
+	e.sources[name] = src
+	if name != "" {
+		e.files = append(e.files, name)
+	}
+
+	prev := e.file
+	e.file = name
+	defer func() { e.file = prev }()
+	ctrl, ret, err := e.block(body, newScope(nil))
+	if err != nil {
+		return nil, err
+	}
+	if ctrl == ctrlGoto {
+		return nil, e.noLabel()
+	}
+	if ctrl == ctrlReturn {
+		return ret, nil
+	}
+	return nil, nil
+}
+
+// ModulePath resolves a Lua module name such as "keys" or "ui.theme" to
+// a file in the config directory dir, trying name.lua and then
+// name/init.lua with dots turned into directories.
+func ModulePath(dir, name string) (string, bool) {
+	module := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, ".", "/")))
+	for _, candidate := range []string{module + ".lua", filepath.Join(module, "init.lua")} {
+		if fi, err := os.Stat(candidate); err == nil && !fi.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// require loads a module from the config directory once.
+func (e *Evaluator) require(line int, name string) (value, error) {
+	if name == "wezterm" {
+		return e.wezterm, nil
+	}
+	missing := Unknown{What: "require " + strconv.Quote(name)}
+	path, ok := "", false
+	if e.dir != "" {
+		path, ok = ModulePath(e.dir, name)
+	}
+	if !ok {
+		e.diag(line, "module %q not found next to the config", name)
+		return missing, nil
+	}
+	if ret, ok := e.modules[path]; ok {
+		return First(ret), nil
+	}
+	if e.loading[path] {
+		e.diag(line, "module %q requires itself", name)
+		return missing, nil
+	}
+	e.loading[path] = true
+	ret, err := e.RunFile(e.ctx, path)
+	delete(e.loading, path)
+	if e.fatal(err) {
+		return nil, err
+	}
+	if err != nil {
+		e.diag(line, "module %q: %v", name, err)
+		return missing, nil
+	}
+	if ret == nil {
+		ret = []value{true}
+	}
+	e.modules[path] = ret
+	return First(ret), nil
+}
+
+// First returns the first of the values a chunk or call returns, or nil.
+func First(vs []any) any {
+	if len(vs) == 0 {
+		return nil
+	}
+	return vs[0]
+}
+
+func (e *Evaluator) block(body []stmt, s *scope) (control, []value, error) {
+	for i := 0; i < len(body); i++ {
+		ctrl, ret, err := e.stmt(body[i], s)
+		if err == nil && ctrl == ctrlGoto {
+			if at := labelIndex(body, e.label); at >= 0 {
+				i = at
+				continue
+			}
+		}
+		if err != nil || ctrl != ctrlNone {
+			return ctrl, ret, err
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+// labelIndex returns the index of the label named name in body, or -1.
+func labelIndex(body []stmt, name string) int {
+	for i, st := range body {
+		if l, ok := st.(labelStmt); ok && l.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// noLabel is the error for a goto that left the function or chunk
+// without finding its label.
+func (e *Evaluator) noLabel() error {
+	return &Error{value: fmt.Sprintf("no visible label '%s' for goto", e.label)}
+}
+
+func (e *Evaluator) stmt(st stmt, s *scope) (control, []value, error) {
+	if err := e.step(); err != nil {
+		return ctrlNone, nil, err
+	}
+	switch st := st.(type) {
+	case localStmt:
+		vals, err := e.exprList(st.exprs, s)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		for i, name := range st.names {
+			var v value
+			if i < len(vals) {
+				v = vals[i]
+			}
+			s.declare(name, v)
+		}
+	case localFunctionStmt:
+		s.declare(st.name, nil)
+		s.vars[st.name].v = &closure{fn: st.fn, env: s, file: e.file}
+	case assignStmt:
+		return ctrlNone, nil, e.assign(st, s)
+	case callStmt:
+		_, err := e.multi(st.call, s)
+		return ctrlNone, nil, err
+	case doStmt:
+		return e.block(st.body, newScope(s))
+	case returnStmt:
+		vals, err := e.exprList(st.exprs, s)
+		return ctrlReturn, vals, err
+	case breakStmt:
+		return ctrlBreak, nil, nil
+	case gotoStmt:
+		e.label = st.label
+		return ctrlGoto, nil, nil
+	case labelStmt:
+	case ifStmt:
+		return e.ifStmt(st, s)
+	case whileStmt:
+		return e.whileStmt(st, s)
+	case repeatStmt:
+		return e.repeatStmt(st, s)
+	case numForStmt:
+		return e.numFor(st, s)
+	case genForStmt:
+		return e.genFor(st, s)
+	}
+	return ctrlNone, nil, nil
+}
+
+func (e *Evaluator) assign(st assignStmt, s *scope) error {
+	vals, err := e.exprList(st.exprs, s)
+	if err != nil {
+		return err
+	}
+	for i, target := range st.targets {
+		var v value
+		if i < len(vals) {
+			v = vals[i]
+		}
+		switch t := target.(type) {
+		case nameExpr:
+			if c := s.lookup(t.name); c != nil {
+				c.v = v
+			} else {
+				e.globals.set(t.name, v)
+			}
+		case indexExpr:
+			obj, err := e.eval(t.obj, s)
+			if err != nil {
+				return err
+			}
+			key, err := e.eval(t.key, s)
+			if err != nil {
+				return err
+			}
+			switch obj := obj.(type) {
+			case *Table:
+				if _, ok := key.(Unknown); ok {
+					e.diag(t.line, "assignment to a table key that depends on runtime state is ignored")
+					continue
+				}
+				if key == nil {
+					e.diag(t.line, "assignment to a nil table key is ignored")
+					continue
+				}
+				obj.set(key, v)
+			case Unknown:
+				// Assigning into a runtime value, e.g. a window object.
+			default:
+				e.diag(t.line, "cannot index a %s value", TypeName(obj))
+			}
+		}
+	}
+	return nil
+}
+
+// truth reports whether v is true in a condition; ok is false if v is
+// unknown.
+func truth(v value) (result, ok bool) {
+	switch v := v.(type) {
+	case nil:
+		return false, true
+	case bool:
+		return v, true
+	case Unknown:
+		return false, false
+	}
+	return true, true
+}
+
+func (e *Evaluator) ifStmt(st ifStmt, s *scope) (control, []value, error) {
+	for i, cond := range st.conds {
+		v, err := e.eval(cond, s)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		t, ok := truth(v)
+		if !ok {
+			// Configs often branch on the platform; evaluating the first
+			// branch matches what most people see on their main machine.
+			e.diag(cond.exprLine(), "condition depends on %s; assuming it is true", v.(Unknown).What)
+			t = true
+		}
+		if t {
+			return e.block(st.blocks[i], newScope(s))
+		}
+	}
+	if st.els != nil {
+		return e.block(st.els, newScope(s))
+	}
+	return ctrlNone, nil, nil
+}
+
+func (e *Evaluator) whileStmt(st whileStmt, s *scope) (control, []value, error) {
+	for {
+		v, err := e.eval(st.cond, s)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		t, ok := truth(v)
+		if !ok {
+			e.diag(st.line, "loop condition depends on %s; loop skipped", v.(Unknown).What)
+			return ctrlNone, nil, nil
+		}
+		if !t {
+			return ctrlNone, nil, nil
+		}
+		// Count every iteration, so that an empty loop body is bounded too.
+		if err := e.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+		ctrl, ret, err := e.block(st.body, newScope(s))
+		if err != nil || ctrl == ctrlReturn || ctrl == ctrlGoto {
+			return ctrl, ret, err
+		}
+		if ctrl == ctrlBreak {
+			return ctrlNone, nil, nil
+		}
+	}
+}
+
+func (e *Evaluator) repeatStmt(st repeatStmt, s *scope) (control, []value, error) {
+	for {
+		if err := e.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+		inner := newScope(s)
+		ctrl, ret, err := e.block(st.body, inner)
+		if err != nil || ctrl == ctrlReturn || ctrl == ctrlGoto {
+			return ctrl, ret, err
+		}
+		if ctrl == ctrlBreak {
+			return ctrlNone, nil, nil
+		}
+		v, err := e.eval(st.cond, inner)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		t, ok := truth(v)
+		if !ok {
+			e.diag(st.line, "loop condition depends on %s; loop stopped", v.(Unknown).What)
+			return ctrlNone, nil, nil
+		}
+		if t {
+			return ctrlNone, nil, nil
+		}
+	}
+}
+
+func (e *Evaluator) numFor(st numForStmt, s *scope) (control, []value, error) {
+	exprs := []expr{st.start, st.limit}
+	if st.step != nil {
+		exprs = append(exprs, st.step)
+	}
+	nums := []float64{0, 0, 1}
+	for i, x := range exprs {
+		v, err := e.eval(x, s)
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		n, ok := toNumber(v)
+		if !ok {
+			e.diag(st.line, "for loop bounds depend on %s; loop skipped", Describe(v))
+			return ctrlNone, nil, nil
+		}
+		nums[i] = n
+	}
+	start, limit, step := nums[0], nums[1], nums[2]
+	if step == 0 {
+		e.diag(st.line, "for loop step is zero")
+		return ctrlNone, nil, nil
+	}
+	for i := start; step > 0 && i <= limit || step < 0 && i >= limit; i += step {
+		if err := e.step(); err != nil {
+			return ctrlNone, nil, err
+		}
+		inner := newScope(s)
+		inner.declare(st.name, i)
+		ctrl, ret, err := e.block(st.body, inner)
+		if err != nil || ctrl == ctrlReturn || ctrl == ctrlGoto {
+			return ctrl, ret, err
+		}
+		if ctrl == ctrlBreak {
+			break
+		}
+	}
+	return ctrlNone, nil, nil
+}
+
+func (e *Evaluator) genFor(st genForStmt, s *scope) (control, []value, error) {
+	vals, err := e.exprList(st.exprs, s)
+	if err != nil {
+		return ctrlNone, nil, err
+	}
+	vals = append(vals, nil, nil, nil)
+	fn, state, control := vals[0], vals[1], vals[2]
+	if u, ok := fn.(Unknown); ok {
+		e.diag(st.line, "loop over %s skipped", u.What)
+		return ctrlNone, nil, nil
+	}
+	for {
+		rets, err := e.call(st.line, fn, []value{state, control})
+		if err != nil {
+			return ctrlNone, nil, err
+		}
+		if First(rets) == nil {
+			return ctrlNone, nil, nil
+		}
+		if u, ok := First(rets).(Unknown); ok {
+			e.diag(st.line, "loop over %s skipped", u.What)
+			return ctrlNone, nil, nil
+		}
+		control = rets[0]
+		inner := newScope(s)
+		for i, name := range st.names {
+			var v value
+			if i < len(rets) {
+				v = rets[i]
+			}
+			inner.declare(name, v)
+		}
+		ctrl, ret, err := e.block(st.body, inner)
+		if err != nil || ctrl == ctrlReturn || ctrl == ctrlGoto {
+			return ctrl, ret, err
+		}
+		if ctrl == ctrlBreak {
+			return ctrlNone, nil, nil
+		}
+	}
+}
+
+// exprList evaluates expressions, expanding all results of the last one.
+func (e *Evaluator) exprList(exprs []expr, s *scope) ([]value, error) {
+	var vals []value
+	for i, x := range exprs {
+		if i == len(exprs)-1 {
+			vs, err := e.multi(x, s)
+			if err != nil {
+				return nil, err
+			}
+			return append(vals, vs...), nil
+		}
+		v, err := e.eval(x, s)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// multi evaluates an expression that may produce several values.
+func (e *Evaluator) multi(x expr, s *scope) ([]value, error) {
+	switch x := x.(type) {
+	case callExpr:
+		fn, err := e.eval(x.fn, s)
+		if err != nil {
+			return nil, err
+		}
+		args, err := e.exprList(x.args, s)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fn.(Unknown); !ok && fn == nil {
+			e.diag(x.line, "call to %s, which is nil", exprName(x.fn))
+			return []value{Unknown{What: "a call to nil"}}, nil
+		}
+		return e.call(x.line, fn, args)
+	case methodCallExpr:
+		obj, err := e.eval(x.obj, s)
+		if err != nil {
+			return nil, err
+		}
+		args, err := e.exprList(x.args, s)
+		if err != nil {
+			return nil, err
+		}
+		fn := e.index(x.line, obj, x.name)
+		return e.call(x.line, fn, append([]value{obj}, args...))
+	case varargExpr:
+		c := s.lookup("...")
+		if c == nil {
+			return nil, nil
+		}
+		return c.v.([]value), nil
+	}
+	v, err := e.eval(x, s)
+	return []value{v}, err
+}
+
+func (e *Evaluator) call(line int, fn value, args []value) ([]value, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	switch fn := fn.(type) {
+	case *closure:
+		return e.callClosure(line, fn, args)
+	case *builtin:
+		return fn.fn(e, line, args)
+	case *Action:
+		if fn.Called {
+			e.diag(line, "action %s called twice", fn.Name)
+			return []value{Unknown{What: "a call to an action"}}, nil
+		}
+		return []value{&Action{Name: fn.Name, Called: true, Args: args, Pos: Pos{File: e.file, Line: line}}}, nil
+	case actionNamespace:
+		// The old wezterm.action{ Name = args } form.
+		if t, ok := First(args).(*Table); ok && len(t.keys) == 1 {
+			if name, ok := t.keys[0].(string); ok {
+				return []value{&Action{Name: name, Called: true, Args: []value{t.hash[name]}, Pos: Pos{File: e.file, Line: line}}}, nil
+			}
+		}
+		e.diag(line, "unrecognized wezterm.action call")
+		return []value{Unknown{What: "wezterm.action(...)"}}, nil
+	case Unknown:
+		return []value{Unknown{What: "the result of " + fn.What}}, nil
+	}
+	e.diag(line, "attempt to call a %s value", TypeName(fn))
+	return []value{Unknown{What: "a failed call"}}, nil
+}
+
+func (e *Evaluator) callClosure(line int, c *closure, args []value) ([]value, error) {
+	if e.depth >= maxDepth {
+		e.diag(line, "call depth limit reached")
+		return []value{Unknown{What: "a deeply recursive call"}}, nil
+	}
+	e.depth++
+	prev := e.file
+	e.file = c.file
+	defer func() {
+		e.depth--
+		e.file = prev
+	}()
+
+	s := newScope(c.env)
+	for i, name := range c.fn.params {
+		var v value
+		if i < len(args) {
+			v = args[i]
+		}
+		s.declare(name, v)
+	}
+	if c.fn.vararg {
+		var rest []value
+		if len(args) > len(c.fn.params) {
+			rest = args[len(c.fn.params):]
+		}
+		s.vars["..."] = &cell{v: rest}
+	}
+	ctrl, ret, err := e.block(c.fn.body, s)
+	if err != nil {
+		return nil, err
+	}
+	if ctrl == ctrlGoto {
+		return nil, e.noLabel()
+	}
+	if ctrl == ctrlReturn {
+		return ret, nil
+	}
+	return nil, nil
+}
+
+func (e *Evaluator) index(line int, obj value, key value) value {
+	switch obj := obj.(type) {
+	case *Table:
+		if _, ok := key.(Unknown); ok {
+			return Unknown{What: "a table lookup with a runtime key"}
+		}
+		return obj.Get(key)
+	case actionNamespace:
+		if name, ok := key.(string); ok {
+			return &Action{Name: name, Pos: Pos{File: e.file, Line: line}}
+		}
+		return Unknown{What: "wezterm.action[...]"}
+	case string:
+		// Method calls on strings go to the string library.
+		return e.strings.Get(key)
+	case Unknown:
+		if k, ok := key.(string); ok {
+			return Unknown{What: obj.What + "." + k}
+		}
+		return obj
+	case nil:
+		e.diag(line, "attempt to index a nil value")
+		return Unknown{What: "a field of nil"}
+	}
+	e.diag(line, "attempt to index a %s value", TypeName(obj))
+	return Unknown{What: "a field of a " + TypeName(obj)}
+}
+
+func (e *Evaluator) eval(x expr, s *scope) (value, error) {
+	switch x := x.(type) {
+	case nilExpr:
+		return nil, nil
+	case boolExpr:
+		return x.value, nil
+	case numberExpr:
+		return x.value, nil
+	case stringExpr:
+		return x.value, nil
+	case nameExpr:
+		if c := s.lookup(x.name); c != nil {
+			return c.v, nil
+		}
+		return e.globals.Get(x.name), nil
+	case indexExpr:
+		obj, err := e.eval(x.obj, s)
+		if err != nil {
+			return nil, err
+		}
+		key, err := e.eval(x.key, s)
+		if err != nil {
+			return nil, err
+		}
+		return e.index(x.line, obj, key), nil
+	case *functionExpr:
+		return &closure{fn: x, env: s, file: e.file}, nil
+	case tableExpr:
+		return e.table(x, s)
+	case parenExpr:
+		return e.eval(x.x, s)
+	case unopExpr:
+		v, err := e.eval(x.x, s)
+		if err != nil {
+			return nil, err
+		}
+		return e.unop(x, v), nil
+	case binopExpr:
+		return e.binop(x, s)
+	}
+	vs, err := e.multi(x, s)
+	return First(vs), err
+}
+
+func (e *Evaluator) table(x tableExpr, s *scope) (value, error) {
+	t := newTable(e.file, x.line)
+	n := 1
+	for i, item := range x.items {
+		if item.key == nil {
+			if i == len(x.items)-1 {
+				vs, err := e.multi(item.value, s)
+				if err != nil {
+					return nil, err
+				}
+				for _, v := range vs {
+					t.set(float64(n), v)
+					n++
+				}
+				continue
+			}
+			v, err := e.eval(item.value, s)
+			if err != nil {
+				return nil, err
+			}
+			t.set(float64(n), v)
+			n++
+			continue
+		}
+		k, err := e.eval(item.key, s)
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.eval(item.value, s)
+		if err != nil {
+			return nil, err
+		}
+		switch k.(type) {
+		case nil:
+			e.diag(item.line, "table key is nil")
+		case Unknown:
+			e.diag(item.line, "table key depends on %s; field ignored", Describe(k))
+		default:
+			t.set(k, v)
+		}
+	}
+	return t, nil
+}
+
+func (e *Evaluator) unop(x unopExpr, v value) value {
+	if u, ok := v.(Unknown); ok {
+		return u
+	}
+	switch x.op {
+	case "not":
+		t, _ := truth(v)
+		return !t
+	case "-":
+		if n, ok := toNumber(v); ok {
+			return -n
+		}
+	case "#":
+		switch v := v.(type) {
+		case string:
+			return float64(len(v))
+		case *Table:
+			return float64(v.Length())
+		}
+	case "~":
+		if n, ok := toInteger(v); ok {
+			return float64(^n)
+		}
+	}
+	e.diag(x.line, "invalid operand for %s: %s", x.op, TypeName(v))
+	return Unknown{What: "an invalid " + x.op + " operation"}
+}
+
+func (e *Evaluator) binop(x binopExpr, s *scope) (value, error) {
+	l, err := e.eval(x.l, s)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "and", "or":
+		t, ok := truth(l)
+		if !ok {
+			return l, nil
+		}
+		if t == (x.op == "or") {
+			return l, nil
+		}
+		return e.eval(x.r, s)
+	}
+	r, err := e.eval(x.r, s)
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := l.(Unknown); ok {
+		return u, nil
+	}
+	if u, ok := r.(Unknown); ok {
+		return u, nil
+	}
+
+	switch x.op {
+	case "==":
+		return equal(l, r), nil
+	case "~=":
+		return !equal(l, r), nil
+	case "..":
+		ls, lok := toStringValue(l)
+		rs, rok := toStringValue(r)
+		if lok && rok {
+			if err := checkLen(len(ls) + len(rs)); err != nil {
+				return nil, err
+			}
+			return ls + rs, nil
+		}
+	case "<", "<=", ">", ">=":
+		if c, ok := compare(l, r); ok {
+			switch x.op {
+			case "<":
+				return c < 0, nil
+			case "<=":
+				return c <= 0, nil
+			case ">":
+				return c > 0, nil
+			default:
+				return c >= 0, nil
+			}
+		}
+	case "+", "-", "*", "/", "//", "%", "^":
+		a, aok := toNumber(l)
+		b, bok := toNumber(r)
+		if aok && bok {
+			return arith(x.op, a, b), nil
+		}
+	case "&", "|", "~", "<<", ">>":
+		a, aok := toInteger(l)
+		b, bok := toInteger(r)
+		if aok && bok {
+			return bitwise(x.op, a, b), nil
+		}
+	}
+	e.diag(x.line, "invalid operands for %s: %s and %s", x.op, TypeName(l), TypeName(r))
+	return Unknown{What: "an invalid " + x.op + " operation"}, nil
+}
+
+func arith(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "//":
+		return math.Floor(a / b)
+	case "%":
+		return a - math.Floor(a/b)*b
+	}
+	return math.Pow(a, b)
+}
+
+func bitwise(op string, a, b int64) float64 {
+	switch op {
+	case "&":
+		return float64(a & b)
+	case "|":
+		return float64(a | b)
+	case "~":
+		return float64(a ^ b)
+	case "<<":
+		return float64(a << uint(b))
+	}
+	return float64(int64(uint64(a) >> uint(b)))
+}
+
+func equal(a, b value) bool {
+	return a == b
+}
+
+func compare(a, b value) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	}
+	return 0, false
+}
+
+func toNumber(v value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		s := strings.TrimSpace(v)
+		if hex, neg := hexDigits(s); hex != "" {
+			n, err := strconv.ParseUint(hex, 16, 64)
+			if neg {
+				return -float64(n), err == nil
+			}
+			return float64(n), err == nil
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// hexDigits returns the digits of a hexadecimal integer such as "0x1F"
+// or "-0x1f", and whether it is negative.
+func hexDigits(s string) (string, bool) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	if len(s) > 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		return s[2:], neg
+	}
+	return "", false
+}
+
+func toInteger(v value) (int64, bool) {
+	n, ok := toNumber(v)
+	if !ok || n != math.Trunc(n) {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+// FormatNumber renders a number the way Lua 5.4 prints integers and
+// floats.
+func FormatNumber(n float64) string {
+	if n == math.Trunc(n) && math.Abs(n) < 1e15 {
+		return strconv.FormatInt(int64(n), 10)
+	}
+	return strconv.FormatFloat(n, 'g', 14, 64)
+}
+
+func toStringValue(v value) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case float64:
+		return FormatNumber(v), true
+	}
+	return "", false
+}
+
+// TypeName returns the Lua type of v, as type() does.
+func TypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *Table, actionNamespace:
+		return "table"
+	case *closure, *builtin:
+		return "function"
+	case *Action:
+		return "action"
+	}
+	return "unknown"
+}
+
+// Describe explains a value in a diagnostic.
+func Describe(v any) string {
+	if u, ok := v.(Unknown); ok {
+		return u.What
+	}
+	return "a " + TypeName(v)
+}
+
+// exprName renders a dotted name expression for diagnostics.
+func exprName(x expr) string {
+	switch x := x.(type) {
+	case nameExpr:
+		return x.name
+	case indexExpr:
+		if k, ok := x.key.(stringExpr); ok {
+			return exprName(x.obj) + "." + k.value
+		}
+		return exprName(x.obj) + "[...]"
+	}
+	return "an expression"
+}
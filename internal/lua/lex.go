@@ -0,0 +1,318 @@
+package lua
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokKeyword
+	tokString
+	tokNumber
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string // the name, keyword, operator or decoded string
+	num  float64
+	line int
+	pos  int // byte offset of the token in the source
+}
+
+var keywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true,
+	"or": true, "repeat": true, "return": true, "then": true, "true": true,
+	"until": true, "while": true,
+}
+
+// puncts lists the Lua operators, longest first so that the lexer
+// prefers "..." over ".." over ".".
+var puncts = []string{
+	"...", "..", "::", "<<", ">>", "//", "==", "~=", "<=", ">=",
+	"+", "-", "*", "/", "%", "^", "#", "&", "~", "|", "<", ">", "=",
+	"(", ")", "{", "}", "[", "]", ";", ":", ",", ".",
+}
+
+// lexer splits Lua 5.4 source into tokens.
+type lexer struct {
+	src  string
+	pos  int
+	line int
+}
+
+func newLexer(src string) *lexer {
+	l := &lexer{src: src, line: 1}
+	if strings.HasPrefix(src, "#") {
+		// Skip a shebang line.
+		for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+			l.pos++
+		}
+	}
+	return l
+}
+
+func (l *lexer) errorf(line int, format string, args ...any) error {
+	return &SyntaxError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "--"):
+			l.pos += 2
+			if level, ok := l.longBracket(); ok {
+				if _, err := l.longString(level); err != nil {
+					return err
+				}
+				continue
+			}
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// longBracket reports whether a long bracket such as [[ or [==[ starts
+// at the current position, and its level.
+func (l *lexer) longBracket() (int, bool) {
+	if l.pos >= len(l.src) || l.src[l.pos] != '[' {
+		return 0, false
+	}
+	i := l.pos + 1
+	for i < len(l.src) && l.src[i] == '=' {
+		i++
+	}
+	if i < len(l.src) && l.src[i] == '[' {
+		return i - l.pos - 1, true
+	}
+	return 0, false
+}
+
+// longString reads a long string or comment whose opening bracket of
+// the given level starts at the current position.
+func (l *lexer) longString(level int) (string, error) {
+	line := l.line
+	l.pos += level + 2
+	if strings.HasPrefix(l.src[l.pos:], "\r\n") {
+		l.pos += 2
+		l.line++
+	} else if strings.HasPrefix(l.src[l.pos:], "\n") {
+		l.pos++
+		l.line++
+	}
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(l.src[l.pos:], closing)
+	if end < 0 {
+		return "", l.errorf(line, "unfinished long string")
+	}
+	s := l.src[l.pos : l.pos+end]
+	l.line += strings.Count(s, "\n")
+	l.pos += end + len(closing)
+	return s, nil
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line, pos: l.pos}, nil
+	}
+	start, line := l.pos, l.line
+	c := l.src[l.pos]
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	switch {
+	case c == '\'' || c == '"':
+		s, err := l.quoted(c)
+		return token{kind: tokString, text: s, line: line, pos: start}, err
+	case c == '[':
+		if level, ok := l.longBracket(); ok {
+			s, err := l.longString(level)
+			return token{kind: tokString, text: s, line: line, pos: start}, err
+		}
+	case c >= '0' && c <= '9' || c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1]):
+		return l.number()
+	case r == '_' || unicode.IsLetter(r):
+		for l.pos < len(l.src) {
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			l.pos += size
+		}
+		text := l.src[start:l.pos]
+		kind := tokName
+		if keywords[text] {
+			kind = tokKeyword
+		}
+		return token{kind: kind, text: text, line: line, pos: start}, nil
+	}
+	for _, p := range puncts {
+		if strings.HasPrefix(l.src[l.pos:], p) {
+			l.pos += len(p)
+			return token{kind: tokPunct, text: p, line: line, pos: start}, nil
+		}
+	}
+	return token{}, l.errorf(line, "unexpected character %q", r)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func (l *lexer) number() (token, error) {
+	start, line := l.pos, l.line
+	hex := strings.HasPrefix(l.src[l.pos:], "0x") || strings.HasPrefix(l.src[l.pos:], "0X")
+	if hex {
+		l.pos += 2
+	}
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case hex && isHexDigit(c), !hex && isDigit(c), c == '.':
+			l.pos++
+		case !hex && (c == 'e' || c == 'E'), hex && (c == 'p' || c == 'P'):
+			l.pos++
+			if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+				l.pos++
+			}
+		default:
+			goto done
+		}
+	}
+done:
+	text := l.src[start:l.pos]
+	var n float64
+	var err error
+	if hex && !strings.ContainsAny(text, ".pP") {
+		var u uint64
+		u, err = strconv.ParseUint(text[2:], 16, 64)
+		n = float64(int64(u))
+	} else {
+		n, err = strconv.ParseFloat(text, 64)
+	}
+	if err != nil {
+		return token{}, l.errorf(line, "malformed number %q", text)
+	}
+	return token{kind: tokNumber, text: text, num: n, line: line, pos: start}, nil
+}
+
+func (l *lexer) quoted(q byte) (string, error) {
+	line := l.line
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == q:
+			l.pos++
+			return b.String(), nil
+		case c == '\n':
+			return "", l.errorf(line, "unfinished string")
+		case c == '\\' && l.pos+1 < len(l.src):
+			l.pos++
+			if err := l.escape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return "", l.errorf(line, "unfinished string")
+}
+
+// escape decodes the escape sequence after a backslash.
+func (l *lexer) escape(b *strings.Builder) error {
+	e := l.src[l.pos]
+	l.pos++
+	switch e {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'a':
+		b.WriteByte('\a')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '\n':
+		b.WriteByte('\n')
+		l.line++
+	case 'z':
+		for l.pos < len(l.src) && strings.IndexByte(" \t\r\n\f\v", l.src[l.pos]) >= 0 {
+			if l.src[l.pos] == '\n' {
+				l.line++
+			}
+			l.pos++
+		}
+	case 'x':
+		if l.pos+2 <= len(l.src) {
+			if n, err := strconv.ParseUint(l.src[l.pos:l.pos+2], 16, 8); err == nil {
+				b.WriteByte(byte(n))
+				l.pos += 2
+				return nil
+			}
+		}
+		return l.errorf(l.line, "invalid hexadecimal escape")
+	case 'u':
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end > 1 && l.src[l.pos] == '{' {
+			if n, err := strconv.ParseUint(l.src[l.pos+1:l.pos+end], 16, 32); err == nil {
+				b.WriteRune(rune(n))
+				l.pos += end + 1
+				return nil
+			}
+		}
+		return l.errorf(l.line, "invalid unicode escape")
+	default:
+		if isDigit(e) {
+			// Up to three decimal digits.
+			end := l.pos
+			for end < len(l.src) && end < l.pos+2 && isDigit(l.src[end]) {
+				end++
+			}
+			n, _ := strconv.Atoi(l.src[l.pos-1 : end])
+			if n > 255 {
+				return l.errorf(l.line, "decimal escape too large")
+			}
+			b.WriteByte(byte(n))
+			l.pos = end
+			return nil
+		}
+		if e != '\\' && e != '"' && e != '\'' {
+			return l.errorf(l.line, "invalid escape sequence '\\%c'", e)
+		}
+		b.WriteByte(e)
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseChunk(t *testing.T) {
+	_, err := parseChunk("local t = {\n  a = 1,\n  b = = 2,\n}\n")
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		t.Fatalf("expected a *SyntaxError, got %v", err)
+	}
+	if se.Line != 3 {
+		t.Errorf("expected the error on line 3, got %d: %v", se.Line, se)
+	}
+
+	_, err = parseChunk("if x then\n  y()\n\nreturn 1\n")
+	if err == nil || !strings.Contains(err.Error(), `to close "if" at line 1`) {
+		t.Errorf("expected an unclosed if error, got %v", err)
+	}
+
+	src := "#!/usr/bin/env lua\nlocal s = [==[\nlong ]] string]==] --[[ block\ncomment ]] return s .. '\\x41\\u{42}\\67'\n"
+	if _, err := parseChunk(src); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestStringLimit(t *testing.T) {
+	for _, src := range []string{
+		"return string.rep('x', 1e12)",
+		"return ('ab'):rep(1e6, ',')",
+		"local s = 'x'\nfor i = 1, 64 do s = s .. s end\nreturn s",
+		"local t = {}\nfor i = 1, 2048 do t[i] = ('x'):rep(1024) end\nreturn table.concat(t)",
+	} {
+		_, err := NewEvaluator("").Run(context.Background(), "", src)
+		if _, ok := err.(*Error); !ok || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("%q: expected a string too large error, got %v", src, err)
+		}
+	}
+
+	ret, err := NewEvaluator("").Run(context.Background(), "", "return pcall(string.rep, 'x', 1e12)")
+	if err != nil || len(ret) != 2 || ret[0] != false {
+		t.Errorf("expected pcall to catch the error, got %v, %v", ret, err)
+	}
+	ret, err = NewEvaluator("").Run(context.Background(), "", "return #string.rep('ab', 3, ',')")
+	if err != nil || First(ret) != float64(8) {
+		t.Errorf("expected a short string to be built, got %v, %v", ret, err)
+	}
+}
+
+func TestRunCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewEvaluator("").Run(ctx, "", "while true do end")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the evaluation to stop with the context, got %v", err)
+	}
+}
+
+func TestEmptyLoopBudget(t *testing.T) {
+	for _, src := range []string{"while true do end", "repeat until false", "for i = 1, 1e18 do end"} {
+		if _, err := NewEvaluator("").Run(context.Background(), "", src); err != errBudget {
+			t.Errorf("%q: expected the step budget to stop the loop, got %v", src, err)
+		}
+	}
+}
+
+// eval runs src in a fresh evaluator and returns the first value it
+// returns.
+func eval(t *testing.T, src string) any {
+	t.Helper()
+	ret, err := NewEvaluator("").Run(context.Background(), "", src)
+	if err != nil {
+		t.Fatalf("%q: %v", src, err)
+	}
+	return First(ret)
+}
+
+func TestExpressions(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"return 1 + 2 * 3 - 4 / 2", float64(5)},
+		{"return 2 ^ 3 ^ 2", float64(512)},
+		{"return -2 ^ 2", float64(-4)},
+		{"return 7 // 2, 7 % 3", float64(3)},
+		{"return -7 % 3", float64(2)},
+		{"return 0x10 + 1e2 + .5", float64(116.5)},
+		{"return 5 & 3 | 8 ~ 1", float64(9)},
+		{"return 1 << 4 >> 2", float64(4)},
+		{"return ~0", float64(-1)},
+		{"return 'a' .. 1 .. 'b'", "a1b"},
+		{"return #'hello' + #{1, 2, 3}", float64(8)},
+		{"return 1 < 2 and 'b' > 'a' and 2 <= 2 and 3 >= 4", false},
+		{"return 1 == 1.0 and 'a' ~= 'b'", true},
+		{"return nil or false or 'x'", "x"},
+		{"return 1 and nil", nil},
+		{"return not nil", true},
+		{"return '10' + 5", float64(15)},
+		{"return ('x'):upper()", "X"},
+		{`return "tab\there" .. '\65' .. "\u{48}" .. [[
+long]]`, "tab\thereAHlong"},
+	}
+	for _, tt := range tests {
+		if got := eval(t, tt.src); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestControlFlow(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want any
+	}{
+		{"if", "local x = 2\nif x == 1 then return 'a' elseif x == 2 then return 'b' else return 'c' end", "b"},
+		{"while", "local i, n = 0, 0\nwhile i < 5 do i = i + 1; n = n + i end\nreturn n", float64(15)},
+		{"repeat", "local i = 0\nrepeat local j = i; i = i + 1 until j >= 3\nreturn i", float64(4)},
+		{"numeric for", "local n = 0\nfor i = 10, 1, -3 do n = n + i end\nreturn n", float64(22)},
+		{"break", "local n = 0\nfor i = 1, 10 do if i > 3 then break end n = i end\nreturn n", float64(3)},
+		{"ipairs", "local s = ''\nfor i, v in ipairs({'a', 'b', nil, 'c'}) do s = s .. i .. v end\nreturn s", "1a2b"},
+		{"pairs", "local n = 0\nfor k, v in pairs({a = 1, b = 2, 3}) do n = n + v end\nreturn n", float64(6)},
+		{"closure", "local function counter()\n  local n = 0\n  return function() n = n + 1; return n end\nend\nlocal c = counter()\nc(); c()\nreturn c()", float64(3)},
+		{"recursion", "local function fib(n) if n < 2 then return n end return fib(n - 1) + fib(n - 2) end\nreturn fib(10)", float64(55)},
+		{"varargs", "local function f(...) return select('#', ...), select(2, ...) end\nreturn f(1, 2, 3)", float64(3)},
+		{"multiple returns", "local function f() return 1, 2 end\nlocal t = {f(), f()}\nreturn #t", float64(3)},
+		{"method", "local obj = {n = 1}\nfunction obj:add(k) self.n = self.n + k; return self end\nreturn obj:add(2):add(3).n", float64(6)},
+		{"nested function name", "local m = {a = {}}\nfunction m.a.f() return 'ok' end\nreturn m.a.f()", "ok"},
+		{"shadowing", "local x = 1\ndo local x = 2 end\nreturn x", float64(1)},
+		{"goto forward", "local n = 1\ngoto skip\nn = 2\n::skip::\nreturn n", float64(1)},
+		{"goto continue", "local s = ''\nfor i = 1, 4 do\n  if i % 2 == 0 then goto continue end\n  s = s .. i\n  ::continue::\nend\nreturn s", "13"},
+		{"goto backward", "local i = 0\n::top::\ni = i + 1\nif i < 3 then goto top end\nreturn i", float64(3)},
+		{"goto out of nested blocks", "local n = 0\nwhile true do\n  while true do\n    n = n + 1\n    goto done\n  end\nend\n::done::\nreturn n", float64(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eval(t, tt.src); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGotoSkipsStatements(t *testing.T) {
+	e := NewEvaluator("")
+	ret, err := e.Run(context.Background(), "", "local config = {keys = {1, 2}}\ngoto skip\nconfig.keys = {}\n::skip::\nreturn config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := First(ret).(*Table).Get("keys").(*Table).Length(); n != 2 {
+		t.Errorf("expected the goto to skip the assignment, got %d keys", n)
+	}
+
+	_, err = e.Run(context.Background(), "", "goto nowhere")
+	if err == nil || !strings.Contains(err.Error(), "no visible label 'nowhere'") {
+		t.Errorf("expected a missing label error, got %v", err)
+	}
+	_, err = e.Run(context.Background(), "", "local function f() goto out end\nf()\n::out::")
+	if err == nil {
+		t.Error("expected a goto not to leave its function")
+	}
+}
+
+func TestStdlib(t *testing.T) {
+	tests := []struct {
+		src  string
+		want any
+	}{
+		{"return string.lower('AbC') .. string.upper('x') .. string.len('abc')", "abcX3"},
+		{"return string.sub('hello', 2, -2)", "ell"},
+		{"return ('hello'):sub(-3)", "llo"},
+		{"return string.byte('A') + #string.char(72, 105)", float64(67)},
+		{"return string.format('%s=%d %5.2f %x %q %%', 'a', 42, 3.14159, 255, 'hi')", `a=42  3.14 ff "hi" %`},
+		{"return string.find('a.b.c', '.', 3, true)", float64(4)},
+		{"return string.find('abc', 'z')", nil},
+		{"return string.rep('ab', 3, '-')", "ab-ab-ab"},
+		{"local t = {'a', 'b'}\ntable.insert(t, 'c')\ntable.insert(t, 1, 'z')\nreturn table.concat(t, ',')", "z,a,b,c"},
+		{"local t = {1, 2, 3}\nlocal x = table.remove(t, 1)\nreturn x + #t", float64(3)},
+		{"local t = {3, 1, 2}\ntable.sort(t)\nreturn table.concat(t)", "123"},
+		{"return select(2, table.unpack({1, 2, 3}))", float64(2)},
+		{"return math.floor(2.5) + math.ceil(2.5) + math.abs(-1) + math.max(1, 5, 3) + math.min(4, 2)", float64(13)},
+		{"return math.sqrt(16) + math.huge - math.huge == math.huge - math.huge", false},
+		{"return tostring(12) .. tostring(nil) .. tostring(true)", "12niltrue"},
+		{"return tonumber('0x1f') + tonumber('  2 ')", float64(33)},
+		{"return tonumber('abc')", nil},
+		{"return type({}) .. type('') .. type(1) .. type(nil) .. type(print or type)", "tablestringnumbernilfunction"},
+		{"return select('#', 1, nil, 3)", float64(3)},
+		{"return select(-1, 1, 2, 3)", float64(3)},
+		{"local ok, err = pcall(error, 'boom')\nreturn tostring(ok) .. err", "falseboom"},
+		{"local ok, v = pcall(function(x) return x * 2 end, 21)\nreturn v", float64(42)},
+		{"return pcall(assert, false, 'msg')", false},
+		{"local t = setmetatable({}, {})\nrawset(t, 'a', 1)\nreturn rawget(t, 'a') + rawlen({1, 2})", float64(3)},
+		{"local t = {a = 1}\nlocal k, v = next(t)\nreturn k .. v", "a1"},
+		{"return rawequal('a', 'a') and _G.string == string", true},
+		{"return _VERSION", "Lua 5.4"},
+	}
+	for _, tt := range tests {
+		if got := eval(t, tt.src); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.src, got, tt.want)
+		}
+	}
+
+	e := NewEvaluator("")
+	ret, err := e.Run(context.Background(), "", "local t = {3, 1, 2}\ntable.sort(t, function(a, b) return a > b end)\nreturn table.concat(t)")
+	if err != nil || First(ret) != "312" || len(e.Diagnostics()) != 1 {
+		t.Errorf("expected a sort with a comparator to be reported and skipped, got %v, %v, %v", ret, err, e.Diagnostics())
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	e := NewEvaluator("")
+	ret, err := e.Run(context.Background(), "config.lua", `local wezterm = require 'wezterm'
+local keys = {}
+if wezterm.target_triple == 'x86_64-apple-darwin' then
+  keys[1] = 'mac'
+else
+  keys[1] = 'other'
+end
+local n = os.getenv('N') + 1
+local s = string.match('abc', 'b')
+for i = 1, n do keys[#keys + 1] = i end
+return {keys = keys, n = n, s = s, home = wezterm.home_dir}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := First(ret).(*Table)
+	if got := root.Get("keys").(*Table).List(); len(got) != 1 || got[0] != "mac" {
+		t.Errorf("expected the first branch to be taken, got %v", got)
+	}
+	for _, name := range []string{"n", "s", "home"} {
+		if _, ok := root.Get(name).(Unknown); !ok {
+			t.Errorf("expected %s to be unknown, got %v", name, root.Get(name))
+		}
+	}
+	if got := Describe(root.Get("home")); got != "wezterm.home_dir" {
+		t.Errorf("unexpected description %q", got)
+	}
+
+	var lines []int
+	for _, d := range e.Diagnostics() {
+		if d.File != "config.lua" {
+			t.Errorf("diagnostic in file %q", d.File)
+		}
+		lines = append(lines, d.Line)
+	}
+	if !slices.Equal(lines, []int{3, 10}) {
+		t.Errorf("expected diagnostics on lines 3 and 10, got %v", e.Diagnostics())
+	}
+	if got := e.SourceLine(Pos{File: "config.lua", Line: 10}); got != "for i = 1, n do keys[#keys + 1] = i end" {
+		t.Errorf("unexpected source line %q", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"local = 1",
+		"x = ",
+		"f(",
+		"return 'unterminated",
+		"local t = {1, 2",
+		"for i = 1 do end",
+		"for a, b = 1, 2 do end",
+		"while true end",
+		"function (x) end",
+		"x = 1 +* 2",
+		"::label",
+		"goto",
+		"return [==[ never closed",
+		"x = 0x",
+		"--[[ unclosed comment",
+		`return "\q"`,
+	} {
+		if _, err := parseChunk(src); err == nil {
+			t.Errorf("%q: expected a syntax error", src)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%q: expected a *SyntaxError, got %T", src, err)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		t.Helper()
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("wezterm.lua", "local keys = require 'keys'\nlocal ui = require 'ui.theme'\nrequire 'loop'\nrequire 'missing'\nreturn {keys = keys, same = require('keys') == keys, theme = ui}")
+	write("keys.lua", "return {{key = 'a'}}")
+	write("ui/theme/init.lua", "return 'dark'")
+	write("loop.lua", "require 'loop'\nreturn true")
+
+	e := NewEvaluator(dir)
+	ret, err := e.RunFile(context.Background(), filepath.Join(dir, "wezterm.lua"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := First(ret).(*Table)
+	if root.Get("same") != true || root.Get("theme") != "dark" {
+		t.Errorf("unexpected modules: same %v, theme %v", root.Get("same"), root.Get("theme"))
+	}
+	if len(e.Files()) != 4 {
+		t.Errorf("expected 4 files to be evaluated, got %q", e.Files())
+	}
+	var reasons []string
+	for _, d := range e.Diagnostics() {
+		reasons = append(reasons, d.Reason)
+	}
+	want := []string{`module "loop" requires itself`, `module "missing" not found next to the config`}
+	if !slices.Equal(reasons, want) {
+		t.Errorf("got diagnostics %q, want %q", reasons, want)
+	}
+}
+
+func TestWezterm(t *testing.T) {
+	e := NewEvaluator("")
+	ret, err := e.Run(context.Background(), "wezterm.lua", `local wezterm = require 'wezterm'
+local act = wezterm.action
+wezterm.on('update-status', function(window, pane)
+  window:set_right_status('hi')
+end)
+local config = wezterm.config_builder()
+config.keys = {
+  { key = 'a', action = act.SpawnTab 'CurrentPaneDomain' },
+  { key = 'b', action = wezterm.action_callback(function() end) },
+  { key = 'c', action = act.ActivatePaneDirection('Left') },
+  { key = 'd', action = act.Nop },
+}
+return config
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := First(ret).(*Table).Get("keys").(*Table).List()
+	var got []string
+	for _, k := range keys {
+		a := k.(*Table).Get("action").(*Action)
+		got = append(got, fmt.Sprintf("%s %v %v", a.Name, a.Called, a.Args))
+	}
+	want := []string{"SpawnTab true [CurrentPaneDomain]", "EmitEvent true [user-defined-0]", "ActivatePaneDirection true [Left]", "Nop false []"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got actions %q, want %q", got, want)
+	}
+
+	hs := e.Handlers()
+	if len(hs) != 2 || hs[0].Event != "update-status" || hs[0].Line != 3 || hs[0].Body != "window:set_right_status('hi')" || hs[1].Event != "user-defined-0" {
+		t.Errorf("unexpected handlers %+v", hs)
+	}
+}
+
+func TestTable(t *testing.T) {
+	tbl := eval(t, "local t = {'a', 'b', x = 1, [10] = 'c'}\nt.y = 2\nt.x = nil\nreturn t").(*Table)
+	if got := tbl.Fields(); !slices.Equal(got, []string{"y"}) {
+		t.Errorf("Fields: got %q", got)
+	}
+	if got := tbl.Keys(); len(got) != 4 {
+		t.Errorf("Keys: got %v", got)
+	}
+	if tbl.Length() != 2 || !slices.Equal(tbl.List(), []any{"a", "b"}) {
+		t.Errorf("List: got %v", tbl.List())
+	}
+	if tbl.Get(float64(10)) != "c" || tbl.Get("x") != nil {
+		t.Errorf("Get: got %v, %v", tbl.Get(float64(10)), tbl.Get("x"))
+	}
+	if TypeName(tbl) != "table" || FormatNumber(3) != "3" || FormatNumber(0.5) != "0.5" {
+		t.Error("unexpected TypeName or FormatNumber")
+	}
+}
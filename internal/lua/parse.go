@@ -0,0 +1,787 @@
+package lua
+
+import "fmt"
+
+// SyntaxError is returned for Lua source that does not parse.
+type SyntaxError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.File != "" {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// chunkParser is a recursive-descent parser for Lua 5.4.
+type chunkParser struct {
+	lex  *lexer
+	tok  token
+	peek *token
+}
+
+// parseChunk parses a whole Lua file.
+func parseChunk(src string) ([]stmt, error) {
+	p := &chunkParser{lex: newLexer(src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.Describe())
+	}
+	return body, nil
+}
+
+func (p *chunkParser) advance() error {
+	if p.peek != nil {
+		p.tok, p.peek = *p.peek, nil
+		return nil
+	}
+	t, err := p.lex.next()
+	p.tok = t
+	return err
+}
+
+func (p *chunkParser) lookahead() (token, error) {
+	if p.peek == nil {
+		t, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek = &t
+	}
+	return *p.peek, nil
+}
+
+func (p *chunkParser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.tok.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *chunkParser) Describe() string {
+	switch p.tok.kind {
+	case tokEOF:
+		return "end of file"
+	case tokString:
+		return "string"
+	case tokNumber:
+		return "number " + p.tok.text
+	}
+	return fmt.Sprintf("%q", p.tok.text)
+}
+
+// is reports whether the current token is the given keyword or operator.
+func (p *chunkParser) is(text string) bool {
+	return (p.tok.kind == tokKeyword || p.tok.kind == tokPunct) && p.tok.text == text
+}
+
+func (p *chunkParser) accept(text string) (bool, error) {
+	if !p.is(text) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *chunkParser) expect(text string) error {
+	if !p.is(text) {
+		return p.errorf("expected %q near %s", text, p.Describe())
+	}
+	return p.advance()
+}
+
+// expectMatch expects the token closing a construct opened on line.
+func (p *chunkParser) expectMatch(text, opening string, line int) error {
+	if p.is(text) {
+		return p.advance()
+	}
+	if line == p.tok.line {
+		return p.expect(text)
+	}
+	return p.errorf("expected %q (to close %q at line %d) near %s", text, opening, line, p.Describe())
+}
+
+func (p *chunkParser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected name near %s", p.Describe())
+	}
+	name := p.tok.text
+	return name, p.advance()
+}
+
+// blockEnd reports whether the current token ends a block.
+func (p *chunkParser) blockEnd() bool {
+	return p.tok.kind == tokEOF || p.is("end") || p.is("else") || p.is("elseif") || p.is("until")
+}
+
+func (p *chunkParser) block() ([]stmt, error) {
+	var body []stmt
+	for !p.blockEnd() {
+		if p.is("return") {
+			s, err := p.returnStmt()
+			if err != nil {
+				return nil, err
+			}
+			return append(body, s), nil
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			body = append(body, s)
+		}
+	}
+	return body, nil
+}
+
+func (p *chunkParser) returnStmt() (stmt, error) {
+	line := p.tok.line
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	s := returnStmt{line: line}
+	if !p.blockEnd() && !p.is(";") {
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		s.exprs = exprs
+	}
+	if _, err := p.accept(";"); err != nil {
+		return nil, err
+	}
+	if !p.blockEnd() {
+		return nil, p.errorf("expected end of block after return near %s", p.Describe())
+	}
+	return s, nil
+}
+
+func (p *chunkParser) statement() (stmt, error) {
+	line := p.tok.line
+	switch {
+	case p.is(";"):
+		return nil, p.advance()
+	case p.is("::"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		return labelStmt{line: line, name: name}, p.expect("::")
+	case p.is("break"):
+		return breakStmt{line: line}, p.advance()
+	case p.is("goto"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		label, err := p.name()
+		return gotoStmt{line: line, label: label}, err
+	case p.is("do"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return doStmt{line: line, body: body}, p.expectMatch("end", "do", line)
+	case p.is("while"):
+		return p.whileStmt()
+	case p.is("repeat"):
+		return p.repeatStmt()
+	case p.is("if"):
+		return p.ifStmt()
+	case p.is("for"):
+		return p.forStmt()
+	case p.is("function"):
+		return p.functionStmt()
+	case p.is("local"):
+		return p.localStmt()
+	}
+	return p.exprStmt()
+}
+
+func (p *chunkParser) whileStmt() (stmt, error) {
+	line := p.tok.line
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return whileStmt{line: line, cond: cond, body: body}, p.expectMatch("end", "while", line)
+}
+
+func (p *chunkParser) repeatStmt() (stmt, error) {
+	line := p.tok.line
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectMatch("until", "repeat", line); err != nil {
+		return nil, err
+	}
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return repeatStmt{line: line, body: body, cond: cond}, nil
+}
+
+func (p *chunkParser) ifStmt() (stmt, error) {
+	s := ifStmt{line: p.tok.line}
+	for {
+		// The current token is "if" or "elseif".
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.conds = append(s.conds, cond)
+		s.blocks = append(s.blocks, body)
+		if !p.is("elseif") {
+			break
+		}
+	}
+	if ok, err := p.accept("else"); err != nil {
+		return nil, err
+	} else if ok {
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		s.els = append([]stmt{}, body...)
+	}
+	return s, p.expectMatch("end", "if", s.line)
+}
+
+func (p *chunkParser) forStmt() (stmt, error) {
+	line := p.tok.line
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	first, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, err := p.accept("="); err != nil {
+		return nil, err
+	} else if ok {
+		s := numForStmt{line: line, name: first}
+		if s.start, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		if s.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if ok, err := p.accept(","); err != nil {
+			return nil, err
+		} else if ok {
+			if s.step, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("do"); err != nil {
+			return nil, err
+		}
+		if s.body, err = p.block(); err != nil {
+			return nil, err
+		}
+		return s, p.expectMatch("end", "for", line)
+	}
+
+	s := genForStmt{line: line, names: []string{first}}
+	for p.is(",") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+	if s.exprs, err = p.exprList(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	if s.body, err = p.block(); err != nil {
+		return nil, err
+	}
+	return s, p.expectMatch("end", "for", line)
+}
+
+// functionStmt parses "function a.b.c:m() ... end" as an assignment.
+func (p *chunkParser) functionStmt() (stmt, error) {
+	line := p.tok.line
+	start := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	var target expr = nameExpr{line: line, name: name}
+	method := false
+	for p.is(".") || p.is(":") {
+		method = p.is(":")
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		field, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		target = indexExpr{line: line, obj: target, key: stringExpr{line: line, value: field}}
+		if method {
+			break
+		}
+	}
+	fn, err := p.functionBody(line, start, method)
+	if err != nil {
+		return nil, err
+	}
+	return assignStmt{line: line, targets: []expr{target}, exprs: []expr{fn}}, nil
+}
+
+func (p *chunkParser) localStmt() (stmt, error) {
+	line := p.tok.line
+	start := p.tok.pos
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.is("function") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fn, err := p.functionBody(line, start, false)
+		if err != nil {
+			return nil, err
+		}
+		return localFunctionStmt{line: line, name: name, fn: fn}, nil
+	}
+
+	s := localStmt{line: line}
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, name)
+		if p.is("<") {
+			// An attribute such as <const> or <close>.
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if _, err := p.name(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(">"); err != nil {
+				return nil, err
+			}
+		}
+		if !p.is(",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := p.accept("="); err != nil {
+		return nil, err
+	} else if ok {
+		exprs, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		s.exprs = exprs
+	}
+	return s, nil
+}
+
+// exprStmt parses an assignment or a function call statement.
+func (p *chunkParser) exprStmt() (stmt, error) {
+	line := p.tok.line
+	e, err := p.suffixedExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.is("=") && !p.is(",") {
+		switch e.(type) {
+		case callExpr, methodCallExpr:
+			return callStmt{line: line, call: e}, nil
+		}
+		return nil, p.errorf("syntax error near %s", p.Describe())
+	}
+
+	targets := []expr{e}
+	for p.is(",") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		t, err := p.suffixedExpr()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	for _, t := range targets {
+		switch t.(type) {
+		case nameExpr, indexExpr:
+		default:
+			return nil, &SyntaxError{Line: t.exprLine(), Msg: "cannot assign to this expression"}
+		}
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	exprs, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	return assignStmt{line: line, targets: targets, exprs: exprs}, nil
+}
+
+func (p *chunkParser) exprList() ([]expr, error) {
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	list := []expr{e}
+	for p.is(",") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+	}
+	return list, nil
+}
+
+// Binary operator priorities as in the reference implementation: left
+// and right binding power.
+var binaryPriority = map[string][2]int{
+	"or": {1, 1}, "and": {2, 2},
+	"<": {3, 3}, ">": {3, 3}, "<=": {3, 3}, ">=": {3, 3}, "~=": {3, 3}, "==": {3, 3},
+	"|": {4, 4}, "~": {5, 5}, "&": {6, 6}, "<<": {7, 7}, ">>": {7, 7},
+	"..": {9, 8},
+	"+":  {10, 10}, "-": {10, 10},
+	"*": {11, 11}, "/": {11, 11}, "//": {11, 11}, "%": {11, 11},
+	"^": {14, 13},
+}
+
+const unaryPriority = 12
+
+func (p *chunkParser) expr() (expr, error) {
+	return p.subExpr(0)
+}
+
+func (p *chunkParser) subExpr(limit int) (expr, error) {
+	var left expr
+	if p.is("not") || p.is("-") || p.is("#") || p.is("~") {
+		op, line := p.tok.text, p.tok.line
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.subExpr(unaryPriority)
+		if err != nil {
+			return nil, err
+		}
+		left = unopExpr{line: line, op: op, x: x}
+	} else {
+		var err error
+		if left, err = p.simpleExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	for p.tok.kind == tokPunct || p.tok.kind == tokKeyword {
+		prio, ok := binaryPriority[p.tok.text]
+		if !ok || prio[0] <= limit {
+			break
+		}
+		op, line := p.tok.text, p.tok.line
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		right, err := p.subExpr(prio[1])
+		if err != nil {
+			return nil, err
+		}
+		left = binopExpr{line: line, op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *chunkParser) simpleExpr() (expr, error) {
+	t := p.tok
+	switch {
+	case t.kind == tokNumber:
+		return numberExpr{line: t.line, value: t.num}, p.advance()
+	case t.kind == tokString:
+		return stringExpr{line: t.line, value: t.text}, p.advance()
+	case p.is("nil"):
+		return nilExpr{line: t.line}, p.advance()
+	case p.is("true"):
+		return boolExpr{line: t.line, value: true}, p.advance()
+	case p.is("false"):
+		return boolExpr{line: t.line, value: false}, p.advance()
+	case p.is("..."):
+		return varargExpr{line: t.line}, p.advance()
+	case p.is("{"):
+		return p.table()
+	case p.is("function"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		return p.functionBody(t.line, t.pos, false)
+	}
+	return p.suffixedExpr()
+}
+
+func (p *chunkParser) primaryExpr() (expr, error) {
+	line := p.tok.line
+	switch {
+	case p.tok.kind == tokName:
+		name := p.tok.text
+		return nameExpr{line: line, name: name}, p.advance()
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return parenExpr{line: line, x: x}, p.expectMatch(")", "(", line)
+	}
+	return nil, p.errorf("unexpected %s", p.Describe())
+}
+
+// suffixedExpr parses a primary expression followed by field accesses,
+// indexing, calls and method calls.
+func (p *chunkParser) suffixedExpr() (expr, error) {
+	e, err := p.primaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		line := p.tok.line
+		switch {
+		case p.is("."):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			e = indexExpr{line: line, obj: e, key: stringExpr{line: line, value: name}}
+		case p.is("["):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = indexExpr{line: line, obj: e, key: key}
+		case p.is(":"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = methodCallExpr{line: line, obj: e, name: name, args: args}
+		case p.is("(") || p.is("{") || p.tok.kind == tokString:
+			args, err := p.callArgs()
+			if err != nil {
+				return nil, err
+			}
+			e = callExpr{line: line, fn: e, args: args}
+		default:
+			return e, nil
+		}
+	}
+}
+
+// callArgs parses (args), a table constructor or a string literal.
+func (p *chunkParser) callArgs() ([]expr, error) {
+	line := p.tok.line
+	switch {
+	case p.tok.kind == tokString:
+		s := stringExpr{line: line, value: p.tok.text}
+		return []expr{s}, p.advance()
+	case p.is("{"):
+		t, err := p.table()
+		if err != nil {
+			return nil, err
+		}
+		return []expr{t}, nil
+	case p.is("("):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.is(")") {
+			return nil, p.advance()
+		}
+		args, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return args, p.expectMatch(")", "(", line)
+	}
+	return nil, p.errorf("function arguments expected near %s", p.Describe())
+}
+
+func (p *chunkParser) table() (expr, error) {
+	t := tableExpr{line: p.tok.line}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		item := tableItem{line: p.tok.line}
+		switch {
+		case p.is("["):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			key, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			item.key = key
+		case p.tok.kind == tokName:
+			next, err := p.lookahead()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind == tokPunct && next.text == "=" {
+				item.key = stringExpr{line: p.tok.line, value: p.tok.text}
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		item.value = value
+		t.items = append(t.items, item)
+		if !p.is(",") && !p.is(";") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	return t, p.expectMatch("}", "{", t.line)
+}
+
+// functionBody parses the parameter list and body of a function whose
+// "function" keyword was on line at byte offset start.
+func (p *chunkParser) functionBody(line, start int, method bool) (*functionExpr, error) {
+	fn := &functionExpr{line: line, start: start}
+	if method {
+		fn.params = []string{"self"}
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.is(")") {
+		if p.is("...") {
+			fn.vararg = true
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			break
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		fn.params = append(fn.params, name)
+		if !p.is(",") {
+			break
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	fn.bodyStart = p.tok.pos
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	fn.body = body
+	fn.endLine = p.tok.line
+	fn.end = p.tok.pos + len("end")
+	return fn, p.expectMatch("end", "function", line)
+}
@@ -0,0 +1,568 @@
+package lua
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Error is raised by error() and caught by pcall. A chunk that does not
+// catch it fails with it.
+type Error struct {
+	value value
+}
+
+func (e *Error) Error() string {
+	if s, ok := toStringValue(e.value); ok {
+		return s
+	}
+	return "error object is a " + TypeName(e.value) + " value"
+}
+
+type builtinFunc = func(e *Evaluator, line int, args []value) ([]value, error)
+
+func arg(args []value, i int) value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func one(v value) ([]value, error) {
+	return []value{v}, nil
+}
+
+// anyUnknown returns the first unknown argument.
+func anyUnknown(args []value) (Unknown, bool) {
+	for _, a := range args {
+		if u, ok := a.(Unknown); ok {
+			return u, true
+		}
+	}
+	return Unknown{}, false
+}
+
+// pure wraps a function of known arguments; any unknown argument makes
+// the result unknown.
+func pure(fn builtinFunc) builtinFunc {
+	return func(e *Evaluator, line int, args []value) ([]value, error) {
+		if u, ok := anyUnknown(args); ok {
+			return one(u)
+		}
+		return fn(e, line, args)
+	}
+}
+
+func module(name string, funcs map[string]builtinFunc) *Table {
+	t := newTable("", 0)
+	t.open = name
+	for _, k := range slices.Sorted(maps.Keys(funcs)) {
+		t.set(k, &builtin{name: name + "." + k, fn: funcs[k]})
+	}
+	return t
+}
+
+// installStdlib defines the parts of the Lua standard library configs
+// commonly use. os and io are left unknown: their results differ
+// between machines.
+func installStdlib(e *Evaluator) {
+	g := e.globals
+	set := func(name string, fn builtinFunc) {
+		g.set(name, &builtin{name: name, fn: fn})
+	}
+
+	set("require", func(e *Evaluator, line int, args []value) ([]value, error) {
+		name, ok := arg(args, 0).(string)
+		if !ok {
+			e.diag(line, "require of %s", Describe(arg(args, 0)))
+			return one(Unknown{What: "require"})
+		}
+		v, err := e.require(line, name)
+		return []value{v}, err
+	})
+	set("type", func(e *Evaluator, line int, args []value) ([]value, error) {
+		if u, ok := arg(args, 0).(Unknown); ok {
+			return one(u)
+		}
+		return one(TypeName(arg(args, 0)))
+	})
+	set("tostring", pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+		v := arg(args, 0)
+		if s, ok := toStringValue(v); ok {
+			return one(s)
+		}
+		switch v := v.(type) {
+		case nil:
+			return one("nil")
+		case bool:
+			return one(strconv.FormatBool(v))
+		}
+		return one(Unknown{What: "tostring of a " + TypeName(v)})
+	}))
+	set("tonumber", pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+		if n, ok := toNumber(arg(args, 0)); ok {
+			return one(n)
+		}
+		return one(nil)
+	}))
+	set("pairs", func(e *Evaluator, line int, args []value) ([]value, error) {
+		t, ok := arg(args, 0).(*Table)
+		if !ok {
+			return one(Unknown{What: "pairs over " + Describe(arg(args, 0))})
+		}
+		keys := slices.Clone(t.keys)
+		i := 0
+		next := &builtin{name: "next", fn: func(e *Evaluator, line int, args []value) ([]value, error) {
+			for i < len(keys) {
+				k := keys[i]
+				i++
+				if v := t.hash[k]; v != nil {
+					return []value{k, v}, nil
+				}
+			}
+			return one(nil)
+		}}
+		return []value{next, t, nil}, nil
+	})
+	set("ipairs", func(e *Evaluator, line int, args []value) ([]value, error) {
+		t, ok := arg(args, 0).(*Table)
+		if !ok {
+			return one(Unknown{What: "ipairs over " + Describe(arg(args, 0))})
+		}
+		next := &builtin{name: "ipairs iterator", fn: func(e *Evaluator, line int, args []value) ([]value, error) {
+			i, _ := arg(args, 1).(float64)
+			v := t.Get(i + 1)
+			if v == nil {
+				return one(nil)
+			}
+			return []value{i + 1, v}, nil
+		}}
+		return []value{next, t, float64(0)}, nil
+	})
+	set("next", func(e *Evaluator, line int, args []value) ([]value, error) {
+		t, ok := arg(args, 0).(*Table)
+		if !ok {
+			return one(Unknown{What: "next of " + Describe(arg(args, 0))})
+		}
+		i := 0
+		if k := arg(args, 1); k != nil {
+			i = slices.Index(t.keys, k) + 1
+		}
+		if i < len(t.keys) {
+			return []value{t.keys[i], t.hash[t.keys[i]]}, nil
+		}
+		return one(nil)
+	})
+	set("select", func(e *Evaluator, line int, args []value) ([]value, error) {
+		if arg(args, 0) == "#" {
+			return one(float64(len(args) - 1))
+		}
+		n, ok := toInteger(arg(args, 0))
+		if !ok {
+			return one(Unknown{What: "select"})
+		}
+		if n < 0 {
+			n += int64(len(args))
+		}
+		if n < 1 || int(n) >= len(args) {
+			return nil, nil
+		}
+		return args[n:], nil
+	})
+	set("pcall", func(e *Evaluator, line int, args []value) ([]value, error) {
+		rets, err := e.call(line, arg(args, 0), args[min(1, len(args)):])
+		if le, ok := err.(*Error); ok {
+			return []value{false, le.value}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append([]value{true}, rets...), nil
+	})
+	set("error", func(e *Evaluator, line int, args []value) ([]value, error) {
+		return nil, &Error{value: arg(args, 0)}
+	})
+	set("assert", func(e *Evaluator, line int, args []value) ([]value, error) {
+		if t, ok := truth(arg(args, 0)); ok && !t {
+			msg := arg(args, 1)
+			if msg == nil {
+				msg = "assertion failed!"
+			}
+			return nil, &Error{value: msg}
+		}
+		return args, nil
+	})
+	set("setmetatable", func(e *Evaluator, line int, args []value) ([]value, error) {
+		// Metatables are not modelled; the table is returned unchanged.
+		return one(arg(args, 0))
+	})
+	set("getmetatable", func(e *Evaluator, line int, args []value) ([]value, error) {
+		return one(nil)
+	})
+	set("rawget", func(e *Evaluator, line int, args []value) ([]value, error) {
+		if t, ok := arg(args, 0).(*Table); ok {
+			return one(t.Get(arg(args, 1)))
+		}
+		return one(Unknown{What: "rawget"})
+	})
+	set("rawset", func(e *Evaluator, line int, args []value) ([]value, error) {
+		if t, ok := arg(args, 0).(*Table); ok && arg(args, 1) != nil {
+			t.set(arg(args, 1), arg(args, 2))
+		}
+		return one(arg(args, 0))
+	})
+	set("rawequal", func(e *Evaluator, line int, args []value) ([]value, error) {
+		return one(equal(arg(args, 0), arg(args, 1)))
+	})
+	set("rawlen", pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+		if t, ok := arg(args, 0).(*Table); ok {
+			return one(float64(t.Length()))
+		}
+		if s, ok := arg(args, 0).(string); ok {
+			return one(float64(len(s)))
+		}
+		return one(Unknown{What: "rawlen"})
+	}))
+
+	e.strings = stringLib()
+	g.set("string", e.strings)
+	g.set("table", tableLib())
+	g.set("math", mathLib())
+	g.set("unpack", g.Get("table").(*Table).Get("unpack"))
+	for _, name := range []string{"os", "io", "debug", "package", "utf8", "coroutine"} {
+		t := newTable("", 0)
+		t.open = name
+		g.set(name, t)
+	}
+	g.set("_G", g)
+	g.set("_VERSION", "Lua 5.4")
+}
+
+func stringLib() *Table {
+	return module("string", map[string]builtinFunc{
+		"lower": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			return one(strings.ToLower(s))
+		}),
+		"upper": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			return one(strings.ToUpper(s))
+		}),
+		"len": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			return one(float64(len(s)))
+		}),
+		"rep": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			n, _ := toInteger(arg(args, 1))
+			sep, _ := toStringValue(arg(args, 2))
+			if n <= 0 {
+				return one("")
+			}
+			if n > maxString || len(s) > maxString || len(sep) > maxString {
+				return nil, checkLen(math.MaxInt)
+			}
+			if err := checkLen(int(n)*len(s) + int(n-1)*len(sep)); err != nil {
+				return nil, err
+			}
+			return one(strings.Repeat(s+sep, int(n)-1) + s)
+		}),
+		"sub": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			i, ok := toInteger(arg(args, 1))
+			if !ok {
+				i = 1
+			}
+			j, ok := toInteger(arg(args, 2))
+			if !ok {
+				j = -1
+			}
+			start, end := strIndex(i, len(s)), strIndex(j, len(s))
+			start = max(start, 1)
+			end = min(end, len(s))
+			if start > end {
+				return one("")
+			}
+			return one(s[start-1 : end])
+		}),
+		"byte": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			i, ok := toInteger(arg(args, 1))
+			if !ok {
+				i = 1
+			}
+			i = int64(strIndex(i, len(s)))
+			if i < 1 || int(i) > len(s) {
+				return nil, nil
+			}
+			return one(float64(s[i-1]))
+		}),
+		"char": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			var b strings.Builder
+			for _, a := range args {
+				n, _ := toInteger(a)
+				b.WriteByte(byte(n))
+			}
+			return one(b.String())
+		}),
+		"format": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			format, ok := toStringValue(arg(args, 0))
+			if !ok {
+				return one(Unknown{What: "string.format"})
+			}
+			return one(luaFormat(format, args[1:]))
+		}),
+		"find": pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			s, _ := toStringValue(arg(args, 0))
+			pattern, _ := toStringValue(arg(args, 1))
+			init, ok := toInteger(arg(args, 2))
+			if !ok {
+				init = 1
+			}
+			plain, _ := truth(arg(args, 3))
+			if !plain && strings.ContainsAny(pattern, "^$*+?.([%-") {
+				return one(Unknown{What: "a Lua pattern match"})
+			}
+			start := max(strIndex(init, len(s)), 1)
+			if start > len(s)+1 {
+				return one(nil)
+			}
+			i := strings.Index(s[start-1:], pattern)
+			if i < 0 {
+				return one(nil)
+			}
+			return []value{float64(start + i), float64(start + i + len(pattern) - 1)}, nil
+		}),
+		// Lua patterns are not implemented.
+		"match": func(e *Evaluator, line int, args []value) ([]value, error) {
+			return one(Unknown{What: "a Lua pattern match"})
+		},
+		"gmatch": func(e *Evaluator, line int, args []value) ([]value, error) {
+			return one(Unknown{What: "a Lua pattern match"})
+		},
+		"gsub": func(e *Evaluator, line int, args []value) ([]value, error) {
+			return one(Unknown{What: "a Lua pattern substitution"})
+		},
+	})
+}
+
+// strIndex converts a possibly negative Lua string index.
+func strIndex(i int64, n int) int {
+	if i < 0 {
+		return n + int(i) + 1
+	}
+	return int(i)
+}
+
+// luaFormat implements string.format for the common directives.
+func luaFormat(format string, args []value) value {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("-+ #0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			return Unknown{What: "string.format"}
+		}
+		spec, verb := format[i+1:j], format[j]
+		i = j
+		if verb == '%' {
+			b.WriteByte('%')
+			continue
+		}
+		a := arg(args, n)
+		n++
+		switch verb {
+		case 's':
+			s, ok := toStringValue(a)
+			if !ok {
+				switch a := a.(type) {
+				case nil:
+					s = "nil"
+				case bool:
+					s = strconv.FormatBool(a)
+				default:
+					return Unknown{What: "string.format of a " + TypeName(a)}
+				}
+			}
+			fmt.Fprintf(&b, "%"+spec+"s", s)
+		case 'q':
+			s, _ := toStringValue(a)
+			b.WriteString(strconv.Quote(s))
+		case 'd', 'i', 'x', 'X', 'o', 'c':
+			v, ok := toInteger(a)
+			if !ok {
+				return Unknown{What: "string.format"}
+			}
+			if verb == 'i' {
+				verb = 'd'
+			}
+			fmt.Fprintf(&b, "%"+spec+string(verb), v)
+		case 'f', 'F', 'g', 'G', 'e', 'E':
+			v, ok := toNumber(a)
+			if !ok {
+				return Unknown{What: "string.format"}
+			}
+			fmt.Fprintf(&b, "%"+spec+string(verb), v)
+		default:
+			return Unknown{What: "string.format"}
+		}
+	}
+	return b.String()
+}
+
+func tableLib() *Table {
+	return module("table", map[string]builtinFunc{
+		"insert": func(e *Evaluator, line int, args []value) ([]value, error) {
+			t, ok := arg(args, 0).(*Table)
+			if !ok {
+				if _, isUnknown := arg(args, 0).(Unknown); !isUnknown {
+					e.diag(line, "table.insert into %s", Describe(arg(args, 0)))
+				}
+				return nil, nil
+			}
+			n := t.Length()
+			switch len(args) {
+			case 2:
+				t.set(float64(n+1), args[1])
+			case 3:
+				pos, ok := toInteger(args[1])
+				if !ok || pos < 1 || int(pos) > n+1 {
+					e.diag(line, "table.insert position out of bounds")
+					return nil, nil
+				}
+				for i := n; i >= int(pos); i-- {
+					t.set(float64(i+1), t.Get(float64(i)))
+				}
+				t.set(float64(pos), args[2])
+			default:
+				e.diag(line, "wrong number of arguments to table.insert")
+			}
+			return nil, nil
+		},
+		"remove": func(e *Evaluator, line int, args []value) ([]value, error) {
+			t, ok := arg(args, 0).(*Table)
+			if !ok {
+				return one(Unknown{What: "table.remove"})
+			}
+			n := t.Length()
+			pos := int64(n)
+			if len(args) > 1 {
+				if pos, ok = toInteger(args[1]); !ok {
+					return one(Unknown{What: "table.remove"})
+				}
+			}
+			if n == 0 || pos < 1 || int(pos) > n {
+				return one(nil)
+			}
+			v := t.Get(float64(pos))
+			for i := int(pos); i < n; i++ {
+				t.set(float64(i), t.Get(float64(i+1)))
+			}
+			t.set(float64(n), nil)
+			return one(v)
+		},
+		"concat": func(e *Evaluator, line int, args []value) ([]value, error) {
+			t, ok := arg(args, 0).(*Table)
+			if !ok {
+				return one(Unknown{What: "table.concat"})
+			}
+			sep, _ := toStringValue(arg(args, 1))
+			var parts []string
+			n := 0
+			for _, v := range t.List() {
+				s, ok := toStringValue(v)
+				if !ok {
+					return one(Unknown{What: "table.concat of a " + TypeName(v)})
+				}
+				parts = append(parts, s)
+				n += len(s) + len(sep)
+				if err := checkLen(n); err != nil {
+					return nil, err
+				}
+			}
+			return one(strings.Join(parts, sep))
+		},
+		"unpack": func(e *Evaluator, line int, args []value) ([]value, error) {
+			t, ok := arg(args, 0).(*Table)
+			if !ok {
+				return one(Unknown{What: "table.unpack"})
+			}
+			return t.List(), nil
+		},
+		"sort": func(e *Evaluator, line int, args []value) ([]value, error) {
+			t, ok := arg(args, 0).(*Table)
+			if !ok {
+				return nil, nil
+			}
+			if arg(args, 1) != nil {
+				e.diag(line, "table.sort with a comparator is not evaluated")
+				return nil, nil
+			}
+			list := t.List()
+			slices.SortStableFunc(list, func(a, b value) int {
+				c, _ := compare(a, b)
+				return c
+			})
+			for i, v := range list {
+				t.set(float64(i+1), v)
+			}
+			return nil, nil
+		},
+	})
+}
+
+func mathLib() *Table {
+	unary := func(fn func(float64) float64) builtinFunc {
+		return pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			n, ok := toNumber(arg(args, 0))
+			if !ok {
+				return one(Unknown{What: "math of a " + TypeName(arg(args, 0))})
+			}
+			return one(fn(n))
+		})
+	}
+	fold := func(fn func(a, b float64) float64) builtinFunc {
+		return pure(func(e *Evaluator, line int, args []value) ([]value, error) {
+			var acc float64
+			for i, a := range args {
+				n, ok := toNumber(a)
+				if !ok {
+					return one(Unknown{What: "math of a " + TypeName(a)})
+				}
+				if i == 0 {
+					acc = n
+				} else {
+					acc = fn(acc, n)
+				}
+			}
+			return one(acc)
+		})
+	}
+	t := module("math", map[string]builtinFunc{
+		"floor": unary(math.Floor),
+		"ceil":  unary(math.Ceil),
+		"abs":   unary(math.Abs),
+		"sqrt":  unary(math.Sqrt),
+		"max":   fold(math.Max),
+		"min":   fold(math.Min),
+		"random": func(e *Evaluator, line int, args []value) ([]value, error) {
+			return one(Unknown{What: "math.random"})
+		},
+	})
+	t.set("huge", math.Inf(1))
+	t.set("pi", math.Pi)
+	t.set("maxinteger", float64(math.MaxInt64))
+	t.set("mininteger", float64(math.MinInt64))
+	return t
+}
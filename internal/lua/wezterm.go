@@ -0,0 +1,74 @@
+package lua
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Handler is a function registered with wezterm.on or passed to
+// wezterm.action_callback, whose event is named "user-defined-N".
+type Handler struct {
+	Event string
+	// Pos is where the function is defined, or where it was registered
+	// if its definition is not known.
+	Pos
+	// Body is the source text of the function's body, empty if unknown.
+	Body string
+}
+
+// weztermModule returns the table require "wezterm" evaluates to. Only
+// the parts that shape key assignments are modelled; everything else is
+// unknown.
+func (e *Evaluator) weztermModule() *Table {
+	w := newTable("", 0)
+	w.open = "wezterm"
+	w.set("action", actionNamespace{})
+	w.set("config_dir", e.dir)
+	w.set("GLOBAL", newTable("", 0))
+	w.set("action_callback", &builtin{name: "wezterm.action_callback", fn: actionCallback})
+	w.set("on", &builtin{name: "wezterm.on", fn: on})
+	w.set("config_builder", &builtin{name: "wezterm.config_builder", fn: func(e *Evaluator, line int, args []value) ([]value, error) {
+		return []value{newTable(e.file, line)}, nil
+	}})
+	noop := &builtin{name: "wezterm.log", fn: func(e *Evaluator, line int, args []value) ([]value, error) {
+		return nil, nil
+	}}
+	for _, name := range []string{"log_info", "log_warn", "log_error"} {
+		w.set(name, noop)
+	}
+	return w
+}
+
+// actionCallback models wezterm.action_callback, which registers the
+// function as a handler for a generated event and returns an EmitEvent
+// action for it.
+func actionCallback(e *Evaluator, line int, args []value) ([]value, error) {
+	name := "user-defined-" + strconv.Itoa(e.callbacks)
+	e.callbacks++
+	e.handler(line, name, arg(args, 0))
+	return []value{&Action{Name: "EmitEvent", Called: true, Args: []value{name}, Pos: Pos{File: e.file, Line: line}}}, nil
+}
+
+// on models wezterm.on, recording the handler for the event.
+func on(e *Evaluator, line int, args []value) ([]value, error) {
+	event, ok := arg(args, 0).(string)
+	if !ok {
+		e.diag(line, "event name depends on %s; handler ignored", Describe(arg(args, 0)))
+		return nil, nil
+	}
+	e.handler(line, event, arg(args, 1))
+	return nil, nil
+}
+
+// handler records fn as a handler of event, registered on line.
+func (e *Evaluator) handler(line int, event string, fn value) {
+	h := Handler{Event: event, Pos: Pos{File: e.file, Line: line}}
+	if c, ok := fn.(*closure); ok {
+		h.Pos = Pos{File: c.file, Line: c.fn.line}
+		src := e.sources[c.file]
+		if end := c.fn.end - len("end"); c.fn.bodyStart <= end && end <= len(src) {
+			h.Body = strings.TrimSpace(src[c.fn.bodyStart:end])
+		}
+	}
+	e.handlers = append(e.handlers, h)
+}
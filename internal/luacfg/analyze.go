@@ -0,0 +1,67 @@
+// Package luacfg derives a keymap from a wezterm Lua config without
+// running wezterm. It evaluates the config with package lua and reads
+// config.keys, config.key_tables and config.mouse_bindings from the
+// result the same way parser.ParseLua reads show-keys --lua output.
+// Constructs whose value cannot be derived are reported as diagnostics.
+package luacfg
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/sorafujitani/wez-kv/internal/lua"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Config is the keymap-related part of an analyzed config.
+type Config struct {
+	// Result holds the bindings the config defines itself, without
+	// wezterm's defaults, and the diagnostics of the analysis.
+	Result parser.ParseResult
+	// Files lists the config and the modules it required.
+	Files []string
+	// Locations tells where each binding of Result is defined.
+	Locations Locations
+	// Handlers lists the event handlers and action callbacks.
+	Handlers Handlers
+	// DisableDefaultKeys and DisableDefaultMouse mirror
+	// disable_default_key_bindings and disable_default_mouse_bindings.
+	DisableDefaultKeys  bool
+	DisableDefaultMouse bool
+}
+
+// Analyze evaluates the config at path and extracts its bindings. It
+// fails only if the config cannot be read or parsed, or does not return
+// a table, or ctx is cancelled; everything else is reported through
+// diagnostics.
+func Analyze(ctx context.Context, path string) (*Config, error) {
+	e := lua.NewEvaluator(filepath.Dir(path))
+	ret, err := e.RunFile(ctx, path)
+	if le, ok := err.(*lua.Error); ok {
+		return nil, fmt.Errorf("%s: config raised an error: %v", path, le)
+	}
+	if err != nil {
+		return nil, err
+	}
+	root, ok := lua.First(ret).(*lua.Table)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected the config to return a table, got %s", path, lua.Describe(lua.First(ret)))
+	}
+
+	conv := parser.ConvertLua(e, root)
+	cfg := &Config{
+		Result:              conv.Result,
+		Files:               e.Files(),
+		Locations:           Locations{},
+		DisableDefaultKeys:  conv.DisableDefaultKeys,
+		DisableDefaultMouse: conv.DisableDefaultMouse,
+	}
+	for i, b := range conv.Result.Bindings {
+		cfg.Locations[chordID(b)] = Location(conv.Defined[i])
+	}
+	for _, h := range e.Handlers() {
+		cfg.Handlers = append(cfg.Handlers, Handler{Event: h.Event, Location: Location(h.Pos), Body: h.Body})
+	}
+	return cfg, nil
+}
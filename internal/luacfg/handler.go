@@ -0,0 +1,52 @@
+package luacfg
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Handler is Lua code that runs for an event: a function registered with
+// wezterm.on, or one passed to wezterm.action_callback. wezterm names the
+// event of a callback "user-defined-N", numbering callbacks from 0 in the
+// order they are created.
+type Handler struct {
+	Event string
+	// Location is where the function is defined, or where it was
+	// registered if its definition is not known.
+	Location
+	// Body is the source text of the function's body, empty if unknown.
+	Body string
+}
+
+// Preview returns the body on a single line, shortened to at most n
+// runes.
+func (h Handler) Preview(n int) string {
+	s := h.OneLine()
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	if n < 1 {
+		return ""
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// OneLine returns the body on a single line, with every run of white
+// space collapsed into one space.
+func (h Handler) OneLine() string {
+	return strings.Join(strings.Fields(h.Body), " ")
+}
+
+// Handlers lists the handlers of a config in declaration order.
+type Handlers []Handler
+
+// For returns the handlers of event. wezterm runs all of them.
+func (hs Handlers) For(event string) []Handler {
+	var found []Handler
+	for _, h := range hs {
+		if h.Event == event {
+			found = append(found, h)
+		}
+	}
+	return found
+}
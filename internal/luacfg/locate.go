@@ -0,0 +1,42 @@
+package luacfg
+
+import (
+	"fmt"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Location is where a binding is defined in the config.
+type Location struct {
+	File string
+	// Line is the 1-based line of the binding's table constructor.
+	Line int
+}
+
+func (l Location) String() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// Locations maps bindings to where the config defines them, by table
+// and chord. When the config binds a chord twice, the later definition
+// wins, as it does in wezterm.
+type Locations map[string]Location
+
+// Lookup returns where b is defined. Bindings of wezterm's output are
+// matched too, so b need not come from the analysis.
+func (l Locations) Lookup(b parser.Keybinding) (Location, bool) {
+	if loc, ok := l[chordID(b)]; ok {
+		return loc, true
+	}
+	if parser.IsMouseTable(b.Table) {
+		// The Mouse section a binding lands in depends on options the
+		// analysis may not see; fall back to the chord alone.
+		for _, table := range []string{"Mouse", "Mouse: alt_screen", "Mouse: mouse_reporting", "Mouse: alt_screen, mouse_reporting"} {
+			b.Table = table
+			if loc, ok := l[chordID(b)]; ok {
+				return loc, true
+			}
+		}
+	}
+	return Location{}, false
+}
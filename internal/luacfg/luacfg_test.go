@@ -0,0 +1,442 @@
+package luacfg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+const testConfig = "testdata/config/wezterm.lua"
+
+// analyzeString analyzes src written to a temporary wezterm.lua.
+func analyzeString(t *testing.T, src string) *Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wezterm.lua")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Analyze(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	return cfg
+}
+
+// actions renders the bindings of a table as "chord -> action" lines.
+func actions(bindings []parser.Keybinding, table string) []string {
+	var lines []string
+	for _, b := range bindings {
+		if b.Table == table {
+			lines = append(lines, b.Chord().String()+" -> "+b.Action)
+		}
+	}
+	return lines
+}
+
+func TestEval(t *testing.T) {
+	cfg := analyzeString(t, `
+local wezterm = require 'wezterm'
+local act = wezterm.action
+
+local function counter()
+  local n = 0
+  return function() n = n + 1; return n end
+end
+local next_tab = counter()
+next_tab()
+
+local keys = {}
+local function bind(mods, key, action)
+  keys[#keys + 1] = { mods = mods, key = key, action = action }
+end
+
+bind('CTRL', string.format('%d', next_tab()), act.ActivateTab(next_tab() - 1))
+bind('ALT', ('x'):upper(), act.SendString(table.concat({ 'a', 'b' }, '-')))
+for i, name in ipairs { 'Left', 'Right' } do
+  if i % 2 == 0 then
+    bind('SUPER', name .. 'Arrow', act.ActivatePaneDirection(name))
+  end
+end
+local ok = pcall(function() error('boom') end)
+if not ok then
+  bind('CTRL', 'F1', act { SendString = 'old style' })
+end
+local i = 0
+while true do
+  i = i + 1
+  if i > 2 then break end
+end
+bind('CTRL', 'F' .. i, act.Nop)
+
+return { keys = keys }
+`)
+	want := []string{
+		"CTRL+2 -> ActivateTab(2)",
+		`ALT+X -> SendString("a-b")`,
+		"SUPER+RightArrow -> ActivatePaneDirection(Right)",
+		`CTRL+F1 -> SendString("old style")`,
+		"CTRL+F3 -> Nop",
+	}
+	got := actions(cfg.Result.Bindings, "Default")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("bindings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(cfg.Result.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", cfg.Result.Diagnostics)
+	}
+}
+
+func TestEvalBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wezterm.lua")
+	os.WriteFile(path, []byte("local n = 0\nwhile true do n = n + 1 end\nreturn {}\n"), 0o644)
+	if _, err := Analyze(context.Background(), path); err == nil || !strings.Contains(err.Error(), "budget") {
+		t.Errorf("expected the step budget to stop an endless loop, got %v", err)
+	}
+}
+
+func TestStaticCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wezterm.lua")
+	os.WriteFile(path, []byte("while true do end\nreturn {}\n"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (Static{Path: path}).Load(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Load to stop with the context, got %v", err)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	cfg, err := Analyze(context.Background(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := cfg.Result
+
+	if result.Leader == nil || result.Leader.Chord.String() != "CTRL+a" || result.Leader.Timeout.Milliseconds() != 2000 {
+		t.Errorf("unexpected leader %+v", result.Leader)
+	}
+	wantTables := "Default,resize_pane,Mouse,Mouse: alt_screen"
+	if got := strings.Join(result.Tables, ","); got != wantTables {
+		t.Errorf("Tables = %s, want %s", got, wantTables)
+	}
+
+	want := []string{
+		`LEADER+r -> ActivateKeyTable { name: "resize_pane", one_shot: false }`,
+		"ALT+Enter -> DisableDefaultAssignment",
+		"SHIFT+CTRL+C -> CopyTo(Clipboard)",
+		`SHIFT+CTRL+V -> Multiple([PasteFrom(Clipboard), SendString("x")])`,
+		`SHIFT+CTRL+P -> EmitEvent("open-picker")`,
+		"LEADER+h -> ActivatePaneDirection(Left)",
+		"LEADER+j -> ActivatePaneDirection(Down)",
+		"LEADER+k -> ActivatePaneDirection(Up)",
+		"LEADER+l -> ActivatePaneDirection(Right)",
+		"ALT+1 -> ActivateTab(0)",
+		"ALT+2 -> ActivateTab(1)",
+		"ALT+3 -> ActivateTab(2)",
+		"CTRL+w -> CloseCurrentTab { confirm: false }",
+		`SHIFT+CTRL+E -> EmitEvent("user-defined-0")`,
+	}
+	got := actions(result.Bindings, "Default")
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Default bindings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := actions(result.Bindings, "resize_pane"); len(got) != 3 || got[1] != "Escape -> PopKeyTable" || got[2] != got[1] {
+		t.Errorf("unexpected resize_pane bindings %q", got)
+	}
+	for _, b := range result.Bindings {
+		if b.Key.Name == "e" && b.RawModifiers != "CTRL|SHIFT" {
+			t.Errorf("expected the modifiers as written, got %q", b.RawModifiers)
+		}
+	}
+
+	var mouse *parser.Keybinding
+	for i, b := range result.Bindings {
+		if b.Table == "Mouse: alt_screen" {
+			mouse = &result.Bindings[i]
+		}
+	}
+	if mouse == nil || mouse.Mouse == nil || mouse.Mouse.Button != "WheelUp(1)" || !mouse.Mouse.Context.AltScreen {
+		t.Errorf("unexpected alt_screen mouse binding %+v", mouse)
+	}
+
+	wantDiags := []string{
+		"wezterm.lua:20: condition depends on wezterm.target_triple",
+		"wezterm.lua:28: action is the result of os.getenv",
+	}
+	if len(result.Diagnostics) != len(wantDiags) {
+		t.Fatalf("expected %d diagnostics, got %v", len(wantDiags), result.Diagnostics)
+	}
+	for i, d := range result.Diagnostics {
+		if !strings.Contains(d.String(), wantDiags[i]) {
+			t.Errorf("diagnostic %d = %q, want it to contain %q", i, d, wantDiags[i])
+		}
+	}
+
+	if len(cfg.Files) != 3 || filepath.Base(cfg.Files[2]) != "mouse.lua" {
+		t.Errorf("unexpected files %v", cfg.Files)
+	}
+}
+
+// The static analysis of show-keys --lua output must agree with the
+// parser that reads it.
+func TestAnalyzeMatchesParser(t *testing.T) {
+	path := "../parser/testdata/crosscheck.lua"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := parser.Parse(string(data))
+	cfg, err := Analyze(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzed := cfg.Result
+
+	if len(analyzed.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", analyzed.Diagnostics)
+	}
+	if len(analyzed.Bindings) != len(parsed.Bindings) {
+		t.Fatalf("binding count: parsed %d, analyzed %d", len(parsed.Bindings), len(analyzed.Bindings))
+	}
+	for i, pb := range parsed.Bindings {
+		ab := analyzed.Bindings[i]
+		name := fmt.Sprintf("binding[%d]", i)
+		if ab.Table != pb.Table && !(parser.IsMouseTable(ab.Table) && parser.IsMouseTable(pb.Table)) {
+			t.Errorf("%s Table = %q, want %q", name, ab.Table, pb.Table)
+		}
+		if ab.Chord().String() != pb.Chord().String() {
+			t.Errorf("%s Chord = %q, want %q", name, ab.Chord(), pb.Chord())
+		}
+		if ab.Action != pb.Action {
+			t.Errorf("%s Action = %q, want %q", name, ab.Action, pb.Action)
+		}
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"syntax.lua": "return {\n  keys = {\n}\n",
+		"error.lua":  "error('no config here')\n",
+		"number.lua": "return 42\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(src), 0o644)
+		if _, err := Analyze(context.Background(), path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Analyze(context.Background(), filepath.Join(dir, "missing.lua")); !os.IsNotExist(err) {
+		t.Errorf("expected a not-exist error, got %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base, err := defaults.Keymap("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := analyzeString(t, `
+local act = require('wezterm').action
+return {
+  keys = {
+    { key = 'Enter', mods = 'ALT', action = act.DisableDefaultAssignment },
+    { key = 'Tab', mods = 'CTRL', action = act.ActivateTabRelative(2) },
+    { key = 'F12', action = act.ShowDebugOverlay },
+  },
+  key_tables = {
+    copy_mode = { { key = 'Escape', action = act.CopyMode 'Close' } },
+  },
+  disable_default_mouse_bindings = true,
+}
+`)
+	merged := Merge(base, cfg)
+
+	defaultChords := make(map[string]string)
+	for _, b := range merged.Bindings {
+		if b.Table == "Default" {
+			defaultChords[b.Chord().String()] = b.Action
+		}
+		if parser.IsMouseTable(b.Table) {
+			t.Errorf("expected no mouse bindings, got %s", b.Chord())
+		}
+	}
+	if a, ok := defaultChords["ALT+Enter"]; ok {
+		t.Errorf("ALT+Enter should be removed, is %s", a)
+	}
+	if a := defaultChords["CTRL+Tab"]; a != "ActivateTabRelative(2)" {
+		t.Errorf("CTRL+Tab = %q, want the override", a)
+	}
+	if a := defaultChords["F12"]; a != "ShowDebugOverlay" {
+		t.Errorf("F12 = %q, want the added binding", a)
+	}
+	if got := actions(merged.Bindings, "copy_mode"); len(got) != 1 {
+		t.Errorf("copy_mode should be replaced, got %d bindings", len(got))
+	}
+	if got := actions(merged.Bindings, "search_mode"); len(got) == 0 {
+		t.Error("search_mode should keep its defaults")
+	}
+	if strings.Join(merged.Tables, ",") != "Default,copy_mode,search_mode" {
+		t.Errorf("unexpected tables %v", merged.Tables)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	s := Static{Path: testConfig}
+	if got := s.String(); got != "statically derived from "+testConfig {
+		t.Errorf("String() = %q", got)
+	}
+	if got := len(s.Files()); got != 3 {
+		t.Errorf("expected the config and 2 modules, got %v", s.Files())
+	}
+	result, err := s.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diagnostics) != 2 {
+		t.Errorf("expected the analysis diagnostics, got %v", result.Diagnostics)
+	}
+	if got := actions(result.Bindings, "resize_pane"); len(got) != 3 {
+		t.Errorf("expected resize_pane from the config, got %q", got)
+	}
+}
+
+func TestLocate(t *testing.T) {
+	cfg, err := Analyze(context.Background(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations := cfg.Locations
+	tests := []struct {
+		table, mods, key string
+		want             string
+	}{
+		{"Default", "LEADER", "r", "keys.lua:8"},
+		{"Default", "ALT", "2", "wezterm.lua:17"},
+		{"Default", "SHIFT|CTRL", "e", "wezterm.lua:24"},
+		{"resize_pane", "NONE", "Escape", "wezterm.lua:34"},
+		// wezterm may file a mouse binding under another Mouse section.
+		{"Mouse: mouse_reporting", "CTRL", "Up { streak: 1, button: Left }", "mouse.lua:4"},
+	}
+	for _, tt := range tests {
+		mods, _ := parser.ParseModifiers(tt.mods)
+		b := parser.NewKeybinding(tt.table, mods, parser.ParseKey(tt.key), "Nop")
+		loc, ok := locations.Lookup(b)
+		if !ok {
+			t.Errorf("%s %s %s: no location", tt.table, tt.mods, tt.key)
+			continue
+		}
+		if got := filepath.Base(loc.File) + ":" + fmt.Sprint(loc.Line); got != tt.want {
+			t.Errorf("%s %s %s: got %s, want %s", tt.table, tt.mods, tt.key, got, tt.want)
+		}
+	}
+
+	b := parser.NewKeybinding("Default", parser.ModCtrl, parser.ParseKey("z"), "Nop")
+	if loc, ok := locations.Lookup(b); ok {
+		t.Errorf("expected no location for an unbound chord, got %s", loc)
+	}
+}
+
+func TestAnalyzeKeyMapPreference(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wezterm.lua")
+	os.WriteFile(path, []byte(`local act = require('wezterm').action
+return {
+  key_map_preference = 'Physical',
+  keys = {
+    { key = 'a', mods = 'CTRL', action = act.Nop },
+    { key = '1', mods = 'ALT', action = act.Nop },
+    { key = 'mapped:b', mods = 'CTRL', action = act.Nop },
+    { key = 'Tab', mods = 'CTRL', action = act.Nop },
+    { key = 'mapped:1', mods = 'ALT', action = act.ActivateTab(0) },
+  },
+}
+`), 0o644)
+	cfg, err := Analyze(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, b := range cfg.Result.Bindings {
+		got = append(got, b.Chord().String())
+	}
+	want := []string{"CTRL+phys:A", "ALT+phys:K1", "CTRL+mapped:b", "CTRL+Tab", "ALT+mapped:1"}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The physical digit key is the one mapped:1 types, and wins over it.
+	shadows := analysis.Equivalents(cfg.Result.Bindings)
+	if len(shadows) != 1 || shadows[0].Winner != 1 || !slices.Equal(shadows[0].Shadowed(), []int{4}) {
+		t.Errorf("expected ALT+phys:K1 to shadow ALT+mapped:1, got %v", shadows)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	cfg, err := Analyze(context.Background(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		event, want, body string
+	}{
+		{"user-defined-0", "wezterm.lua:24", "window:toast_notification('wezterm', 'hello', nil, 4000)"},
+		{"open-picker", "wezterm.lua:40", "window:perform_action(act.ShowLauncherArgs { flags = 'FUZZY|WORKSPACES' }, pane)"},
+	}
+	for _, tt := range tests {
+		hs := cfg.Handlers.For(tt.event)
+		if len(hs) != 1 {
+			t.Errorf("%s: expected one handler, got %v", tt.event, hs)
+			continue
+		}
+		if got := filepath.Base(hs[0].File) + ":" + fmt.Sprint(hs[0].Line); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.event, got, tt.want)
+		}
+		if hs[0].Body != tt.body {
+			t.Errorf("%s: got body %q, want %q", tt.event, hs[0].Body, tt.body)
+		}
+	}
+	if hs := cfg.Handlers.For("update-status"); hs != nil {
+		t.Errorf("expected no handlers, got %v", hs)
+	}
+
+	// Callbacks are numbered in the order they are created, and a
+	// function value defined elsewhere still has a known body.
+	src := `local wezterm = require 'wezterm'
+local function greet(window, pane)
+  window:toast_notification('wezterm', 'hi')
+end
+wezterm.on('gui-startup', greet)
+wezterm.on('gui-startup', function() end)
+return { keys = {
+  { key = 'a', mods = 'CTRL', action = wezterm.action_callback(greet) },
+  { key = 'b', mods = 'CTRL', action = wezterm.action_callback(wezterm.GLOBAL.f) },
+} }
+`
+	path := filepath.Join(t.TempDir(), "wezterm.lua")
+	os.WriteFile(path, []byte(src), 0o644)
+	cfg, err = Analyze(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, h := range cfg.Handlers {
+		got = append(got, fmt.Sprintf("%s@%d:%s", h.Event, h.Line, h.Preview(20)))
+	}
+	want := []string{
+		"gui-startup@2:window:toast_notifi…",
+		"gui-startup@6:",
+		"user-defined-0@2:window:toast_notifi…",
+		"user-defined-1@9:",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got handlers %q, want %q", got, want)
+	}
+}
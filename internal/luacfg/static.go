@@ -0,0 +1,97 @@
+package luacfg
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// Static is a source that derives the keymap from a Lua config by
+// analysis alone, layering it over the bundled defaults the way wezterm
+// does.
+type Static struct {
+	Path string
+}
+
+func (s Static) String() string {
+	return "statically derived from " + s.Path
+}
+
+func (s Static) Files() []string {
+	return source.ConfigFiles(s.Path)
+}
+
+func (s Static) Load(ctx context.Context) (parser.ParseResult, error) {
+	cfg, err := Analyze(ctx, s.Path)
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	base, err := defaults.Keymap("")
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	return Merge(base, cfg), nil
+}
+
+// Merge layers the bindings of cfg over the default keymap base: a
+// binding replaces the default for the same chord in its table, a key
+// table replaces the default table of the same name, and
+// DisableDefaultAssignment removes the chord altogether.
+func Merge(base parser.ParseResult, cfg *Config) parser.ParseResult {
+	own := cfg.Result
+	result := parser.ParseResult{
+		Leader:      own.Leader,
+		Diagnostics: own.Diagnostics,
+		Format:      own.Format,
+		Version:     base.Version,
+	}
+
+	ownTables := make(map[string]bool)
+	ownChords := make(map[string]bool)
+	for _, b := range own.Bindings {
+		ownTables[b.Table] = true
+		ownChords[chordID(b)] = true
+	}
+	keep := func(b parser.Keybinding) bool {
+		switch {
+		case b.Table == "Default":
+			return !cfg.DisableDefaultKeys && !ownChords[chordID(b)]
+		case parser.IsMouseTable(b.Table):
+			return !cfg.DisableDefaultMouse && !ownChords[chordID(b)]
+		}
+		// A key table in the config replaces the default one.
+		return !ownTables[b.Table] && !slices.Contains(own.Tables, b.Table)
+	}
+
+	tables := slices.Clone(base.Tables)
+	for _, t := range own.Tables {
+		if !slices.Contains(tables, t) {
+			tables = append(tables, t)
+		}
+	}
+	for _, t := range tables {
+		n := len(result.Bindings)
+		for _, b := range base.Bindings {
+			if b.Table == t && keep(b) {
+				result.Bindings = append(result.Bindings, b)
+			}
+		}
+		for _, b := range own.Bindings {
+			if b.Table == t && b.ActionName() != "DisableDefaultAssignment" {
+				result.Bindings = append(result.Bindings, b)
+			}
+		}
+		if len(result.Bindings) > n || slices.Contains(own.Tables, t) {
+			result.Tables = append(result.Tables, t)
+		}
+	}
+	return result
+}
+
+func chordID(b parser.Keybinding) string {
+	b.Key = parser.ShiftedKey(b.Key, b.Modifiers)
+	return b.Table + "\x00" + b.Chord().String()
+}
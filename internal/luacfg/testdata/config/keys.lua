@@ -0,0 +1,16 @@
+local wezterm = require 'wezterm'
+local act = wezterm.action
+
+local M = {}
+
+function M.base()
+  return {
+    { key = 'r', mods = 'LEADER', action = act.ActivateKeyTable { name = 'resize_pane', one_shot = false } },
+    { key = 'Enter', mods = 'ALT', action = act.DisableDefaultAssignment },
+    { key = 'c', mods = 'CTRL|SHIFT', action = act.CopyTo 'Clipboard' },
+    { key = 'v', mods = 'CTRL|SHIFT', action = act.Multiple { act.PasteFrom 'Clipboard', act.SendString 'x' } },
+    { key = 'p', mods = 'CTRL|SHIFT', action = act.EmitEvent 'open-picker' },
+  }
+end
+
+return M
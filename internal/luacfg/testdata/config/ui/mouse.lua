@@ -0,0 +1,15 @@
+local wezterm = require 'wezterm'
+
+return {
+  {
+    event = { Up = { streak = 1, button = 'Left' } },
+    mods = 'CTRL',
+    action = wezterm.action.OpenLinkAtMouseCursor,
+  },
+  {
+    event = { Down = { streak = 1, button = { WheelUp = 1 } } },
+    mods = 'NONE',
+    alt_screen = true,
+    action = wezterm.action.ScrollByLine(-1),
+  },
+}
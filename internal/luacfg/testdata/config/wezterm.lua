@@ -0,0 +1,44 @@
+local wezterm = require 'wezterm'
+local act = wezterm.action
+local keys = require 'keys'
+
+local config = wezterm.config_builder()
+
+config.leader = { key = 'a', mods = 'CTRL', timeout_milliseconds = 2000 }
+config.keys = keys.base()
+
+-- Pane navigation, generated in a loop.
+local directions = { h = 'Left', j = 'Down', k = 'Up', l = 'Right' }
+for key, dir in pairs(directions) do
+  table.insert(config.keys, { key = key, mods = 'LEADER', action = act.ActivatePaneDirection(dir) })
+end
+
+for i = 1, 3 do
+  table.insert(config.keys, { key = tostring(i), mods = 'ALT', action = act.ActivateTab(i - 1) })
+end
+
+if wezterm.target_triple == 'x86_64-pc-windows-msvc' then
+  table.insert(config.keys, { key = 'w', mods = 'CTRL', action = act.CloseCurrentTab { confirm = false } })
+end
+
+table.insert(config.keys, { key = 'e', mods = 'CTRL|SHIFT', action = wezterm.action_callback(function(window, pane)
+  window:toast_notification('wezterm', 'hello', nil, 4000)
+end) })
+
+table.insert(config.keys, { key = 'q', mods = 'CTRL|SHIFT', action = os.getenv('WEZ_QUIT_ACTION') })
+
+config.key_tables = {
+  resize_pane = {
+    { key = 'h', action = act.AdjustPaneSize { 'Left', 1 } },
+    { key = 'Escape', action = 'PopKeyTable' },
+    { key = 'Escape', action = act.PopKeyTable },
+  },
+}
+
+config.mouse_bindings = require('ui.mouse')
+
+wezterm.on('open-picker', function(window, pane)
+  window:perform_action(act.ShowLauncherArgs { flags = 'FUZZY|WORKSPACES' }, pane)
+end)
+
+return config
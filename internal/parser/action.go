@@ -0,0 +1,461 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NodeKind describes a node in a parsed action tree.
+type NodeKind int
+
+const (
+	// NodeIdent is a bare identifier such as Down, true or CTRL | SHIFT.
+	NodeIdent NodeKind = iota
+	// NodeCall is an enum variant with positional args, e.g. AdjustPaneSize(Down, 1).
+	NodeCall
+	// NodeStruct is a struct-like value, e.g. CloseCurrentPane { confirm: true }.
+	NodeStruct
+	// NodeList is a list literal, e.g. [SendString("a"), Nop].
+	NodeList
+	// NodeString is a quoted string; Value holds the unescaped text.
+	NodeString
+	// NodeChar is a quoted char; Value holds the character.
+	NodeChar
+	// NodeNumber is a numeric literal; Value holds it verbatim.
+	NodeNumber
+)
+
+// Node is a value in wezterm's Debug-style action syntax. The root of
+// an action tree is the action itself, e.g. the NodeCall named
+// "CopyMode" for CopyMode(JumpBackward { prev_char: false }).
+type Node struct {
+	Kind NodeKind
+	// Name is the identifier, variant or struct name. It is empty for
+	// anonymous structs, lists and literals.
+	Name string
+	// Value holds the decoded text of string, char and number literals.
+	Value string
+	// Args holds positional arguments of a call and the items of a list.
+	Args []Node
+	// Fields holds the fields of a struct in declaration order.
+	Fields []Field
+	// Partial is set for a struct printed with some of its fields left
+	// out, as in SpawnCommand { domain: CurrentPaneDomain, .. }.
+	Partial bool
+}
+
+// Field is a named value inside a struct-like node.
+type Field struct {
+	Name  string
+	Value Node
+}
+
+// Arg returns the i-th positional argument, if present.
+func (n Node) Arg(i int) (Node, bool) {
+	if i < 0 || i >= len(n.Args) {
+		return Node{}, false
+	}
+	return n.Args[i], true
+}
+
+// Field returns the value of the named struct field, if present.
+func (n Node) Field(name string) (Node, bool) {
+	for _, f := range n.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return Node{}, false
+}
+
+// Walk calls fn for n and every node below it in depth-first order.
+// Returning false from fn skips the children of that node.
+func (n Node) Walk(fn func(Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, a := range n.Args {
+		a.Walk(fn)
+	}
+	for _, f := range n.Fields {
+		f.Value.Walk(fn)
+	}
+}
+
+// Normalize returns n rewritten so that an action compares equal
+// whether it was printed by show-keys or read from a Lua config, which
+// leaves out what wezterm fills in: Some(x) and NotNan(x) are unwrapped,
+// numbers are reformatted (1.0 is 1), fields set to None are dropped,
+// the remaining fields are sorted, and an argument struct is merged
+// into its call, so CharSelect(CharSelectArguments { .. }) becomes
+// CharSelect { .. }. A call or struct left empty becomes an identifier.
+func (n Node) Normalize() Node {
+	switch n.Kind {
+	case NodeNumber:
+		if f, err := strconv.ParseFloat(strings.ReplaceAll(n.Value, "_", ""), 64); err == nil {
+			n.Value = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	case NodeCall:
+		if len(n.Args) == 1 && (n.Name == "Some" || n.Name == "NotNan") {
+			return n.Args[0].Normalize()
+		}
+		if len(n.Args) == 1 && isArgStruct(n.Name, n.Args[0]) {
+			return Node{Kind: NodeStruct, Name: n.Name, Fields: n.Args[0].Fields}.Normalize()
+		}
+		n.Args = normalizeNodes(n.Args)
+	case NodeList:
+		n.Args = normalizeNodes(n.Args)
+	case NodeStruct:
+		fields := make([]Field, 0, len(n.Fields))
+		for _, f := range n.Fields {
+			if f.Value.Kind == NodeIdent && f.Value.Name == "None" {
+				continue
+			}
+			fields = append(fields, Field{Name: f.Name, Value: f.Value.Normalize()})
+		}
+		slices.SortStableFunc(fields, func(a, b Field) int { return strings.Compare(a.Name, b.Name) })
+		n.Fields = fields
+		n.Partial = false
+	}
+	if n.Name != "" && (n.Kind == NodeCall || n.Kind == NodeStruct) && len(n.Args) == 0 && len(n.Fields) == 0 {
+		return Node{Kind: NodeIdent, Name: n.Name}
+	}
+	return n
+}
+
+// isArgStruct reports whether arg is the struct holding the arguments
+// of the action call, as in SplitHorizontal(SpawnCommand { .. }), rather
+// than a variant, as in CopyMode(JumpBackward { prev_char: false }).
+func isArgStruct(call string, arg Node) bool {
+	if arg.Kind != NodeStruct {
+		return false
+	}
+	return arg.Name == "" || arg.Name == call || arg.Name == "SpawnCommand" ||
+		strings.HasSuffix(arg.Name, "Arguments") || strings.HasSuffix(arg.Name, "Args")
+}
+
+func normalizeNodes(nodes []Node) []Node {
+	out := make([]Node, len(nodes))
+	for i, a := range nodes {
+		out[i] = a.Normalize()
+	}
+	return out
+}
+
+// String renders the node back into Debug-style syntax.
+func (n Node) String() string {
+	var b strings.Builder
+	n.write(&b)
+	return b.String()
+}
+
+func (n Node) write(b *strings.Builder) {
+	switch n.Kind {
+	case NodeIdent, NodeNumber:
+		b.WriteString(n.Name + n.Value)
+	case NodeString:
+		b.WriteString(fmt.Sprintf("%q", n.Value))
+	case NodeChar:
+		b.WriteString("'" + n.Value + "'")
+	case NodeCall:
+		b.WriteString(n.Name + "(")
+		writeNodes(b, n.Args)
+		b.WriteString(")")
+	case NodeList:
+		b.WriteString("[")
+		writeNodes(b, n.Args)
+		b.WriteString("]")
+	case NodeStruct:
+		if n.Name != "" {
+			b.WriteString(n.Name + " ")
+		}
+		b.WriteString("{ ")
+		for i, f := range n.Fields {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(f.Name + ": ")
+			f.Value.write(b)
+		}
+		if n.Partial {
+			if len(n.Fields) > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("..")
+		}
+		b.WriteString(" }")
+	}
+}
+
+func writeNodes(b *strings.Builder, nodes []Node) {
+	for i, a := range nodes {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		a.write(b)
+	}
+}
+
+// ParseAction parses an action as printed by wezterm show-keys, e.g.
+// CopyMode(JumpBackward { prev_char: false }) or
+// Multiple([SendString("a"), ActivateKeyTable { name: "resize" }]).
+func ParseAction(s string) (Node, error) {
+	p := &actionParser{src: s}
+	n, err := p.value()
+	if err != nil {
+		return Node{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return Node{}, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return n, nil
+}
+
+type actionParser struct {
+	src string
+	pos int
+}
+
+func (p *actionParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("action: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *actionParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *actionParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *actionParser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return p.errorf("expected %q, got end of input", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.src[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *actionParser) value() (Node, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return Node{}, p.errorf("unexpected end of input")
+	case c == '"':
+		s, err := p.quoted('"')
+		return Node{Kind: NodeString, Value: s}, err
+	case c == '\'':
+		s, err := p.quoted('\'')
+		return Node{Kind: NodeChar, Value: s}, err
+	case c == '[':
+		p.pos++
+		items, err := p.list(']')
+		return Node{Kind: NodeList, Args: items}, err
+	case c == '{':
+		fields, partial, err := p.fields()
+		return Node{Kind: NodeStruct, Fields: fields, Partial: partial}, err
+	case c == '-' || c >= '0' && c <= '9':
+		return Node{Kind: NodeNumber, Value: p.number()}, nil
+	case isIdentStart(rune(c)) || c >= utf8.RuneSelf:
+		return p.named()
+	default:
+		return Node{}, p.errorf("unexpected %q", c)
+	}
+}
+
+// named parses an identifier and whatever follows it: a call, a struct
+// body, or further "|"-joined identifiers as printed for bitflags.
+func (p *actionParser) named() (Node, error) {
+	name := p.ident()
+	if name == "" {
+		return Node{}, p.errorf("expected identifier")
+	}
+	switch p.peek() {
+	case '(':
+		p.pos++
+		args, err := p.list(')')
+		return Node{Kind: NodeCall, Name: name, Args: args}, err
+	case '{':
+		fields, partial, err := p.fields()
+		return Node{Kind: NodeStruct, Name: name, Fields: fields, Partial: partial}, err
+	case '|':
+		parts := []string{name}
+		for p.peek() == '|' {
+			p.pos++
+			p.skipSpace()
+			next := p.ident()
+			if next == "" {
+				return Node{}, p.errorf("expected identifier after '|'")
+			}
+			parts = append(parts, next)
+		}
+		return Node{Kind: NodeIdent, Name: strings.Join(parts, " | ")}, nil
+	}
+	return Node{Kind: NodeIdent, Name: name}, nil
+}
+
+func (p *actionParser) list(end byte) ([]Node, error) {
+	var items []Node
+	for {
+		if p.peek() == end {
+			p.pos++
+			return items, nil
+		}
+		n, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, n)
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(end); err != nil {
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+// fields parses a struct body. It reports whether the body ends with
+// "..", which Debug output prints for fields it leaves out.
+func (p *actionParser) fields() ([]Field, bool, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, false, err
+	}
+	var fields []Field
+	for {
+		switch {
+		case p.peek() == '}':
+			p.pos++
+			return fields, false, nil
+		case strings.HasPrefix(p.src[p.pos:], ".."):
+			p.pos += 2
+			return fields, true, p.expect('}')
+		}
+		var name string
+		if p.peek() == '"' {
+			s, err := p.quoted('"')
+			if err != nil {
+				return nil, false, err
+			}
+			name = s
+		} else if name = p.ident(); name == "" {
+			return nil, false, p.errorf("expected field name")
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, false, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, false, err
+		}
+		fields = append(fields, Field{Name: name, Value: v})
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, false, err
+		}
+		return fields, false, nil
+	}
+}
+
+func (p *actionParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if p.pos == start && !isIdentStart(r) {
+			break
+		}
+		if p.pos > start && strings.HasPrefix(p.src[p.pos:], "::") {
+			p.pos += 2
+			continue
+		}
+		if p.pos > start && !isIdentStart(r) && !unicode.IsDigit(r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func (p *actionParser) number() string {
+	start := p.pos
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if (c < '0' || c > '9') && c != '.' && c != '_' && c != 'e' {
+			break
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+// quoted reads a Rust string or char literal and returns its unescaped
+// contents.
+func (p *actionParser) quoted(q byte) (string, error) {
+	p.pos++ // opening quote
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case q:
+			p.pos++
+			return b.String(), nil
+		case '\\':
+			esc := p.escape()
+			r, ok := unescapeRust(esc)
+			if !ok {
+				return "", p.errorf("invalid escape %q", esc)
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated %c literal", q)
+}
+
+// escape consumes one backslash escape sequence and returns it verbatim.
+func (p *actionParser) escape() string {
+	start := p.pos
+	p.pos++ // backslash
+	if p.pos >= len(p.src) {
+		return p.src[start:]
+	}
+	switch p.src[p.pos] {
+	case 'u':
+		if end := strings.IndexByte(p.src[p.pos:], '}'); end >= 0 {
+			p.pos += end + 1
+			return p.src[start:p.pos]
+		}
+	case 'x':
+		p.pos = min(p.pos+3, len(p.src))
+		return p.src[start:p.pos]
+	}
+	p.pos++
+	return p.src[start:p.pos]
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"strings"
+	"time"
+)
+
+// Chord is a key pressed together with a set of modifiers.
+type Chord struct {
+	Mods Modifiers
+	Key  Key
+}
+
+// String returns the chord in "+"-joined form, e.g. "SHIFT+CTRL+a".
+func (c Chord) String() string {
+	return strings.Join(append(c.Mods.Names(), c.Key.String()), "+")
+}
+
+// Leader is the leader chord. While it is active, bindings with the
+// LEADER modifier can fire.
+type Leader struct {
+	Chord
+	// Timeout is how long the leader stays active after being pressed.
+	Timeout time.Duration
+}
+
+// Sequence returns the chords to press for b: the leader followed by
+// b's own chord without LEADER. For bindings that do not use LEADER it
+// returns b's chord alone.
+func (l *Leader) Sequence(b Keybinding) []Chord {
+	c := b.Chord()
+	if l == nil || !c.Mods.Has(ModLeader) {
+		return []Chord{c}
+	}
+	c.Mods &^= ModLeader
+	return []Chord{l.Chord, c}
+}
+
+// Chord returns the binding's modifiers and key.
+func (b Keybinding) Chord() Chord {
+	return Chord{Mods: b.Modifiers, Key: b.Key}
+}
+
+// UsesLeader reports whether b only fires while the leader is active.
+func (b Keybinding) UsesLeader() bool {
+	return b.Modifiers.Has(ModLeader)
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diagnostic describes a line of show-keys output that the parser did
+// not understand and skipped.
+type Diagnostic struct {
+	// File is set when the input spans several files, such as a Lua
+	// config and the modules it requires.
+	File string `json:",omitempty"`
+	// Line is the 1-based line number in the input.
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (d Diagnostic) String() string {
+	if d.File != "" {
+		return fmt.Sprintf("%s:%d: %s: %q", d.File, d.Line, d.Reason, d.Text)
+	}
+	return fmt.Sprintf("line %d: %s: %q", d.Line, d.Reason, d.Text)
+}
+
+// ParseError is returned by ParseStrict when the input contains lines
+// the parser could not understand.
+type ParseError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ParseError) Error() string {
+	if len(e.Diagnostics) == 1 {
+		return "parse: " + e.Diagnostics[0].String()
+	}
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return fmt.Sprintf("parse: %d unrecognized lines:\n%s", len(e.Diagnostics), strings.Join(lines, "\n"))
+}
+
+// ParseStrict is like Parse but returns a *ParseError if any line was
+// skipped. The partial result is returned alongside the error.
+func ParseStrict(input string) (ParseResult, error) {
+	result := Parse(input)
+	if len(result.Diagnostics) > 0 {
+		return result, &ParseError{Diagnostics: result.Diagnostics}
+	}
+	return result, nil
+}
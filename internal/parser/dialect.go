@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Dialect describes the layout of the show-keys text table printed by a
+// range of wezterm releases.
+type Dialect struct {
+	Name string
+	// Since is the date of the first release printing this dialect, e.g.
+	// "20230320". It is empty for the oldest dialect.
+	Since string
+	// keyCalls lists the function-style key syntaxes the dialect prints,
+	// e.g. "Phys" for Phys(A).
+	keyCalls []string
+}
+
+// DialectModern prints keys in Rust Debug form, such as Char('a') and
+// Phys(A), next to bare names like Tab and u.
+var DialectModern = &Dialect{
+	Name:     "modern",
+	keyCalls: []string{"Char", "Phys", "RawCode", "Function", "Numpad"},
+}
+
+// dialects lists every known dialect from oldest to newest. A dialect
+// is only added for a layout seen in the output of a real release, with
+// Since set to that release.
+var dialects = []*Dialect{DialectModern}
+
+// DialectByName returns the dialect with the given name, or nil if
+// there is none.
+func DialectByName(name string) *Dialect {
+	for _, d := range dialects {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func (d *Dialect) String() string {
+	if d.Since == "" {
+		return d.Name
+	}
+	return fmt.Sprintf("%s (%s+)", d.Name, d.Since)
+}
+
+var versionRe = regexp.MustCompile(`\b(\d{8})-\d{6}-[0-9a-f]+\b`)
+
+// ParseVersion extracts the wezterm version from the output of
+// "wezterm --version", e.g. "wezterm 20240203-110809-5046fc22".
+func ParseVersion(output string) (string, bool) {
+	m := versionRe.FindString(output)
+	return m, m != ""
+}
+
+// DialectForVersion returns the dialect printed by the given wezterm
+// version, or nil if the version is not in the usual date-based form.
+func DialectForVersion(version string) *Dialect {
+	m := versionRe.FindStringSubmatch(version)
+	if m == nil {
+		return nil
+	}
+	date := m[1]
+	for _, d := range slices.Backward(dialects) {
+		if d.Since <= date {
+			return d
+		}
+	}
+	return nil
+}
+
+// prints reports whether k uses a syntax the dialect prints.
+func (d *Dialect) prints(k Key) bool {
+	call, _, isCall := strings.Cut(k.Raw, "(")
+	switch {
+	case k.Kind == KeyMouse:
+		return true
+	case isCall && strings.HasSuffix(k.Raw, ")"):
+		return slices.Contains(d.keyCalls, call)
+	}
+	return true
+}
+
+// dialectOfKey returns the only dialect that prints k's syntax, or nil if
+// the syntax is shared or unknown.
+func dialectOfKey(k Key) *Dialect {
+	var found *Dialect
+	for _, d := range dialects {
+		if !d.prints(k) {
+			continue
+		}
+		if found != nil {
+			return nil
+		}
+		found = d
+	}
+	return found
+}
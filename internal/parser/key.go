@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyKind describes how a key is identified in a binding.
+type KeyKind int
+
+const (
+	// KeyNamed is a named key such as Tab, Enter or F11.
+	KeyNamed KeyKind = iota
+	// KeyChar is a character produced by the key, e.g. Char('a').
+	KeyChar
+	// KeyPhys is a physical key position, e.g. Phys(A).
+	KeyPhys
+	// KeyMapped is a key resolved through the keyboard layout, e.g. Mapped(a).
+	KeyMapped
+	// KeyRaw is a raw, OS-specific key code, e.g. RawCode(123).
+	KeyRaw
+	// KeyMouse is a mouse event such as Down { streak: 1, button: Left }.
+	KeyMouse
+)
+
+func (k KeyKind) String() string {
+	switch k {
+	case KeyNamed:
+		return "named"
+	case KeyChar:
+		return "char"
+	case KeyPhys:
+		return "phys"
+	case KeyMapped:
+		return "mapped"
+	case KeyRaw:
+		return "raw"
+	case KeyMouse:
+		return "mouse"
+	default:
+		return "unknown"
+	}
+}
+
+// Key is the trigger of a binding.
+type Key struct {
+	Kind KeyKind
+	// Name is the normalized key: the character for KeyChar and
+	// KeyMapped, the key name for KeyNamed and KeyPhys, and the decimal
+	// code for KeyRaw.
+	Name string
+	// Raw is the key exactly as wezterm printed it.
+	Raw string
+}
+
+var (
+	keyCallRe  = regexp.MustCompile(`^(\w+)\((.*)\)$`)
+	mouseKeyRe = regexp.MustCompile(`^(Down|Up|Drag)\s*\{`)
+)
+
+// ParseKey parses the key column of show-keys output, e.g. Char('a'),
+// Tab, Phys(A), Mapped(a), RawCode(123) or a mouse event.
+func ParseKey(raw string) Key {
+	raw = strings.TrimSpace(raw)
+	k := Key{Kind: KeyNamed, Name: raw, Raw: raw}
+
+	if mouseKeyRe.MatchString(raw) {
+		k.Kind = KeyMouse
+		return k
+	}
+
+	m := keyCallRe.FindStringSubmatch(raw)
+	if m == nil {
+		if utf8.RuneCountInString(raw) == 1 {
+			k.Kind = KeyChar
+		}
+		return k
+	}
+
+	arg := strings.TrimSpace(m[2])
+	switch m[1] {
+	case "Char":
+		if c, ok := unquoteChar(arg); ok {
+			k.Kind = KeyChar
+			k.Name = string(c)
+		}
+	case "Mapped":
+		k.Kind = KeyMapped
+		if c, ok := unquoteChar(arg); ok {
+			k.Name = string(c)
+		} else {
+			k.Name = arg
+		}
+	case "Phys":
+		k.Kind = KeyPhys
+		k.Name = arg
+	case "RawCode", "Raw":
+		if _, err := strconv.ParseUint(arg, 10, 32); err == nil {
+			k.Kind = KeyRaw
+			k.Name = arg
+		}
+	case "Function":
+		k.Name = "F" + arg
+	case "Numpad":
+		k.Name = "Numpad" + arg
+	}
+	return k
+}
+
+// String returns the display form of the key: "a" for Char('a'),
+// "phys:A" for Phys(A), "mapped:a" for Mapped(a) and "raw:123" for
+// RawCode(123).
+func (k Key) String() string {
+	switch k.Kind {
+	case KeyChar:
+		return displayChar(k.Name)
+	case KeyPhys:
+		return "phys:" + k.Name
+	case KeyMapped:
+		return "mapped:" + displayChar(k.Name)
+	case KeyRaw:
+		return "raw:" + k.Name
+	case KeyMouse:
+		return k.Raw
+	default:
+		return k.Name
+	}
+}
+
+func displayChar(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size != len(s) {
+		return s
+	}
+	switch {
+	case r == ' ':
+		return "Space"
+	case !unicode.IsPrint(r):
+		return fmt.Sprintf("U+%04X", r)
+	}
+	return s
+}
+
+// unquoteChar decodes a Rust char literal as printed by {:?}, e.g. 'a',
+// an escaped quote or '\u{a5}'. Unquoted single characters are accepted as well.
+func unquoteChar(s string) (rune, bool) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		s = s[1 : len(s)-1]
+	}
+	if strings.HasPrefix(s, `\`) {
+		return unescapeRust(s)
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError || size != len(s) {
+		return 0, false
+	}
+	return r, true
+}
+
+// unescapeRust decodes a single Rust escape sequence.
+func unescapeRust(s string) (rune, bool) {
+	switch s {
+	case `\n`:
+		return '\n', true
+	case `\r`:
+		return '\r', true
+	case `\t`:
+		return '\t', true
+	case `\0`:
+		return 0, true
+	case `\\`:
+		return '\\', true
+	case `\'`:
+		return '\'', true
+	case `\"`:
+		return '"', true
+	}
+	if strings.HasPrefix(s, `\u{`) && strings.HasSuffix(s, "}") {
+		n, err := strconv.ParseUint(s[3:len(s)-1], 16, 32)
+		if err == nil && utf8.ValidRune(rune(n)) {
+			return rune(n), true
+		}
+	}
+	if strings.HasPrefix(s, `\x`) && len(s) == 4 {
+		n, err := strconv.ParseUint(s[2:], 16, 8)
+		if err == nil {
+			return rune(n), true
+		}
+	}
+	return 0, false
+}
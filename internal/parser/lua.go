@@ -0,0 +1,492 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sorafujitani/wez-kv/internal/lua"
+)
+
+// Format is the format of show-keys output.
+type Format int
+
+const (
+	// FormatText is the table printed by "wezterm show-keys".
+	FormatText Format = iota
+	// FormatLua is the config snippet printed by "wezterm show-keys --lua".
+	FormatLua
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatText:
+		return "text"
+	case FormatLua:
+		return "lua"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFormat returns the format named s, as printed by Format.String.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range []Format{FormatText, FormatLua} {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q", s)
+}
+
+// DetectFormat guesses the format of show-keys output from its first
+// non-blank line.
+func DetectFormat(input string) Format {
+	for _, line := range strings.Split(input, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "local ") || strings.HasPrefix(line, "return ") ||
+			strings.HasPrefix(line, "return{") || strings.HasPrefix(line, "--") || line == "return" {
+			return FormatLua
+		}
+		return FormatText
+	}
+	return FormatText
+}
+
+// ParseLua parses the output of "wezterm show-keys --lua" by evaluating
+// it like a config. Actions are converted into the same Debug-style
+// syntax the text format uses, so bindings from both formats can be
+// compared directly. Evaluation stops with the context's error if ctx is
+// cancelled.
+func ParseLua(ctx context.Context, input string) (ParseResult, error) {
+	e := lua.NewEvaluator("")
+	ret, err := e.Run(ctx, "", input)
+	if err != nil {
+		result := ParseResult{Format: FormatLua}
+		d := Diagnostic{Reason: err.Error()}
+		if se, ok := err.(*lua.SyntaxError); ok {
+			d.Line, d.Reason = se.Line, se.Msg
+		}
+		result.Diagnostics = append(result.Diagnostics, d)
+		return result, fmt.Errorf("lua: %w", err)
+	}
+	root, ok := lua.First(ret).(*lua.Table)
+	if !ok {
+		return ParseResult{Format: FormatLua}, fmt.Errorf("lua: expected the chunk to return a table, got %s", lua.Describe(lua.First(ret)))
+	}
+	return ConvertLua(e, root).Result, nil
+}
+
+// LuaConfig is the keymap-related part of the table a Lua config
+// returns.
+type LuaConfig struct {
+	// Result holds the bindings the table defines, and the diagnostics
+	// of its evaluation and conversion.
+	Result ParseResult
+	// Defined holds where each binding of Result is defined: the table
+	// constructor of the binding.
+	Defined []lua.Pos
+	// DisableDefaultKeys and DisableDefaultMouse mirror
+	// disable_default_key_bindings and disable_default_mouse_bindings.
+	DisableDefaultKeys  bool
+	DisableDefaultMouse bool
+}
+
+// ConvertLua turns the table root, returned by a chunk e evaluated, into
+// bindings. Values that cannot be turned into a binding are reported
+// through e and end up, with everything else e reported, in the
+// diagnostics of the result.
+func ConvertLua(e *lua.Evaluator, root *lua.Table) LuaConfig {
+	c := &luaConverter{e: e}
+	c.cfg.Result.Format = FormatLua
+	c.convert(root)
+	for _, d := range e.Diagnostics() {
+		c.cfg.Result.Diagnostics = append(c.cfg.Result.Diagnostics, Diagnostic{
+			File:   d.File,
+			Line:   d.Line,
+			Text:   e.SourceLine(d.Pos),
+			Reason: d.Reason,
+		})
+	}
+	return c.cfg
+}
+
+// luaConverter turns an evaluated config table into bindings.
+type luaConverter struct {
+	e   *lua.Evaluator
+	cfg LuaConfig
+	// physical is set by key_map_preference = "Physical".
+	physical bool
+}
+
+func (c *luaConverter) skip(pos lua.Pos, format string, args ...any) {
+	c.e.Diag(pos, format, args...)
+}
+
+func (c *luaConverter) addTable(name string) {
+	if !slices.Contains(c.cfg.Result.Tables, name) {
+		c.cfg.Result.Tables = append(c.cfg.Result.Tables, name)
+	}
+}
+
+func (c *luaConverter) convert(root *lua.Table) {
+	switch v := root.Get("key_map_preference").(type) {
+	case nil:
+	case string:
+		c.physical = v == "Physical"
+	default:
+		c.skip(root.Pos, "key_map_preference depends on %s; assuming Mapped", lua.Describe(v))
+	}
+	if v := root.Get("leader"); v != nil {
+		c.leader(root, v)
+	}
+	if v := root.Get("keys"); v != nil {
+		c.bindings(root, "keys", "Default", v)
+	}
+	if v := root.Get("key_tables"); v != nil {
+		if t, ok := v.(*lua.Table); ok {
+			for _, k := range t.Keys() {
+				name, ok := k.(string)
+				if !ok {
+					c.skip(t.Pos, "key table name is a %s", lua.TypeName(k))
+					continue
+				}
+				c.bindings(t, "key table "+name, name, t.Get(k))
+			}
+		} else {
+			c.skip(root.Pos, "key_tables is %s", lua.Describe(v))
+		}
+	}
+	if v := root.Get("mouse_bindings"); v != nil {
+		c.bindings(root, "mouse_bindings", "", v)
+	}
+	c.cfg.DisableDefaultKeys = c.flag(root, "disable_default_key_bindings")
+	c.cfg.DisableDefaultMouse = c.flag(root, "disable_default_mouse_bindings")
+}
+
+func (c *luaConverter) flag(root *lua.Table, name string) bool {
+	switch v := root.Get(name).(type) {
+	case bool:
+		return v
+	case lua.Unknown:
+		c.skip(root.Pos, "%s depends on %s; assuming false", name, v.What)
+	}
+	return false
+}
+
+func (c *luaConverter) leader(root *lua.Table, v any) {
+	t, ok := v.(*lua.Table)
+	if !ok {
+		c.skip(root.Pos, "leader is %s", lua.Describe(v))
+		return
+	}
+	key, _ := t.Get("key").(string)
+	mods, _ := t.Get("mods").(string)
+	m, err := ParseModifiers(mods)
+	if key == "" || err != nil {
+		c.skip(t.Pos, "malformed leader")
+		return
+	}
+	ms := 1000.0 // wezterm's default leader timeout
+	if n, ok := t.Get("timeout_milliseconds").(float64); ok {
+		ms = n
+	}
+	c.cfg.Result.Leader = &Leader{
+		Chord:   Chord{Mods: m, Key: LuaKey(key)},
+		Timeout: time.Duration(ms * float64(time.Millisecond)),
+	}
+}
+
+// bindings converts a list of bindings. For mouse_bindings, name is
+// empty and each binding goes to the Mouse section its context selects.
+func (c *luaConverter) bindings(parent *lua.Table, what, name string, v any) {
+	list, ok := v.(*lua.Table)
+	if !ok {
+		c.skip(parent.Pos, "%s is %s", what, lua.Describe(v))
+		return
+	}
+	if name != "" {
+		c.addTable(name)
+	}
+	for i, entry := range list.List() {
+		if b, pos, ok := c.binding(list, i+1, name, entry); ok {
+			c.addTable(b.Table)
+			c.cfg.Result.Bindings = append(c.cfg.Result.Bindings, b)
+			c.cfg.Defined = append(c.cfg.Defined, pos)
+		}
+	}
+	if n := len(list.Keys()) - list.Length(); n > 0 {
+		c.skip(list.Pos, "%s has %d non-list entries, which are ignored", what, n)
+	}
+}
+
+func (c *luaConverter) binding(list *lua.Table, index int, name string, v any) (Keybinding, lua.Pos, bool) {
+	entry, ok := v.(*lua.Table)
+	if !ok {
+		c.skip(list.Pos, "entry %d is %s, not a binding table", index, lua.Describe(v))
+		return Keybinding{}, lua.Pos{}, false
+	}
+
+	b := Keybinding{Table: name}
+	switch mods := entry.Get("mods").(type) {
+	case nil:
+	case string:
+		m, err := ParseModifiers(mods)
+		if err != nil {
+			c.skip(entry.Pos, "%v", err)
+			return Keybinding{}, lua.Pos{}, false
+		}
+		b.Modifiers = m
+		b.RawModifiers = mods
+	default:
+		c.skip(entry.Pos, "mods depend on %s", lua.Describe(mods))
+		return Keybinding{}, lua.Pos{}, false
+	}
+
+	if name == "" {
+		b.Table = mouseTable(entry)
+	}
+	switch key := entry.Get("key").(type) {
+	case string:
+		b.Key = ShiftedKey(LuaKey(key), b.Modifiers)
+		if c.physical {
+			b.Key = physicalKey(b.Key)
+		}
+	case nil:
+		event, ok := entry.Get("event").(*lua.Table)
+		if !ok {
+			c.skip(entry.Pos, "binding has no key")
+			return Keybinding{}, lua.Pos{}, false
+		}
+		n, ok := c.value(entry, event)
+		if !ok {
+			return Keybinding{}, lua.Pos{}, false
+		}
+		raw := n.String()
+		b.Key = ParseKey(raw)
+		if ev, err := ParseMouseEvent(raw, b.Table); err == nil {
+			b.Mouse = &ev
+		}
+	default:
+		c.skip(entry.Pos, "key depends on %s", lua.Describe(key))
+		return Keybinding{}, lua.Pos{}, false
+	}
+
+	act := entry.Get("action")
+	if act == nil {
+		c.skip(entry.Pos, "binding has no action")
+		return Keybinding{}, lua.Pos{}, false
+	}
+	tree, ok := c.action(entry, act)
+	if !ok {
+		return Keybinding{}, lua.Pos{}, false
+	}
+	b.ActionTree = tree
+	b.Action = tree.String()
+	return b, entry.Pos, true
+}
+
+// ShiftedKey spells a letter the way wezterm normalizes it: with SHIFT
+// held, "c" is shown and matched as "C".
+func ShiftedKey(k Key, mods Modifiers) Key {
+	if k.Kind == KeyChar && mods.Has(ModShift) && len(k.Name) == 1 && 'a' <= k.Name[0] && k.Name[0] <= 'z' {
+		k.Name = strings.ToUpper(k.Name)
+	}
+	return k
+}
+
+// physicalKey resolves an unprefixed key the way wezterm does under
+// key_map_preference = "Physical": a letter or digit stands for the key
+// in that position, as if it had been written "phys:A". wezterm names
+// the digit keys K0 to K9.
+func physicalKey(k Key) Key {
+	if k.Kind != KeyChar || len(k.Name) != 1 {
+		return k
+	}
+	switch c := k.Name[0]; {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		k.Kind = KeyPhys
+		k.Name = strings.ToUpper(k.Name)
+	case '0' <= c && c <= '9':
+		k.Kind = KeyPhys
+		k.Name = "K" + k.Name
+	}
+	return k
+}
+
+// mouseTable names the show-keys section a mouse binding appears in.
+func mouseTable(entry *lua.Table) string {
+	var ctx []string
+	if entry.Get("alt_screen") == true {
+		ctx = append(ctx, "alt_screen")
+	}
+	if entry.Get("mouse_reporting") == true {
+		ctx = append(ctx, "mouse_reporting")
+	}
+	if len(ctx) == 0 {
+		return "Mouse"
+	}
+	return "Mouse: " + strings.Join(ctx, ", ")
+}
+
+// LuaKey converts a key as written in a Lua config, e.g. "a", "Tab",
+// "phys:Space", "mapped:a" or "raw:123".
+func LuaKey(s string) Key {
+	k := Key{Kind: KeyNamed, Name: s, Raw: s}
+	prefix, rest, found := strings.Cut(s, ":")
+	switch {
+	case found && prefix == "phys":
+		k.Kind, k.Name = KeyPhys, rest
+	case found && prefix == "mapped":
+		k.Kind, k.Name = KeyMapped, rest
+	case found && prefix == "raw":
+		k.Kind, k.Name = KeyRaw, rest
+	case utf8.RuneCountInString(s) == 1:
+		k.Kind = KeyChar
+	}
+	return k
+}
+
+// StringArgActions take free-form strings, which must not be rendered as
+// enum identifiers.
+var StringArgActions = map[string]bool{
+	"SendString": true,
+	"EmitEvent":  true,
+}
+
+// variantRe matches strings and table keys that name an enum variant
+// such as "Close" or "PrimarySelection".
+var variantRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// action converts the value of a binding's action field.
+func (c *luaConverter) action(entry *lua.Table, v any) (Node, bool) {
+	if s, ok := v.(string); ok && variantRe.MatchString(s) {
+		// wezterm takes the name of an action without arguments, e.g.
+		// action = 'PopKeyTable', as the action itself.
+		return Node{Kind: NodeIdent, Name: s}, true
+	}
+	a, ok := v.(*lua.Action)
+	if !ok {
+		c.skip(entry.Pos, "action is %s, not a wezterm action", lua.Describe(v))
+		return Node{}, false
+	}
+	if !a.Called {
+		return Node{Kind: NodeIdent, Name: a.Name}, true
+	}
+
+	n := Node{Kind: NodeCall, Name: a.Name}
+	if len(a.Args) == 1 {
+		if arg, ok := a.Args[0].(*lua.Table); ok {
+			fields := arg.Fields()
+			switch {
+			case len(fields) == 0 && a.Name == "Multiple":
+				list, ok := c.value(entry, arg)
+				if !ok {
+					return Node{}, false
+				}
+				n.Args = []Node{list}
+			case len(fields) == 0:
+				for _, item := range arg.List() {
+					node, ok := c.value(entry, item)
+					if !ok {
+						return Node{}, false
+					}
+					n.Args = append(n.Args, node)
+				}
+			case len(fields) == 1 && variantRe.MatchString(fields[0]):
+				node, ok := c.value(entry, arg)
+				if !ok {
+					return Node{}, false
+				}
+				n.Args = []Node{node}
+			default:
+				n.Kind = NodeStruct
+				if n.Fields, ok = c.fields(entry, arg); !ok {
+					return Node{}, false
+				}
+			}
+			return n, true
+		}
+	}
+	for _, arg := range a.Args {
+		if s, ok := arg.(string); ok && StringArgActions[a.Name] {
+			n.Args = append(n.Args, Node{Kind: NodeString, Value: s})
+			continue
+		}
+		node, ok := c.value(entry, arg)
+		if !ok {
+			return Node{}, false
+		}
+		n.Args = append(n.Args, node)
+	}
+	return n, true
+}
+
+// value converts a nested value into an action tree node.
+func (c *luaConverter) value(entry *lua.Table, v any) (Node, bool) {
+	switch v := v.(type) {
+	case nil:
+		return Node{Kind: NodeIdent, Name: "None"}, true
+	case bool:
+		return Node{Kind: NodeIdent, Name: strconv.FormatBool(v)}, true
+	case float64:
+		return Node{Kind: NodeNumber, Value: lua.FormatNumber(v)}, true
+	case string:
+		if variantRe.MatchString(v) {
+			return Node{Kind: NodeIdent, Name: v}, true
+		}
+		return Node{Kind: NodeString, Value: v}, true
+	case *lua.Action:
+		return c.action(entry, v)
+	case *lua.Table:
+		fields := v.Fields()
+		if len(fields) == 0 {
+			list := Node{Kind: NodeList}
+			for _, item := range v.List() {
+				node, ok := c.value(entry, item)
+				if !ok {
+					return Node{}, false
+				}
+				list.Args = append(list.Args, node)
+			}
+			return list, true
+		}
+		if len(fields) == 1 && variantRe.MatchString(fields[0]) {
+			name := fields[0]
+			if inner, ok := v.Get(name).(*lua.Table); ok && len(inner.Fields()) > 0 {
+				fs, ok := c.fields(entry, inner)
+				return Node{Kind: NodeStruct, Name: name, Fields: fs}, ok
+			}
+			node, ok := c.value(entry, v.Get(name))
+			return Node{Kind: NodeCall, Name: name, Args: []Node{node}}, ok
+		}
+		fs, ok := c.fields(entry, v)
+		return Node{Kind: NodeStruct, Fields: fs}, ok
+	}
+	if lua.TypeName(v) == "function" {
+		c.skip(entry.Pos, "binding holds a function where wezterm expects an action")
+	} else {
+		c.skip(entry.Pos, "binding depends on %s", lua.Describe(v))
+	}
+	return Node{}, false
+}
+
+func (c *luaConverter) fields(entry *lua.Table, t *lua.Table) ([]Field, bool) {
+	var fields []Field
+	for _, name := range t.Fields() {
+		node, ok := c.value(entry, t.Get(name))
+		if !ok {
+			return nil, false
+		}
+		fields = append(fields, Field{Name: name, Value: node})
+	}
+	return fields, true
+}
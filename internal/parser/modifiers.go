@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"cmp"
+	"fmt"
+	"math/bits"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Modifiers is a set of modifier keys held down for a chord.
+//
+// The zero value is the empty set, which wezterm prints as NONE.
+type Modifiers uint16
+
+// The bit order follows the order in which wezterm prints modifiers, so
+// iterating bits from low to high yields the canonical ordering.
+const (
+	ModShift Modifiers = 1 << iota
+	ModAlt
+	ModCtrl
+	ModSuper
+	ModLeftAlt
+	ModRightAlt
+	ModLeader
+	ModLeftCtrl
+	ModRightCtrl
+	ModLeftShift
+	ModRightShift
+	ModEnhancedKey
+)
+
+// modifierNames lists every modifier wezterm can print, indexed by bit.
+var modifierNames = []string{
+	"SHIFT",
+	"ALT",
+	"CTRL",
+	"SUPER",
+	"LEFT_ALT",
+	"RIGHT_ALT",
+	"LEADER",
+	"LEFT_CTRL",
+	"RIGHT_CTRL",
+	"LEFT_SHIFT",
+	"RIGHT_SHIFT",
+	"ENHANCED_KEY",
+}
+
+// modifierAliases maps the alternative spellings wezterm accepts in
+// configs to the canonical name it prints.
+var modifierAliases = map[string]string{
+	"CMD":  "SUPER",
+	"WIN":  "SUPER",
+	"OPT":  "ALT",
+	"META": "ALT",
+}
+
+// ParseModifiers parses a "|"-separated modifier list such as
+// "SHIFT | CTRL". NONE and the empty string yield the empty set, and
+// aliases like CMD or OPT resolve to their canonical modifier.
+func ParseModifiers(s string) (Modifiers, error) {
+	var mods Modifiers
+	for _, tok := range strings.Split(s, "|") {
+		tok = strings.TrimSpace(tok)
+		if tok == "" || tok == "NONE" {
+			continue
+		}
+		m, ok := lookupModifier(tok)
+		if !ok {
+			return 0, fmt.Errorf("unknown modifier %q", tok)
+		}
+		mods |= m
+	}
+	return mods, nil
+}
+
+func lookupModifier(tok string) (Modifiers, bool) {
+	if alias, ok := modifierAliases[tok]; ok {
+		tok = alias
+	}
+	for i, n := range modifierNames {
+		if n == tok {
+			return 1 << i, true
+		}
+	}
+	return 0, false
+}
+
+// Has reports whether every modifier in o is also in m.
+func (m Modifiers) Has(o Modifiers) bool {
+	return m&o == o
+}
+
+// IsEmpty reports whether no modifier is set.
+func (m Modifiers) IsEmpty() bool {
+	return m == 0
+}
+
+// Names returns the canonical names of the set modifiers in wezterm order.
+func (m Modifiers) Names() []string {
+	var names []string
+	for i, n := range modifierNames {
+		if m&(1<<i) != 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// String returns the modifiers joined with " | " in wezterm order, or ""
+// for the empty set.
+func (m Modifiers) String() string {
+	return strings.Join(m.Names(), " | ")
+}
+
+// Compare orders modifier sets first by the number of modifiers and then
+// by their canonical bit order. It returns -1, 0 or +1.
+func (m Modifiers) Compare(o Modifiers) int {
+	if c := cmp.Compare(bits.OnesCount16(uint16(m)), bits.OnesCount16(uint16(o))); c != 0 {
+		return c
+	}
+	return cmp.Compare(m, o)
+}
+
+// modifierPattern matches a single modifier token, including NONE and aliases.
+var modifierPattern = buildModifierPattern()
+
+func buildModifierPattern() string {
+	names := append([]string{"NONE"}, modifierNames...)
+	for alias := range modifierAliases {
+		names = append(names, alias)
+	}
+	// Longest first so that e.g. LEFT_CTRL is never cut short.
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+	return `(?:` + strings.Join(quoted, "|") + `)`
+}
+
+// modifierListPattern matches a "|"-separated list of modifier tokens.
+var modifierListPattern = modifierPattern + `(?:\s*\|\s*` + modifierPattern + `)*`
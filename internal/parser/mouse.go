@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MouseEventKind is the kind of mouse event a binding triggers on.
+type MouseEventKind int
+
+const (
+	MouseDown MouseEventKind = iota
+	MouseUp
+	MouseDrag
+)
+
+func (k MouseEventKind) String() string {
+	switch k {
+	case MouseDown:
+		return "Down"
+	case MouseUp:
+		return "Up"
+	case MouseDrag:
+		return "Drag"
+	default:
+		return "unknown"
+	}
+}
+
+// MouseContext describes when a mouse binding applies, derived from the
+// Mouse section header, e.g. "Mouse: alt_screen".
+type MouseContext struct {
+	AltScreen      bool
+	MouseReporting bool
+}
+
+func (c MouseContext) String() string {
+	var parts []string
+	if c.AltScreen {
+		parts = append(parts, "alt_screen")
+	}
+	if c.MouseReporting {
+		parts = append(parts, "mouse_reporting")
+	}
+	if len(parts) == 0 {
+		return "normal"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// MouseEvent is the trigger of a mouse binding, e.g.
+// Down { streak: 1, button: Left }.
+type MouseEvent struct {
+	Kind MouseEventKind
+	// Button is the button name, e.g. Left, Middle or WheelUp(1).
+	Button  string
+	Streak  int
+	Context MouseContext
+}
+
+// IsMouseTable reports whether table is one of the Mouse sections.
+func IsMouseTable(table string) bool {
+	return table == "Mouse" || strings.HasPrefix(table, "Mouse: ")
+}
+
+// ParseMouseContext derives the mouse context from a Mouse section name.
+func ParseMouseContext(table string) MouseContext {
+	var c MouseContext
+	for _, part := range strings.Split(strings.TrimPrefix(table, "Mouse"), ",") {
+		switch strings.TrimSpace(strings.TrimPrefix(part, ":")) {
+		case "alt_screen":
+			c.AltScreen = true
+		case "mouse_reporting":
+			c.MouseReporting = true
+		}
+	}
+	return c
+}
+
+// ParseMouseEvent parses a mouse trigger such as
+// Down { streak: 2, button: Left } found in the given Mouse section.
+func ParseMouseEvent(raw, table string) (MouseEvent, error) {
+	n, err := ParseAction(raw)
+	if err != nil {
+		return MouseEvent{}, err
+	}
+	if n.Kind != NodeStruct {
+		return MouseEvent{}, fmt.Errorf("mouse event: expected struct, got %q", raw)
+	}
+
+	ev := MouseEvent{Context: ParseMouseContext(table)}
+	switch n.Name {
+	case "Down":
+		ev.Kind = MouseDown
+	case "Up":
+		ev.Kind = MouseUp
+	case "Drag":
+		ev.Kind = MouseDrag
+	default:
+		return MouseEvent{}, fmt.Errorf("mouse event: unknown kind %q", n.Name)
+	}
+
+	if streak, ok := n.Field("streak"); ok {
+		ev.Streak, err = strconv.Atoi(streak.Value)
+		if err != nil {
+			return MouseEvent{}, fmt.Errorf("mouse event: invalid streak %q", streak.Value)
+		}
+	}
+	if button, ok := n.Field("button"); ok {
+		ev.Button = button.String()
+	}
+	return ev, nil
+}
@@ -1,126 +1,213 @@
 package parser
 
 import (
+	"context"
+	"fmt"
 	"regexp"
 	"strings"
+	"time"
 )
 
 type Keybinding struct {
 	Table     string
-	Modifiers string
-	Key       string
-	Action    string
+	Modifiers Modifiers
+	// RawModifiers is the modifier list as the config spells it, e.g.
+	// "CTRL|SHIFT", when known. wezterm prints modifiers in canonical
+	// order, so it is empty for bindings read from its output.
+	RawModifiers string
+	Key          Key
+	Action       string
+	// ActionTree is the parsed form of Action. When Action cannot be
+	// parsed it is a NodeIdent holding the raw text.
+	ActionTree Node
+	// Mouse is set for bindings in a Mouse section.
+	Mouse *MouseEvent
 }
 
-type Leader struct {
-	Key     string
-	Mods    string
-	Timeout string
+// NewKeybinding builds a binding from its parts, deriving ActionTree
+// from action and Mouse from mouse triggers in a Mouse table.
+func NewKeybinding(table string, mods Modifiers, key Key, action string) Keybinding {
+	tree, err := ParseAction(action)
+	if err != nil {
+		tree = Node{Kind: NodeIdent, Name: action}
+	}
+
+	b := Keybinding{
+		Table:      table,
+		Modifiers:  mods,
+		Key:        key,
+		Action:     action,
+		ActionTree: tree,
+	}
+	if key.Kind == KeyMouse && IsMouseTable(table) {
+		if ev, err := ParseMouseEvent(key.Raw, table); err == nil {
+			b.Mouse = &ev
+		}
+	}
+	return b
+}
+
+// ActionName returns the name of the bound action, e.g. "CopyMode" for
+// CopyMode(Close).
+func (b Keybinding) ActionName() string {
+	return b.ActionTree.Name
 }
 
 type ParseResult struct {
 	Leader   *Leader
 	Bindings []Keybinding
 	Tables   []string
+	// Diagnostics lists the lines that were skipped because they could
+	// not be parsed.
+	Diagnostics []Diagnostic
+	// Format is the detected input format.
+	Format Format
+	// Version is the wezterm version that produced the output, if known.
+	Version string
+	// Dialect is the text dialect the output was parsed as. It is nil
+	// for Lua input and when the output gave no hint.
+	Dialect *Dialect
 }
 
 var (
-	leaderRe  = regexp.MustCompile(`^Leader:\s+(.+?)\s+((?:CTRL|SHIFT|ALT|SUPER|NONE)(?:\s*\|\s*(?:CTRL|SHIFT|ALT|SUPER|NONE))*)\s+(\S+)$`)
+	leaderRe    = regexp.MustCompile(`^Leader:\s+(.+?)\s+(` + modifierListPattern + `)\s+(\S+)$`)
 	separatorRe = regexp.MustCompile(`\s+->\s+`)
-	modsKeyRe   = regexp.MustCompile(`^((?:CTRL|SHIFT|ALT|SUPER|NONE)(?:\s*\|\s*(?:CTRL|SHIFT|ALT|SUPER|NONE))*)\s+(.+)$`)
+	modsKeyRe   = regexp.MustCompile(`^(` + modifierListPattern + `)\s+(.+)$`)
 )
 
+// Parse parses the full output of wezterm show-keys, in either the text
+// or the --lua format. Errors are reported through Diagnostics.
 func Parse(input string) ParseResult {
-	var result ParseResult
-	var currentTable string
-	tablesSeen := make(map[string]bool)
-
-	lines := strings.Split(input, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "Leader:") {
-			if m := leaderRe.FindStringSubmatch(line); m != nil {
-				mods := m[2]
-				if mods == "NONE" {
-					mods = ""
-				}
-				result.Leader = &Leader{
-					Key:     m[1],
-					Mods:    mods,
-					Timeout: m[3],
-				}
-			}
-			continue
-		}
+	result, _ := ParseReader(context.Background(), strings.NewReader(input))
+	return result
+}
+
+// lineParser holds the state of a parse across lines.
+type lineParser struct {
+	result       ParseResult
+	currentTable string
+	tablesSeen   map[string]bool
+	// expected is the dialect implied by the version, if known.
+	expected *Dialect
+}
+
+func newLineParser(version string) *lineParser {
+	p := &lineParser{
+		tablesSeen: make(map[string]bool),
+		expected:   DialectForVersion(version),
+	}
+	p.result.Version = version
+	return p
+}
+
+// parseKey parses a key and settles the dialect on the first key whose
+// syntax only one dialect prints. A dialect that contradicts the version
+// is reported once, since it means the output format has changed.
+func (p *lineParser) parseKey(lineNo int, line, raw string) Key {
+	k := ParseKey(raw)
+	if p.result.Dialect != nil {
+		return k
+	}
+	d := dialectOfKey(k)
+	if d == nil {
+		return k
+	}
+	p.result.Dialect = d
+	if p.expected != nil && d != p.expected {
+		p.skip(lineNo, line, fmt.Sprintf("output of wezterm %s looks like the %s dialect, expected %s",
+			p.result.Version, d, p.expected))
+	}
+	return k
+}
+
+func (p *lineParser) skip(lineNo int, line, reason string) {
+	p.result.Diagnostics = append(p.result.Diagnostics, Diagnostic{Line: lineNo, Text: line, Reason: reason})
+}
+
+func (p *lineParser) enterTable(name string) {
+	p.currentTable = name
+	if !p.tablesSeen[name] {
+		p.result.Tables = append(p.result.Tables, name)
+		p.tablesSeen[name] = true
+	}
+}
 
-		if line == "Default key table" {
-			currentTable = "Default"
-			if !tablesSeen[currentTable] {
-				result.Tables = append(result.Tables, currentTable)
-				tablesSeen[currentTable] = true
-			}
-			continue
+// feed parses a single line without its line terminator. It returns the
+// binding the line defines, if any.
+func (p *lineParser) feed(lineNo int, line string) (Keybinding, bool) {
+	if strings.HasPrefix(line, "Leader:") {
+		m := leaderRe.FindStringSubmatch(line)
+		if m == nil {
+			p.skip(lineNo, line, "malformed leader line")
+			return Keybinding{}, false
 		}
-		if strings.HasPrefix(line, "Key Table: ") {
-			currentTable = strings.TrimPrefix(line, "Key Table: ")
-			if !tablesSeen[currentTable] {
-				result.Tables = append(result.Tables, currentTable)
-				tablesSeen[currentTable] = true
-			}
-			continue
+		timeout, err := time.ParseDuration(m[3])
+		if err != nil {
+			p.skip(lineNo, line, "malformed leader timeout")
+			return Keybinding{}, false
 		}
-		if line == "Mouse" || strings.HasPrefix(line, "Mouse: ") {
-			currentTable = line
-			if !tablesSeen[currentTable] {
-				result.Tables = append(result.Tables, currentTable)
-				tablesSeen[currentTable] = true
-			}
-			continue
+		p.result.Leader = &Leader{
+			Chord: Chord{
+				Mods: mustParseModifiers(m[2]),
+				Key:  ParseKey(m[1]),
+			},
+			Timeout: timeout,
 		}
+		return Keybinding{}, false
+	}
 
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "---") {
-			continue
-		}
+	if line == "Default key table" {
+		p.enterTable("Default")
+		return Keybinding{}, false
+	}
+	if strings.HasPrefix(line, "Key Table: ") {
+		p.enterTable(strings.TrimPrefix(line, "Key Table: "))
+		return Keybinding{}, false
+	}
+	if IsMouseTable(line) {
+		p.enterTable(line)
+		return Keybinding{}, false
+	}
 
-		if !strings.HasPrefix(line, "\t") {
-			continue
-		}
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "---") {
+		return Keybinding{}, false
+	}
 
-		loc := separatorRe.FindStringIndex(line)
-		if loc == nil {
-			continue
-		}
+	if !strings.HasPrefix(line, "\t") {
+		p.skip(lineNo, line, "unrecognized line")
+		return Keybinding{}, false
+	}
 
-		left := strings.TrimSpace(line[:loc[0]])
-		action := strings.TrimSpace(line[loc[1]:])
+	loc := separatorRe.FindStringIndex(line)
+	if loc == nil {
+		p.skip(lineNo, line, "missing '->' separator")
+		return Keybinding{}, false
+	}
 
-		var modifiers, key string
-		if m := modsKeyRe.FindStringSubmatch(left); m != nil {
-			modifiers = normalizeModifiers(m[1])
-			key = strings.TrimSpace(m[2])
-		} else {
-			key = left
-		}
+	left := strings.TrimSpace(line[:loc[0]])
+	action := strings.TrimSpace(line[loc[1]:])
 
-		result.Bindings = append(result.Bindings, Keybinding{
-			Table:     currentTable,
-			Modifiers: modifiers,
-			Key:       key,
-			Action:    action,
-		})
+	var modifiers Modifiers
+	var key Key
+	if m := modsKeyRe.FindStringSubmatch(left); m != nil {
+		modifiers = mustParseModifiers(m[1])
+		key = p.parseKey(lineNo, line, m[2])
+	} else {
+		key = p.parseKey(lineNo, line, left)
 	}
 
-	return result
+	binding := NewKeybinding(p.currentTable, modifiers, key, action)
+	p.result.Bindings = append(p.result.Bindings, binding)
+	return binding, true
 }
 
-func normalizeModifiers(raw string) string {
-	parts := strings.Split(raw, "|")
-	var mods []string
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p != "" && p != "NONE" {
-			mods = append(mods, p)
-		}
+// mustParseModifiers parses a modifier list that has already been matched
+// by modifierListPattern, so every token is known to be valid.
+func mustParseModifiers(raw string) Modifiers {
+	mods, err := ParseModifiers(raw)
+	if err != nil {
+		panic(err)
 	}
-	return strings.Join(mods, " | ")
+	return mods
 }
@@ -1,7 +1,14 @@
 package parser
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 const testInput = `Leader: Char('a') CTRL 2.001s
@@ -56,9 +63,11 @@ func TestParse(t *testing.T) {
 		if result.Leader == nil {
 			t.Fatal("expected Leader to be parsed")
 		}
-		assertEqual(t, "Key", result.Leader.Key, "Char('a')")
-		assertEqual(t, "Mods", result.Leader.Mods, "CTRL")
-		assertEqual(t, "Timeout", result.Leader.Timeout, "2.001s")
+		assertEqual(t, "Key", result.Leader.Key.String(), "a")
+		assertEqual(t, "Mods", result.Leader.Mods.String(), "CTRL")
+		if result.Leader.Timeout != 2001*time.Millisecond {
+			t.Errorf("Timeout: got %v, want 2.001s", result.Leader.Timeout)
+		}
 	})
 
 	t.Run("Tables", func(t *testing.T) {
@@ -83,50 +92,50 @@ func TestParse(t *testing.T) {
 	t.Run("DefaultTableBindings", func(t *testing.T) {
 		b := result.Bindings[0]
 		assertEqual(t, "Table", b.Table, "Default")
-		assertEqual(t, "Modifiers", b.Modifiers, "CTRL")
-		assertEqual(t, "Key", b.Key, "Tab")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "CTRL")
+		assertEqual(t, "Key", b.Key.String(), "Tab")
 		assertEqual(t, "Action", b.Action, "ActivateTabRelative(1)")
 	})
 
 	t.Run("MultipleModifiers", func(t *testing.T) {
 		b := result.Bindings[1]
-		assertEqual(t, "Modifiers", b.Modifiers, "SHIFT | CTRL")
-		assertEqual(t, "Key", b.Key, "Tab")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "SHIFT | CTRL")
+		assertEqual(t, "Key", b.Key.String(), "Tab")
 	})
 
 	t.Run("ThreeModifiers", func(t *testing.T) {
 		b := result.Bindings[4]
-		assertEqual(t, "Modifiers", b.Modifiers, "SHIFT | ALT | CTRL")
-		assertEqual(t, "Key", b.Key, "DownArrow")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "SHIFT | ALT | CTRL")
+		assertEqual(t, "Key", b.Key.String(), "DownArrow")
 		assertEqual(t, "Action", b.Action, "AdjustPaneSize(Down, 1)")
 	})
 
 	t.Run("NoModifiers", func(t *testing.T) {
 		b := result.Bindings[5]
-		assertEqual(t, "Modifiers", b.Modifiers, "")
-		assertEqual(t, "Key", b.Key, "Copy")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "")
+		assertEqual(t, "Key", b.Key.String(), "Copy")
 	})
 
 	t.Run("CopyModeBindings", func(t *testing.T) {
 		b := result.Bindings[7]
 		assertEqual(t, "Table", b.Table, "copy_mode")
-		assertEqual(t, "Modifiers", b.Modifiers, "")
-		assertEqual(t, "Key", b.Key, "Tab")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "")
+		assertEqual(t, "Key", b.Key.String(), "Tab")
 		assertEqual(t, "Action", b.Action, "CopyMode(MoveForwardWord)")
 	})
 
 	t.Run("CopyModeSingleCharKey", func(t *testing.T) {
 		b := result.Bindings[11]
 		assertEqual(t, "Table", b.Table, "copy_mode")
-		assertEqual(t, "Modifiers", b.Modifiers, "")
-		assertEqual(t, "Key", b.Key, "F")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "")
+		assertEqual(t, "Key", b.Key.String(), "F")
 		assertEqual(t, "Action", b.Action, "CopyMode(JumpBackward { prev_char: false })")
 	})
 
 	t.Run("CopyModeWithModifier", func(t *testing.T) {
 		b := result.Bindings[12]
-		assertEqual(t, "Modifiers", b.Modifiers, "SHIFT")
-		assertEqual(t, "Key", b.Key, "F")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "SHIFT")
+		assertEqual(t, "Key", b.Key.String(), "F")
 	})
 
 	t.Run("SearchModeBindings", func(t *testing.T) {
@@ -137,16 +146,16 @@ func TestParse(t *testing.T) {
 	t.Run("MouseComplexKey", func(t *testing.T) {
 		b := result.Bindings[17]
 		assertEqual(t, "Table", b.Table, "Mouse")
-		assertEqual(t, "Modifiers", b.Modifiers, "")
-		assertEqual(t, "Key", b.Key, "Down { streak: 1, button: Left }")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "")
+		assertEqual(t, "Key", b.Key.String(), "Down { streak: 1, button: Left }")
 		assertEqual(t, "Action", b.Action, "SelectTextAtMouseCursor(Cell)")
 	})
 
 	t.Run("MouseWithModifiers", func(t *testing.T) {
 		b := result.Bindings[19]
 		assertEqual(t, "Table", b.Table, "Mouse")
-		assertEqual(t, "Modifiers", b.Modifiers, "SHIFT | ALT")
-		assertEqual(t, "Key", b.Key, "Down { streak: 1, button: Left }")
+		assertEqual(t, "Modifiers", b.Modifiers.String(), "SHIFT | ALT")
+		assertEqual(t, "Key", b.Key.String(), "Down { streak: 1, button: Left }")
 	})
 
 	t.Run("MouseAltScreenBindings", func(t *testing.T) {
@@ -181,7 +190,66 @@ Default key table
 	if result.Leader == nil {
 		t.Fatal("expected Leader to be parsed")
 	}
-	assertEqual(t, "Mods", result.Leader.Mods, "")
+	assertEqual(t, "Mods", result.Leader.Mods.String(), "")
+}
+
+const leaderInput = `Leader: Char('b') CTRL 1.000s
+Default key table
+-----------------
+
+	LEADER                Char('c')          ->   SpawnTab(CurrentPaneDomain)
+	SHIFT | LEADER        Char('%')          ->   SplitHorizontal(SpawnCommand { domain: CurrentPaneDomain })
+	LEADER                Char('"')          ->   SplitVertical(SpawnCommand { domain: CurrentPaneDomain })
+	CTRL | LEADER         Char('b')          ->   SendKey(KeyNoAction { key: Char('b'), mods: CTRL })
+	SUPER                 Char('t')          ->   SpawnTab(CurrentPaneDomain)
+	LEFT_ALT              Char('h')          ->   ActivatePaneDirection(Left)
+	LEADER | RIGHT_CTRL   Char('x')          ->   CloseCurrentPane { confirm: true }
+	SUPER                 Char('w')          ->   CloseCurrentTab { confirm: true }
+	ALT                   Char('f')          ->   ActivatePaneDirection(Right)
+	NONE                  F11                ->   ToggleFullScreen
+`
+
+func TestParseExtendedModifiers(t *testing.T) {
+	result := Parse(leaderInput)
+
+	if len(result.Bindings) != 10 {
+		t.Fatalf("expected 10 bindings, got %d", len(result.Bindings))
+	}
+
+	cases := []struct {
+		mods string
+		key  string
+	}{
+		{"LEADER", "c"},
+		{"SHIFT | LEADER", "%"},
+		{"LEADER", "\""},
+		{"CTRL | LEADER", "b"},
+		{"SUPER", "t"},
+		{"LEFT_ALT", "h"},
+		{"LEADER | RIGHT_CTRL", "x"},
+		{"SUPER", "w"},
+		{"ALT", "f"},
+		{"", "F11"},
+	}
+	for i, c := range cases {
+		b := result.Bindings[i]
+		assertEqual(t, "Modifiers", b.Modifiers.String(), c.mods)
+		assertEqual(t, "Key", b.Key.String(), c.key)
+	}
+}
+
+func TestParseLeaderSpace(t *testing.T) {
+	input := `Leader: Char(' ') SHIFT | SUPER 500ms
+`
+	result := Parse(input)
+	if result.Leader == nil {
+		t.Fatal("expected Leader to be parsed")
+	}
+	assertEqual(t, "Key", result.Leader.Key.String(), "Space")
+	assertEqual(t, "Mods", result.Leader.Mods.String(), "SHIFT | SUPER")
+	if result.Leader.Timeout != 500*time.Millisecond {
+		t.Errorf("Timeout: got %v, want 500ms", result.Leader.Timeout)
+	}
 }
 
 func assertEqual(t *testing.T, name, got, want string) {
@@ -190,3 +258,653 @@ func assertEqual(t *testing.T, name, got, want string) {
 		t.Errorf("%s: got %q, want %q", name, got, want)
 	}
 }
+
+func TestParseModifiers(t *testing.T) {
+	a, err := ParseModifiers("SHIFT | CTRL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseModifiers("CTRL|SHIFT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Errorf("expected %q and %q to be equal", a, b)
+	}
+	assertEqual(t, "String", b.String(), "SHIFT | CTRL")
+
+	if !a.Has(ModCtrl) || !a.Has(ModShift|ModCtrl) {
+		t.Error("expected Has to report CTRL and SHIFT")
+	}
+	if a.Has(ModAlt) {
+		t.Error("expected Has(ALT) to be false")
+	}
+
+	none, err := ParseModifiers("NONE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !none.IsEmpty() {
+		t.Errorf("expected NONE to be empty, got %q", none)
+	}
+
+	// wezterm prints canonical names only, but configs may use aliases.
+	aliases := map[string]string{
+		"CMD":        "SUPER",
+		"WIN":        "SUPER",
+		"OPT":        "ALT",
+		"META":       "ALT",
+		"CMD | OPT":  "ALT | SUPER",
+		"META | ALT": "ALT",
+	}
+	for in, want := range aliases {
+		mods, err := ParseModifiers(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		assertEqual(t, in, mods.String(), want)
+	}
+	sides, _ := ParseModifiers("RIGHT_CTRL | LEADER")
+	assertEqual(t, "Order", sides.String(), "LEADER | RIGHT_CTRL")
+
+	if _, err := ParseModifiers("CTRL | HYPER"); err == nil {
+		t.Error("expected error for unknown modifier")
+	}
+}
+
+func TestModifiersCompare(t *testing.T) {
+	if ModCtrl.Compare(ModCtrl) != 0 {
+		t.Error("expected equal sets to compare as 0")
+	}
+	if ModCtrl.Compare(ModShift|ModAlt) >= 0 {
+		t.Error("expected fewer modifiers to sort first")
+	}
+	if ModShift.Compare(ModCtrl) >= 0 {
+		t.Error("expected SHIFT to sort before CTRL")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	cases := []struct {
+		raw     string
+		kind    KeyKind
+		name    string
+		display string
+	}{
+		{"Char('a')", KeyChar, "a", "a"},
+		{"Char('A')", KeyChar, "A", "A"},
+		{"Char('\\'')", KeyChar, "'", "'"},
+		{"Char('\\\\')", KeyChar, "\\", "\\"},
+		{"Char(' ')", KeyChar, " ", "Space"},
+		{"Char('¥')", KeyChar, "¥", "¥"},
+		{"Char('\\u{a5}')", KeyChar, "¥", "¥"},
+		{"Char('\\u{7f}')", KeyChar, "\x7f", "U+007F"},
+		{"u", KeyChar, "u", "u"},
+		{"Tab", KeyNamed, "Tab", "Tab"},
+		{"DownArrow", KeyNamed, "DownArrow", "DownArrow"},
+		{"Function(5)", KeyNamed, "F5", "F5"},
+		{"Numpad(0)", KeyNamed, "Numpad0", "Numpad0"},
+		{"Phys(A)", KeyPhys, "A", "phys:A"},
+		{"Mapped(a)", KeyMapped, "a", "mapped:a"},
+		{"Mapped('b')", KeyMapped, "b", "mapped:b"},
+		{"RawCode(123)", KeyRaw, "123", "raw:123"},
+		{"Down { streak: 1, button: Left }", KeyMouse, "Down { streak: 1, button: Left }", "Down { streak: 1, button: Left }"},
+	}
+	for _, c := range cases {
+		k := ParseKey(c.raw)
+		if k.Kind != c.kind {
+			t.Errorf("%s: kind: got %s, want %s", c.raw, k.Kind, c.kind)
+		}
+		assertEqual(t, c.raw+" Name", k.Name, c.name)
+		assertEqual(t, c.raw+" String", k.String(), c.display)
+		assertEqual(t, c.raw+" Raw", k.Raw, c.raw)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	t.Run("Ident", func(t *testing.T) {
+		n := mustParseAction(t, "ToggleFullScreen")
+		if n.Kind != NodeIdent {
+			t.Errorf("expected NodeIdent, got %d", n.Kind)
+		}
+		assertEqual(t, "Name", n.Name, "ToggleFullScreen")
+	})
+
+	t.Run("PositionalArgs", func(t *testing.T) {
+		n := mustParseAction(t, "AdjustPaneSize(Down, 1)")
+		assertEqual(t, "Name", n.Name, "AdjustPaneSize")
+		if len(n.Args) != 2 {
+			t.Fatalf("expected 2 args, got %d", len(n.Args))
+		}
+		assertEqual(t, "Arg0", n.Args[0].Name, "Down")
+		assertEqual(t, "Arg1", n.Args[1].Value, "1")
+	})
+
+	t.Run("NestedStruct", func(t *testing.T) {
+		n := mustParseAction(t, "CopyMode(JumpBackward { prev_char: false })")
+		assertEqual(t, "Name", n.Name, "CopyMode")
+		inner, _ := n.Arg(0)
+		if inner.Kind != NodeStruct {
+			t.Fatalf("expected NodeStruct, got %d", inner.Kind)
+		}
+		assertEqual(t, "Inner", inner.Name, "JumpBackward")
+		v, ok := inner.Field("prev_char")
+		if !ok {
+			t.Fatal("expected prev_char field")
+		}
+		assertEqual(t, "prev_char", v.Name, "false")
+	})
+
+	t.Run("StringEscapes", func(t *testing.T) {
+		n := mustParseAction(t, `SendString("\n\"quoted\"\t\u{a5}")`)
+		arg, _ := n.Arg(0)
+		assertEqual(t, "Value", arg.Value, "\n\"quoted\"\t¥")
+	})
+
+	t.Run("Bitflags", func(t *testing.T) {
+		n := mustParseAction(t, "SendKey(KeyNoAction { key: Char('b'), mods: SHIFT | CTRL })")
+		inner, _ := n.Arg(0)
+		k, _ := inner.Field("key")
+		c, _ := k.Arg(0)
+		if c.Kind != NodeChar {
+			t.Errorf("expected NodeChar, got %d", c.Kind)
+		}
+		assertEqual(t, "key", c.Value, "b")
+		mods, _ := inner.Field("mods")
+		assertEqual(t, "mods", mods.Name, "SHIFT | CTRL")
+	})
+
+	t.Run("Multiple", func(t *testing.T) {
+		n := mustParseAction(t, `Multiple([SendString("a"), ActivateKeyTable { name: "resize_pane", one_shot: false, until_unknown: false, prevent_fallback: false, timeout_milliseconds: None, replace_current: false }])`)
+		assertEqual(t, "Name", n.Name, "Multiple")
+		list, _ := n.Arg(0)
+		if list.Kind != NodeList || len(list.Args) != 2 {
+			t.Fatalf("expected list of 2, got %d items", len(list.Args))
+		}
+		name, _ := list.Args[1].Field("name")
+		assertEqual(t, "name", name.Value, "resize_pane")
+
+		var names []string
+		n.Walk(func(c Node) bool {
+			if c.Kind == NodeCall || c.Kind == NodeStruct {
+				names = append(names, c.Name)
+			}
+			return true
+		})
+		assertEqual(t, "Walk", strings.Join(names, ","), "Multiple,SendString,ActivateKeyTable")
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		n := mustParseAction(t, `SpawnCommandInNewTab(SpawnCommand { args: Some(["top"]), set_environment_variables: {"FOO": "bar"}, domain: DefaultDomain })`)
+		inner, _ := n.Arg(0)
+		env, _ := inner.Field("set_environment_variables")
+		foo, ok := env.Field("FOO")
+		if !ok {
+			t.Fatal("expected FOO field")
+		}
+		assertEqual(t, "FOO", foo.Value, "bar")
+	})
+
+	t.Run("NonExhaustive", func(t *testing.T) {
+		s := "SplitHorizontal(SpawnCommand { domain: CurrentPaneDomain, .. })"
+		n := mustParseAction(t, s)
+		assertEqual(t, "Name", n.Name, "SplitHorizontal")
+		inner, _ := n.Arg(0)
+		if !inner.Partial || len(inner.Fields) != 1 {
+			t.Errorf("expected a partial struct with 1 field, got %+v", inner)
+		}
+		assertEqual(t, "String", n.String(), s)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, s := range []string{"", "Foo(", "Foo { a }", "Foo { .. , a: 1 }", `SendString("x)`, "Foo) bar"} {
+			if _, err := ParseAction(s); err == nil {
+				t.Errorf("%q: expected error", s)
+			}
+		}
+	})
+}
+
+func TestParseActionTree(t *testing.T) {
+	result := Parse(testInput)
+	assertEqual(t, "ActionName", result.Bindings[4].ActionName(), "AdjustPaneSize")
+	assertEqual(t, "ActionName", result.Bindings[11].ActionName(), "CopyMode")
+	assertEqual(t, "ActionName", result.Bindings[3].ActionName(), "ToggleFullScreen")
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ text, lua string }{
+		{"ScrollByPage(NotNan(-1.0))", "ScrollByPage(-1)"},
+		{"CopyMode(SetSelectionMode(Some(Block)))", "CopyMode(SetSelectionMode(Block))"},
+		{"CopyMode(JumpBackward { prev_char: false })", "CopyMode(JumpBackward { prev_char: false })"},
+		{"SplitHorizontal(SpawnCommand { domain: CurrentPaneDomain, .. })", "SplitHorizontal { domain: CurrentPaneDomain }"},
+		{
+			"CharSelect(CharSelectArguments { group: None, copy_on_select: true, copy_to: ClipboardAndPrimarySelection })",
+			"CharSelect { copy_to: ClipboardAndPrimarySelection, copy_on_select: true }",
+		},
+		{"PaneSelect(PaneSelectArguments { alphabet: None })", "PaneSelect()"},
+	}
+	for _, tt := range tests {
+		text := mustParseAction(t, tt.text).Normalize().String()
+		lua := mustParseAction(t, tt.lua).Normalize().String()
+		if text != lua {
+			t.Errorf("%s: normalized to %s, but %s to %s", tt.text, text, tt.lua, lua)
+		}
+	}
+	if got := mustParseAction(t, "ActivateTab(1)").Normalize().String(); got == mustParseAction(t, "ActivateTab(2)").Normalize().String() {
+		t.Errorf("different arguments normalized to the same %s", got)
+	}
+}
+
+func mustParseAction(t *testing.T, s string) Node {
+	t.Helper()
+	n, err := ParseAction(s)
+	if err != nil {
+		t.Fatalf("ParseAction(%q): %v", s, err)
+	}
+	return n
+}
+
+func TestParseMouse(t *testing.T) {
+	result := Parse(testInput)
+
+	t.Run("Event", func(t *testing.T) {
+		b := result.Bindings[17]
+		if b.Mouse == nil {
+			t.Fatal("expected Mouse to be parsed")
+		}
+		assertEqual(t, "Kind", b.Mouse.Kind.String(), "Down")
+		assertEqual(t, "Button", b.Mouse.Button, "Left")
+		if b.Mouse.Streak != 1 {
+			t.Errorf("Streak: got %d, want 1", b.Mouse.Streak)
+		}
+		assertEqual(t, "Context", b.Mouse.Context.String(), "normal")
+	})
+
+	t.Run("Drag", func(t *testing.T) {
+		b := result.Bindings[20]
+		assertEqual(t, "Kind", b.Mouse.Kind.String(), "Drag")
+	})
+
+	t.Run("AltScreen", func(t *testing.T) {
+		b := result.Bindings[21]
+		assertEqual(t, "Context", b.Mouse.Context.String(), "alt_screen")
+	})
+
+	t.Run("KeyTablesHaveNoMouse", func(t *testing.T) {
+		if result.Bindings[0].Mouse != nil {
+			t.Error("expected key binding to have no Mouse")
+		}
+	})
+}
+
+func TestParseMouseEvent(t *testing.T) {
+	ev, err := ParseMouseEvent("Up { streak: 3, button: WheelUp(1) }", "Mouse: alt_screen, mouse_reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "Kind", ev.Kind.String(), "Up")
+	assertEqual(t, "Button", ev.Button, "WheelUp(1)")
+	if ev.Streak != 3 {
+		t.Errorf("Streak: got %d, want 3", ev.Streak)
+	}
+	assertEqual(t, "Context", ev.Context.String(), "alt_screen, mouse_reporting")
+
+	if _, err := ParseMouseEvent("Click { streak: 1, button: Left }", "Mouse"); err == nil {
+		t.Error("expected error for unknown event kind")
+	}
+}
+
+const malformedInput = `Leader: ??? 2.001s
+Default key table
+-----------------
+
+	CTRL   Tab   ->   ActivateTabRelative(1)
+	CTRL   Enter => ToggleFullScreen
+Some new wezterm header
+	SHIFT  Tab   ->   ActivateTabRelative(-1)
+`
+
+func TestParseDiagnostics(t *testing.T) {
+	result := Parse(malformedInput)
+
+	if result.Leader != nil {
+		t.Error("expected malformed Leader to be skipped")
+	}
+	if len(result.Bindings) != 2 {
+		t.Errorf("expected 2 bindings, got %d", len(result.Bindings))
+	}
+	if len(result.Diagnostics) != 3 {
+		t.Fatalf("expected 3 diagnostics, got %d: %v", len(result.Diagnostics), result.Diagnostics)
+	}
+
+	expected := []struct {
+		line   int
+		reason string
+	}{
+		{1, "malformed leader line"},
+		{6, "missing '->' separator"},
+		{7, "unrecognized line"},
+	}
+	for i, e := range expected {
+		d := result.Diagnostics[i]
+		if d.Line != e.line {
+			t.Errorf("diagnostic[%d]: line: got %d, want %d", i, d.Line, e.line)
+		}
+		assertEqual(t, "Reason", d.Reason, e.reason)
+	}
+	assertEqual(t, "Text", result.Diagnostics[2].Text, "Some new wezterm header")
+}
+
+func TestParseStrict(t *testing.T) {
+	if _, err := ParseStrict(testInput); err != nil {
+		t.Errorf("expected no error for valid input, got %v", err)
+	}
+
+	result, err := ParseStrict(malformedInput)
+	if err == nil {
+		t.Fatal("expected error for malformed input")
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *ParseError, got %T", err)
+	}
+	if len(perr.Diagnostics) != 3 {
+		t.Errorf("expected 3 diagnostics in error, got %d", len(perr.Diagnostics))
+	}
+	if len(result.Bindings) != 2 {
+		t.Errorf("expected partial result with 2 bindings, got %d", len(result.Bindings))
+	}
+}
+
+func TestParseReaderCRLF(t *testing.T) {
+	input := strings.ReplaceAll(testInput, "\n", "\r\n")
+	result, err := ParseReader(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 23 {
+		t.Errorf("expected 23 bindings, got %d", len(result.Bindings))
+	}
+	if len(result.Diagnostics) != 0 {
+		t.Errorf("expected no diagnostics, got %v", result.Diagnostics)
+	}
+	assertEqual(t, "Table", result.Tables[0], "Default")
+	assertEqual(t, "Action", result.Bindings[0].Action, "ActivateTabRelative(1)")
+}
+
+func TestParseReaderLongLine(t *testing.T) {
+	long := strings.Repeat("x", 1<<20)
+	input := "Default key table\n\tCTRL   Tab   ->   SendString(\"" + long + "\")\n"
+	result, err := ParseReader(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 1 {
+		t.Fatalf("expected 1 binding, got %d", len(result.Bindings))
+	}
+	arg, _ := result.Bindings[0].ActionTree.Arg(0)
+	if len(arg.Value) != len(long) {
+		t.Errorf("expected %d byte string, got %d", len(long), len(arg.Value))
+	}
+}
+
+func TestParseReaderFunc(t *testing.T) {
+	var seen []string
+	result, err := ParseReaderFunc(context.Background(), strings.NewReader(testInput), func(b Keybinding) error {
+		seen = append(seen, b.Table)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(result.Bindings) {
+		t.Errorf("expected callback for every binding: got %d, want %d", len(seen), len(result.Bindings))
+	}
+
+	stop := errors.New("stop")
+	result, err = ParseReaderFunc(context.Background(), strings.NewReader(testInput), func(b Keybinding) error {
+		if b.Table == "copy_mode" {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected callback error, got %v", err)
+	}
+	if len(result.Bindings) != 8 {
+		t.Errorf("expected parsing to stop after 8 bindings, got %d", len(result.Bindings))
+	}
+}
+
+func TestParseReaderCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	result, err := ParseReaderFunc(ctx, strings.NewReader(testInput), func(b Keybinding) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(result.Bindings) != 1 {
+		t.Errorf("expected 1 binding before cancellation, got %d", len(result.Bindings))
+	}
+}
+
+func TestLeaderChord(t *testing.T) {
+	result := Parse(leaderInput)
+	l := result.Leader
+	if l == nil {
+		t.Fatal("expected Leader to be parsed")
+	}
+	assertEqual(t, "Chord", l.Chord.String(), "CTRL+b")
+	assertEqual(t, "Names", strings.Join(l.Mods.Names(), ","), "CTRL")
+
+	b := result.Bindings[1] // SHIFT | LEADER %
+	if !b.UsesLeader() {
+		t.Fatal("expected binding to use the leader")
+	}
+	seq := l.Sequence(b)
+	if len(seq) != 2 {
+		t.Fatalf("expected 2 chords, got %d", len(seq))
+	}
+	assertEqual(t, "First", seq[0].String(), "CTRL+b")
+	assertEqual(t, "Second", seq[1].String(), "SHIFT+%")
+
+	plain := result.Bindings[4] // SUPER t
+	if plain.UsesLeader() {
+		t.Error("expected binding not to use the leader")
+	}
+	if seq := l.Sequence(plain); len(seq) != 1 || seq[0].String() != "SUPER+t" {
+		t.Errorf("expected only the binding's own chord, got %v", seq)
+	}
+}
+
+func TestLeaderMicroseconds(t *testing.T) {
+	result := Parse("Leader: Char('a') CTRL 1.5µs\n")
+	if result.Leader == nil {
+		t.Fatal("expected Leader to be parsed")
+	}
+	if result.Leader.Timeout != 1500*time.Nanosecond {
+		t.Errorf("Timeout: got %v, want 1.5µs", result.Leader.Timeout)
+	}
+	if d := Parse("Leader: Char('a') CTRL soon\n").Diagnostics; len(d) != 1 || d[0].Reason != "malformed leader timeout" {
+		t.Errorf("expected malformed timeout diagnostic, got %v", d)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	if f := DetectFormat(testInput); f != FormatText {
+		t.Errorf("expected text, got %s", f)
+	}
+	if f := DetectFormat("\n\nlocal wezterm = require 'wezterm'\n"); f != FormatLua {
+		t.Errorf("expected lua, got %s", f)
+	}
+	if f := DetectFormat("return {\n  keys = {},\n}\n"); f != FormatLua {
+		t.Errorf("expected lua, got %s", f)
+	}
+}
+
+func TestParseLua(t *testing.T) {
+	result := Parse(readTestdata(t, "crosscheck.lua"))
+
+	if result.Format != FormatLua {
+		t.Errorf("expected lua format, got %s", result.Format)
+	}
+	if len(result.Diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics, got %v", result.Diagnostics)
+	}
+	expected := []string{"Default", "copy_mode", "search_mode"}
+	assertEqual(t, "Tables", strings.Join(result.Tables, ","), strings.Join(expected, ","))
+	if result.Leader == nil || result.Leader.Timeout != time.Second {
+		t.Fatalf("expected 1s leader, got %+v", result.Leader)
+	}
+	assertEqual(t, "Leader", result.Leader.Chord.String(), "CTRL+a")
+
+	b := result.Bindings[6]
+	if b.Key.Kind != KeyPhys {
+		t.Errorf("expected phys key, got %s", b.Key.Kind)
+	}
+	assertEqual(t, "Key", b.Key.String(), "phys:Space")
+}
+
+func TestParseLuaMatchesText(t *testing.T) {
+	text := Parse(readTestdata(t, "crosscheck.txt"))
+	lua := Parse(readTestdata(t, "crosscheck.lua"))
+
+	if len(text.Bindings) != len(lua.Bindings) {
+		t.Fatalf("binding count: text %d, lua %d", len(text.Bindings), len(lua.Bindings))
+	}
+	for i := range text.Bindings {
+		tb, lb := text.Bindings[i], lua.Bindings[i]
+		name := fmt.Sprintf("binding[%d] %s", i, tb.Action)
+		assertEqual(t, name+" Table", lb.Table, tb.Table)
+		assertEqual(t, name+" Modifiers", lb.Modifiers.String(), tb.Modifiers.String())
+		assertEqual(t, name+" Key", lb.Key.String(), tb.Key.String())
+		assertEqual(t, name+" Action", lb.Action, tb.ActionTree.String())
+	}
+	assertEqual(t, "Leader", lua.Leader.Chord.String(), text.Leader.Chord.String())
+}
+
+func TestParseLuaMouseAndDiagnostics(t *testing.T) {
+	result, err := ParseLua(context.Background(), "return {\n  keys = = {},\n}\n")
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Line != 2 {
+		t.Errorf("expected 1 diagnostic on line 2 for the syntax error, got %v", result.Diagnostics)
+	}
+
+	input := `local wezterm = require 'wezterm'
+local act = wezterm.action
+return {
+  keys = {
+    { key = 'x', mods = 'CTRL', action = 42 },
+    { mods = 'CTRL', action = act.Nop },
+    { key = 'y', mods = 'CTRL', action = act.EmitEvent 'MyEvent' },
+    { key = 'z', mods = 'CTRL', action = wezterm.action_callback(function(window, pane) end) },
+  },
+  mouse_bindings = {
+    { event = { Down = { streak = 2, button = 'Left' } }, mods = 'NONE', action = act.SelectTextAtMouseCursor 'Word' },
+  },
+}
+`
+	result, err = ParseLua(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %v", result.Diagnostics)
+	}
+	assertEqual(t, "Reason", result.Diagnostics[0].Reason, "action is a number, not a wezterm action")
+	if result.Diagnostics[0].Line != 5 {
+		t.Errorf("expected diagnostic on line 5, got %d", result.Diagnostics[0].Line)
+	}
+	assertEqual(t, "Text", result.Diagnostics[0].Text, "{ key = 'x', mods = 'CTRL', action = 42 },")
+	assertEqual(t, "Reason", result.Diagnostics[1].Reason, "binding has no key")
+
+	assertEqual(t, "EmitEvent", result.Bindings[0].Action, `EmitEvent("MyEvent")`)
+	assertEqual(t, "action_callback", result.Bindings[1].Action, `EmitEvent("user-defined-0")`)
+
+	m := result.Bindings[2]
+	assertEqual(t, "Table", m.Table, "Mouse")
+	if m.Mouse == nil {
+		t.Fatal("expected mouse event")
+	}
+	assertEqual(t, "Button", m.Mouse.Button, "Left")
+	if m.Mouse.Streak != 2 {
+		t.Errorf("expected streak 2, got %d", m.Mouse.Streak)
+	}
+}
+
+func readTestdata(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// TestSyntheticCorpus parses hand-written fixtures named after the
+// release whose layout they follow, see testdata/synthetic/README.
+func TestSyntheticCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "synthetic", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("expected fixtures in testdata/synthetic")
+	}
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(version, func(t *testing.T) {
+			input, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer input.Close()
+
+			result, err := ParseReaderOptions(context.Background(), input, Options{Version: version})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Diagnostics) != 0 {
+				t.Errorf("expected no diagnostics, got %v", result.Diagnostics)
+			}
+			assertEqual(t, "Version", result.Version, version)
+			if want := DialectForVersion(version); result.Dialect != want {
+				t.Errorf("Dialect: got %v, want %v", result.Dialect, want)
+			}
+			if len(result.Bindings) == 0 {
+				t.Error("expected bindings")
+			}
+			for _, b := range result.Bindings {
+				if IsMouseTable(b.Table) && b.Mouse == nil {
+					t.Errorf("unparsed mouse trigger %q", b.Key.Raw)
+				}
+				if b.Key.Kind == KeyChar && b.Key.Name == b.Key.Raw && len(b.Key.Raw) > 1 {
+					t.Errorf("unexpected key %q", b.Key.Raw)
+				}
+			}
+		})
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, ok := ParseVersion("wezterm 20240203-110809-5046fc22\n")
+	if !ok {
+		t.Fatal("expected version")
+	}
+	assertEqual(t, "Version", v, "20240203-110809-5046fc22")
+	if _, ok := ParseVersion("wezterm 0-unknown"); ok {
+		t.Error("expected no version for dev builds")
+	}
+	if d := DialectForVersion("20240520-135708-b8f94c47"); d != DialectModern {
+		t.Errorf("expected modern, got %v", d)
+	}
+	if d := DialectForVersion("unknown"); d != nil {
+		t.Errorf("expected nil, got %v", d)
+	}
+}
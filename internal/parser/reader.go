@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ParseReader parses show-keys output from r line by line. Lines may end
+// in "\n" or "\r\n" and have no length limit. Parsing stops early with
+// the context's error if ctx is cancelled; the bindings read so far are
+// returned alongside it.
+//
+// The format is detected from the start of the input; output of
+// "show-keys --lua" is read in full and handed to ParseLua.
+func ParseReader(ctx context.Context, r io.Reader) (ParseResult, error) {
+	return ParseReaderFunc(ctx, r, nil)
+}
+
+// ParseReaderFunc is like ParseReader but calls fn for every binding as
+// soon as it has been parsed. If fn returns an error, parsing stops and
+// that error is returned.
+func ParseReaderFunc(ctx context.Context, r io.Reader, fn func(Keybinding) error) (ParseResult, error) {
+	return ParseReaderOptions(ctx, r, Options{OnBinding: fn})
+}
+
+// Options configures ParseReaderOptions.
+type Options struct {
+	// Version is the wezterm version that produced the input, as printed
+	// by "wezterm --version". When set, it is recorded on the result and
+	// a text dialect that contradicts it is reported as a diagnostic.
+	Version string
+	// OnBinding, if set, is called for every binding as soon as it has
+	// been parsed. If it returns an error, parsing stops.
+	OnBinding func(Keybinding) error
+}
+
+// ParseReaderOptions is like ParseReader with additional options.
+func ParseReaderOptions(ctx context.Context, r io.Reader, opts Options) (ParseResult, error) {
+	fn := opts.OnBinding
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(4096); DetectFormat(string(head)) == FormatLua {
+		result, err := parseLuaReader(ctx, br, fn)
+		result.Version = opts.Version
+		return result, err
+	}
+
+	p := newLineParser(opts.Version)
+	for lineNo := 1; ; lineNo++ {
+		if err := ctx.Err(); err != nil {
+			return p.result, err
+		}
+
+		line, readErr := br.ReadString('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return p.result, readErr
+		}
+		if line == "" && readErr != nil {
+			break
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if b, ok := p.feed(lineNo, line); ok && fn != nil {
+			if err := fn(b); err != nil {
+				return p.result, err
+			}
+		}
+
+		if readErr != nil {
+			break
+		}
+	}
+	return p.result, nil
+}
+
+func parseLuaReader(ctx context.Context, r io.Reader, fn func(Keybinding) error) (ParseResult, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return ParseResult{Format: FormatLua}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return ParseResult{Format: FormatLua}, err
+	}
+	result, err := ParseLua(ctx, string(input))
+	if err != nil || fn == nil {
+		return result, err
+	}
+	for _, b := range result.Bindings {
+		if err := fn(b); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
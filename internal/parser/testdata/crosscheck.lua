@@ -0,0 +1,32 @@
+local wezterm = require 'wezterm'
+local act = wezterm.action
+
+return {
+  leader = { key = 'a', mods = 'CTRL', timeout_milliseconds = 1000 },
+  keys = {
+    { key = 'Tab', mods = 'CTRL', action = act.ActivateTabRelative(1) },
+    { key = 'Tab', mods = 'SHIFT|CTRL', action = act.ActivateTabRelative(-1) },
+    { key = 'Enter', mods = 'SHIFT', action = act.SendString '\n' },
+    { key = 'Enter', mods = 'ALT', action = act.ToggleFullScreen },
+    { key = 'C', mods = 'SHIFT|CTRL', action = act.CopyTo 'Clipboard' },
+    { key = 'LeftArrow', mods = 'SHIFT|ALT|CTRL', action = act.AdjustPaneSize{ 'Left', 1 } },
+    { key = 'phys:Space', mods = 'SHIFT|CTRL', action = act.QuickSelect },
+    { key = 'c', mods = 'LEADER', action = act.SpawnTab 'CurrentPaneDomain' },
+    { key = 'Copy', mods = 'NONE', action = act.CopyTo 'Clipboard' },
+  },
+
+  key_tables = {
+    copy_mode = {
+      { key = 'Tab', mods = 'NONE', action = act.CopyMode 'MoveForwardWord' },
+      { key = 'Escape', mods = 'NONE', action = act.CopyMode 'Close' },
+      { key = 'F', mods = 'NONE', action = act.CopyMode{ JumpBackward = { prev_char = false } } },
+      { key = 'u', mods = 'CTRL', action = act.CopyMode{ MoveByPage = (-0.5) } },
+    },
+
+    search_mode = {
+      { key = 'Enter', mods = 'NONE', action = act.CopyMode 'PriorMatch' },
+      { key = 'n', mods = 'CTRL', action = act.CopyMode 'NextMatch' },
+    },
+
+  }
+}
@@ -0,0 +1,129 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Rule names of the findings of required and forbidden bindings. The
+// findings of a Rule carry its own name.
+const (
+	RuleRequired  = "required"
+	RuleForbidden = "forbidden"
+)
+
+// Check returns the ways result violates the policy on the operating
+// system goos, named as in GOOS. Entries limited to another system are
+// skipped.
+func (p *Policy) Check(result parser.ParseResult, goos string) []lint.Finding {
+	var findings []lint.Finding
+	for _, req := range p.Required {
+		if !applies(req.OS, goos) {
+			continue
+		}
+		i, ok := lookup(result.Bindings, req.Table, req.chord)
+		switch {
+		case !ok && req.Action == "":
+			findings = append(findings, req.finding(RuleRequired, -1, fmt.Sprintf("%s must be bound", req.chord)))
+		case !ok:
+			findings = append(findings, req.finding(RuleRequired, -1,
+				fmt.Sprintf("%s must be bound to %s, but is not bound", req.chord, req.Action)))
+		case !req.action.match(result.Bindings[i]):
+			b := result.Bindings[i]
+			findings = append(findings, req.finding(RuleRequired, i,
+				fmt.Sprintf("%s must be bound to %s, but is bound to %s", b.Chord(), req.Action, b.Action)))
+		}
+	}
+	for _, fb := range p.Forbidden {
+		if !applies(fb.OS, goos) {
+			continue
+		}
+		if i, ok := lookup(result.Bindings, fb.Table, fb.chord); ok {
+			b := result.Bindings[i]
+			findings = append(findings, fb.finding(RuleForbidden, i,
+				fmt.Sprintf("%s must not be bound, but is bound to %s", b.Chord(), b.Action)))
+		}
+	}
+	for _, r := range p.Rules {
+		if applies(r.OS, goos) {
+			findings = append(findings, r.check(result)...)
+		}
+	}
+	return findings
+}
+
+func applies(os, goos string) bool {
+	return os == "" || os == goos
+}
+
+// lookup returns the index of the binding wezterm runs for chord c in
+// table, if any: a physical key is matched first, and otherwise the last
+// binding wins. A chord bound to DisableDefaultAssignment is not bound.
+func lookup(bindings []parser.Keybinding, table string, c parser.Chord) (int, bool) {
+	found := -1
+	for i, b := range bindings {
+		if b.Table != table || !analysis.SameKeystroke(b.Chord(), c) {
+			continue
+		}
+		if found < 0 || b.Key.Kind == parser.KeyPhys || bindings[found].Key.Kind != parser.KeyPhys {
+			found = i
+		}
+	}
+	if found < 0 || bindings[found].ActionName() == "DisableDefaultAssignment" {
+		return 0, false
+	}
+	return found, true
+}
+
+// finding reports a violation of b by binding i, or by the keymap as a
+// whole if i is negative.
+func (b Binding) finding(rule string, i int, msg string) lint.Finding {
+	f := lint.Finding{
+		Rule:     rule,
+		Severity: b.sev,
+		Table:    b.Table,
+		Chord:    b.chord.String(),
+		Message:  withReason(msg, b.Reason),
+	}
+	if i >= 0 {
+		f.Bindings = []int{i}
+	}
+	return f
+}
+
+func (r Rule) check(result parser.ParseResult) []lint.Finding {
+	var findings []lint.Finding
+	for i, b := range result.Bindings {
+		if b.ActionName() == "DisableDefaultAssignment" || !matches(r.table, b.Table) || !r.action.match(b) {
+			continue
+		}
+		var msg string
+		switch {
+		case !b.Modifiers.Has(r.require):
+			msg = fmt.Sprintf("%s is bound to %s without %s", b.Chord(), b.Action, r.require&^b.Modifiers)
+		case b.Modifiers&r.forbid != 0:
+			msg = fmt.Sprintf("%s is bound to %s with %s", b.Chord(), b.Action, b.Modifiers&r.forbid)
+		default:
+			continue
+		}
+		findings = append(findings, lint.Finding{
+			Rule:     r.Name,
+			Severity: r.sev,
+			Table:    b.Table,
+			Chord:    b.Chord().String(),
+			Message:  withReason(msg, r.Reason),
+			Bindings: []int{i},
+		})
+	}
+	return findings
+}
+
+func withReason(msg, reason string) string {
+	if reason == "" {
+		return msg
+	}
+	return msg + ": " + reason
+}
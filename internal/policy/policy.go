@@ -0,0 +1,250 @@
+// Package policy checks a keymap against a team's conventions, written
+// down in a JSON policy file: bindings that must stay as they are, chords
+// that must not be bound, and rules about the modifiers of bindings whose
+// action matches a pattern. For example:
+//
+//	{
+//	  "required": [
+//	    {"mods": "CTRL|SHIFT", "key": "c", "action": "CopyTo(Clipboard)"},
+//	    {"mods": "CTRL|SHIFT", "key": "v", "action": "PasteFrom(Clipboard)"}
+//	  ],
+//	  "forbidden": [
+//	    {"mods": "CTRL", "key": "q", "reason": "too close to CTRL+w"}
+//	  ],
+//	  "rules": [
+//	    {"name": "pane-leader", "table": "Default", "action": "*Pane*", "require_mods": "LEADER"},
+//	    {"name": "no-super", "os": "linux", "forbid_mods": "SUPER"}
+//	  ]
+//	}
+//
+// Violations are reported as lint findings, so they are printed and
+// counted the same way.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Policy is a set of conventions a keymap must follow.
+type Policy struct {
+	// Required lists bindings that must be in the keymap.
+	Required []Binding `json:"required"`
+	// Forbidden lists chords that must not be bound.
+	Forbidden []Binding `json:"forbidden"`
+	Rules     []Rule    `json:"rules"`
+}
+
+// Binding is a required or forbidden chord.
+type Binding struct {
+	// Table is the key table the chord is looked up in; Default if empty.
+	Table string `json:"table,omitempty"`
+	Mods  string `json:"mods,omitempty"`
+	Key   string `json:"key"`
+	// Action is a pattern the action of a required binding must match,
+	// as in Rule. Any action will do if it is empty.
+	Action string `json:"action,omitempty"`
+	// OS limits the entry to one operating system.
+	OS       string `json:"os,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	Severity string `json:"severity,omitempty"`
+
+	chord  parser.Chord
+	action actionPattern
+	sev    lint.Severity
+}
+
+// Rule constrains the modifiers of the bindings it applies to.
+type Rule struct {
+	Name string `json:"name"`
+	// Table and Action select the bindings the rule applies to, with
+	// patterns in which * stands for any text and ? for one character.
+	// Action is matched against the name of the action, e.g.
+	// ActivatePaneDirection, or against the whole action as show-keys
+	// prints it if it has arguments, e.g. CopyTo(Clipboard). An empty
+	// pattern matches all.
+	Table  string `json:"table,omitempty"`
+	Action string `json:"action,omitempty"`
+	// OS limits the rule to one operating system.
+	OS string `json:"os,omitempty"`
+	// RequireMods are modifiers the bindings must hold, and ForbidMods
+	// modifiers they must not.
+	RequireMods string `json:"require_mods,omitempty"`
+	ForbidMods  string `json:"forbid_mods,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+
+	table   *regexp.Regexp
+	action  actionPattern
+	require parser.Modifiers
+	forbid  parser.Modifiers
+	sev     lint.Severity
+}
+
+// systems are the operating systems an entry can be limited to, named as
+// in GOOS. macos is accepted for darwin.
+var systems = []string{"linux", "darwin", "windows", "freebsd", "netbsd", "openbsd"}
+
+// Load reads a policy file.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a policy. Unknown fields are rejected, so
+// that a misspelled one is not silently ignored.
+func Parse(data []byte) (*Policy, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	for i := range p.Required {
+		if err := p.Required[i].compile(); err != nil {
+			return nil, fmt.Errorf("policy: required entry %d: %w", i+1, err)
+		}
+	}
+	for i := range p.Forbidden {
+		if err := p.Forbidden[i].compile(); err != nil {
+			return nil, fmt.Errorf("policy: forbidden entry %d: %w", i+1, err)
+		}
+	}
+	for i := range p.Rules {
+		if err := p.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("policy: rule %d: %w", i+1, err)
+		}
+	}
+	return &p, nil
+}
+
+func (b *Binding) compile() error {
+	if b.Key == "" {
+		return errors.New("no key")
+	}
+	if b.Table == "" {
+		b.Table = "Default"
+	}
+	mods, err := parser.ParseModifiers(b.Mods)
+	if err != nil {
+		return err
+	}
+	b.chord = parser.Chord{Mods: mods, Key: parser.LuaKey(b.Key)}
+	if b.OS, err = system(b.OS); err != nil {
+		return err
+	}
+	if b.sev, err = severity(b.Severity); err != nil {
+		return err
+	}
+	b.action = newActionPattern(b.Action)
+	return nil
+}
+
+func (r *Rule) compile() error {
+	if r.Name == "" {
+		return errors.New("no name")
+	}
+	if r.RequireMods == "" && r.ForbidMods == "" {
+		return fmt.Errorf("%s: neither require_mods nor forbid_mods is set", r.Name)
+	}
+	var err error
+	if r.require, err = parser.ParseModifiers(r.RequireMods); err != nil {
+		return fmt.Errorf("%s: require_mods: %w", r.Name, err)
+	}
+	if r.forbid, err = parser.ParseModifiers(r.ForbidMods); err != nil {
+		return fmt.Errorf("%s: forbid_mods: %w", r.Name, err)
+	}
+	if r.OS, err = system(r.OS); err != nil {
+		return fmt.Errorf("%s: %w", r.Name, err)
+	}
+	if r.sev, err = severity(r.Severity); err != nil {
+		return fmt.Errorf("%s: %w", r.Name, err)
+	}
+	r.table = pattern(r.Table)
+	r.action = newActionPattern(r.Action)
+	return nil
+}
+
+func system(name string) (string, error) {
+	if name == "macos" {
+		name = "darwin"
+	}
+	if name != "" && !slices.Contains(systems, name) {
+		return "", fmt.Errorf("unknown os %q; want one of %s or macos", name, strings.Join(systems, ", "))
+	}
+	return name, nil
+}
+
+// severity parses the severity of an entry, which is an error unless
+// the policy says otherwise.
+func severity(name string) (lint.Severity, error) {
+	if name == "" {
+		return lint.SeverityError, nil
+	}
+	return lint.ParseSeverity(name)
+}
+
+// pattern compiles a pattern in which * stands for any text and ? for
+// one character. An empty pattern yields nil, which matches anything.
+func pattern(s string) *regexp.Regexp {
+	if s == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("(?s)^")
+	for _, r := range s {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func matches(re *regexp.Regexp, s string) bool {
+	return re == nil || re.MatchString(s)
+}
+
+// actionPattern matches actions, see Rule.Action.
+type actionPattern struct {
+	re    *regexp.Regexp
+	whole bool // match the whole action rather than its name
+}
+
+func newActionPattern(s string) actionPattern {
+	return actionPattern{re: pattern(s), whole: strings.ContainsAny(s, "({")}
+}
+
+func (p actionPattern) match(b parser.Keybinding) bool {
+	if p.whole {
+		return matches(p.re, b.Action)
+	}
+	// Take the name from the text, which also works for actions that
+	// could not be parsed into a tree.
+	name := b.Action
+	if i := strings.IndexAny(name, "({ "); i >= 0 {
+		name = name[:i]
+	}
+	return matches(p.re, name)
+}
@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+const keymap = `Default key table
+-----------------
+
+	SHIFT | CTRL         Char('C')          ->   CopyTo(Clipboard)
+	SHIFT | CTRL         Char('V')          ->   SendString("v")
+	SUPER                Char('t')          ->   SpawnTab(CurrentPaneDomain)
+	SUPER                Char('w')          ->   DisableDefaultAssignment
+	CTRL                 Char('q')          ->   QuitApplication
+	CTRL                 Char('s')          ->   DisableDefaultAssignment
+	LEADER               Char('h')          ->   ActivatePaneDirection(Left)
+	ALT                  Char('l')          ->   ActivatePaneDirection(Right)
+	LEADER               Char('r')          ->   ActivateKeyTable { name: "resize_pane", timeout_milliseconds: None, replace_current: false, one_shot: false, until_unknown: false, prevent_fallback: false }
+
+Key Table: resize_pane
+----------------------
+
+	        Char('h')    ->   AdjustPaneSize(Left, 1)
+	        Escape       ->   PopKeyTable
+
+`
+
+const teamPolicy = `{
+  "required": [
+    {"mods": "CTRL|SHIFT", "key": "c", "action": "CopyTo(Clipboard)"},
+    {"mods": "CTRL|SHIFT", "key": "v", "action": "PasteFrom(Clipboard)", "reason": "paste must work everywhere"},
+    {"mods": "CTRL", "key": "s"},
+    {"table": "resize_pane", "key": "Escape"}
+  ],
+  "forbidden": [
+    {"mods": "CTRL", "key": "q", "severity": "warning"},
+    {"mods": "CMD", "key": "w"}
+  ],
+  "rules": [
+    {"name": "pane-leader", "table": "Default", "action": "*Pane*", "require_mods": "LEADER"},
+    {"name": "no-super", "os": "linux", "forbid_mods": "SUPER", "reason": "SUPER belongs to the window manager"}
+  ]
+}`
+
+func TestCheck(t *testing.T) {
+	result := parser.Parse(keymap)
+	if len(result.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %v", result.Diagnostics)
+	}
+	p, err := Parse([]byte(teamPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, f := range p.Check(result, "linux") {
+		got = append(got, f.String())
+	}
+	want := []string{
+		`error: Default: SHIFT+CTRL+V must be bound to PasteFrom(Clipboard), but is bound to SendString("v"): paste must work everywhere [required]`,
+		"error: Default: CTRL+s must be bound [required]",
+		"warning: Default: CTRL+q must not be bound, but is bound to QuitApplication [forbidden]",
+		"error: Default: ALT+l is bound to ActivatePaneDirection(Right) without LEADER [pane-leader]",
+		"error: Default: SUPER+t is bound to SpawnTab(CurrentPaneDomain) with SUPER: SUPER belongs to the window manager [no-super]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	findings := p.Check(result, "darwin")
+	if len(findings) != 4 {
+		t.Errorf("expected the linux rule to be skipped on darwin, got %v", findings)
+	}
+	if f := findings[0]; len(f.Bindings) != 1 || f.Bindings[0] != 1 {
+		t.Errorf("expected the violation to point at binding 1, got %v", f.Bindings)
+	}
+	if f := findings[1]; f.Bindings != nil || f.Severity != lint.SeverityError {
+		t.Errorf("expected a missing binding to point at none, got %+v", f)
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, bad := range []string{
+		`{"required": [{"mods": "CTRL"}]}`,
+		`{"required": [{"mods": "HYPER", "key": "a"}]}`,
+		`{"forbidden": [{"key": "a", "os": "plan9"}]}`,
+		`{"forbidden": [{"key": "a", "severity": "fatal"}]}`,
+		`{"rules": [{"name": "empty", "action": "*"}]}`,
+		`{"rules": [{"action": "*", "forbid_mods": "SUPER"}]}`,
+		`{"rule": []}`,
+	} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+
+	p, err := Parse([]byte(`{"rules": [{"name": "mac", "os": "macos", "forbid_mods": "ALT"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rules[0].OS != "darwin" {
+		t.Errorf("expected macos to mean darwin, got %q", p.Rules[0].OS)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "anything", true},
+		{"*Pane*", "ActivatePaneDirection(Left)", true},
+		{"CopyTo(*)", "CopyTo(Clipboard)", true},
+		{"CopyTo(*)", "CopyTo", false},
+		{"Mouse: ?", "Mouse: a", true},
+		{"Default", "Default2", false},
+		{"SpawnCommandInNewTab*", `SpawnCommandInNewTab(SpawnCommand { args: Some(["/bin/sh"]) })`, true},
+	}
+	for _, tt := range tests {
+		if got := matches(pattern(tt.pattern), tt.s); got != tt.want {
+			t.Errorf("%q against %q: got %v", tt.pattern, tt.s, got)
+		}
+	}
+
+	b := parser.NewKeybinding("Default", parser.ModSuper, parser.LuaKey("t"), "SpawnTab(CurrentPaneDomain)")
+	for pat, want := range map[string]bool{"*Pane*": false, "SpawnTab": true, "SpawnTab(*Pane*)": true, "SpawnTab(CurrentPaneDomain)": true, "Spawn*": true} {
+		if got := newActionPattern(pat).match(b); got != want {
+			t.Errorf("%q against %s: got %v", pat, b.Action, got)
+		}
+	}
+
+	b = parser.NewKeybinding("Default", parser.ModCtrl, parser.LuaKey("s"), "SplitVertical(SpawnCommand { domain: CurrentPaneDomain, .. })")
+	if newActionPattern("*Pane*").match(b) || !newActionPattern("Split*").match(b) {
+		t.Errorf("expected an abbreviated action to match by its name")
+	}
+}
@@ -0,0 +1,184 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// cacheVersion is part of every cache key. Bump it whenever the parser
+// changes in a way that affects its results, so that entries written by
+// older releases are ignored.
+const cacheVersion = 1
+
+// cacheMaxAge is how long an unused cache entry is kept.
+const cacheMaxAge = 30 * 24 * time.Hour
+
+// Cacher is implemented by sources that can answer Load from a cache.
+// Viewers use it to show the cached keymap at once and revalidate it in
+// the background.
+type Cacher interface {
+	Source
+	// Lookup returns the cached keymap if there is a current one, and
+	// otherwise loads and caches it as Fresh does. cached reports which.
+	// fn, if not nil, is called for every binding of a fresh load as soon
+	// as it has been parsed, as with Streamer.
+	Lookup(ctx context.Context, fn func(parser.Keybinding) error) (result parser.ParseResult, cached bool, err error)
+	// Fresh loads the keymap bypassing the cache, and updates the cache.
+	Fresh(ctx context.Context) (parser.ParseResult, error)
+}
+
+// Cache serves the keymap of an Exec source from disk, so that the Lua
+// config does not have to be evaluated on every launch. Entries are
+// keyed by the content of the config files, the wezterm version and the
+// command line, so any change to them misses the cache.
+type Cache struct {
+	Exec Exec
+	// Dir holds the cache entries, see CacheDir.
+	Dir string
+}
+
+// CacheDir returns the default cache directory, $XDG_CACHE_HOME/wez-kv,
+// falling back to the platform's user cache directory.
+func CacheDir() (string, error) {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "wez-kv"), nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wez-kv"), nil
+}
+
+func (c Cache) String() string {
+	return c.Exec.String()
+}
+
+func (c Cache) Files() []string {
+	return c.Exec.Files()
+}
+
+// Load returns the cached keymap if it is current, and otherwise runs
+// wezterm and caches the result.
+func (c Cache) Load(ctx context.Context) (parser.ParseResult, error) {
+	result, _, err := c.Lookup(ctx, nil)
+	return result, err
+}
+
+// Lookup runs wezterm --version once to compute the cache key, and
+// passes the version on to the load on a miss.
+func (c Cache) Lookup(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, bool, error) {
+	version := c.Exec.Version(ctx)
+	key := c.key(version)
+	if result, ok := c.read(key); ok {
+		return result, true, nil
+	}
+	result, err := c.fresh(ctx, version, key, fn)
+	return result, false, err
+}
+
+func (c Cache) Fresh(ctx context.Context) (parser.ParseResult, error) {
+	version := c.Exec.Version(ctx)
+	return c.fresh(ctx, version, c.key(version), nil)
+}
+
+func (c Cache) fresh(ctx context.Context, version, key string, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	result, err := c.Exec.load(ctx, version, fn)
+	if err != nil {
+		return result, err
+	}
+	// A cache that cannot be written only costs speed.
+	_ = c.store(key, result)
+	return result, nil
+}
+
+func (c Cache) read(key string) (parser.ParseResult, bool) {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		return parser.ParseResult{}, false
+	}
+	defer f.Close()
+	result, err := ReadSnapshot(f)
+	if err != nil {
+		return parser.ParseResult{}, false
+	}
+	return result, true
+}
+
+// key hashes everything the show-keys output depends on: the wezterm
+// version, the command line and, for a local wezterm, its config files.
+func (c Cache) key(version string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "wez-kv cache %d\x00snapshot %d\x00", cacheVersion, snapshotVersion)
+	fmt.Fprintf(h, "version %s\x00", version)
+	fmt.Fprintf(h, "argv %s\x00", strings.Join(c.Exec.argv(), "\x00"))
+	for _, path := range c.Exec.Files() {
+		fmt.Fprintf(h, "file %s\x00", path)
+		if f, err := os.Open(path); err == nil {
+			_, _ = io.Copy(h, f)
+			f.Close()
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+".json")
+}
+
+// store writes an entry atomically and prunes entries unused for
+// cacheMaxAge.
+func (c Cache) store(key string, result parser.ParseResult) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, result); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.prune()
+	return nil
+}
+
+func (c Cache) prune() {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		if fi, err := e.Info(); err == nil && time.Since(fi.ModTime()) > cacheMaxAge {
+			os.Remove(filepath.Join(c.Dir, e.Name()))
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/sorafujitani/wez-kv/internal/lua"
+)
+
+// Watchable is implemented by sources whose keymap is derived from files
+// on disk, so that a viewer can reload when they change.
+type Watchable interface {
+	// Files lists the files the keymap depends on. It is called again
+	// after every change, since edits may add or remove dependencies.
+	Files() []string
+}
+
+// Files returns the resolved wezterm config file and the modules it
+// requires, as far as they can be found next to it. A remote wezterm
+// has no local files.
+func (e Exec) Files() []string {
+	if e.Remote {
+		return nil
+	}
+	path := e.ConfigFile
+	if path == "" {
+		path = DefaultConfigFile()
+	}
+	if path == "" {
+		return nil
+	}
+	return ConfigFiles(path)
+}
+
+func (f File) Files() []string {
+	return []string{f.Path}
+}
+
+func (s Snapshot) Files() []string {
+	return []string{s.Path}
+}
+
+// DefaultConfigFile returns the config file wezterm loads when no
+// --config-file is given: $WEZTERM_CONFIG_FILE, then
+// $XDG_CONFIG_HOME/wezterm/wezterm.lua, then ~/.wezterm.lua. It returns
+// "" if none of them exists.
+func DefaultConfigFile() string {
+	if path := os.Getenv("WEZTERM_CONFIG_FILE"); path != "" {
+		return path
+	}
+	var candidates []string
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "wezterm", "wezterm.lua"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates,
+			filepath.Join(home, ".config", "wezterm", "wezterm.lua"),
+			filepath.Join(home, ".wezterm.lua"))
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+var requireRe = regexp.MustCompile(`\brequire\s*\(?\s*["']([\w.\-/]+)["']`)
+
+// ConfigFiles returns path followed by the Lua modules it requires,
+// transitively. Modules are resolved the way wezterm sets up
+// package.path: relative to the config directory, as name.lua or
+// name/init.lua with dots turned into directories. Modules that cannot
+// be found, such as "wezterm" itself, are skipped.
+func ConfigFiles(path string) []string {
+	dir := filepath.Dir(path)
+	files := []string{path}
+	seen := map[string]bool{path: true}
+	for i := 0; i < len(files); i++ {
+		data, err := os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+		for _, m := range requireRe.FindAllStringSubmatch(string(data), -1) {
+			if path, ok := lua.ModulePath(dir, m[1]); ok && !seen[path] {
+				seen[path] = true
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
@@ -0,0 +1,173 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// snapshotVersion is bumped whenever the snapshot layout changes.
+const snapshotVersion = 1
+
+// snapshot is the JSON form of a ParseResult. Derived data such as the
+// action tree is not stored; it is rebuilt from the action text on load.
+type snapshot struct {
+	Version     int                 `json:"version"`
+	Wezterm     string              `json:"wezterm,omitempty"`
+	Format      string              `json:"format,omitempty"`
+	Dialect     string              `json:"dialect,omitempty"`
+	Leader      *snapshotLeader     `json:"leader,omitempty"`
+	Tables      []string            `json:"tables"`
+	Bindings    []snapshotBinding   `json:"bindings"`
+	Diagnostics []parser.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+type snapshotLeader struct {
+	Mods      string      `json:"mods,omitempty"`
+	Key       snapshotKey `json:"key"`
+	TimeoutMS int64       `json:"timeout_ms"`
+}
+
+type snapshotBinding struct {
+	Table string `json:"table"`
+	Mods  string `json:"mods,omitempty"`
+	// RawMods is the modifier list as the config spells it, see
+	// parser.Keybinding.RawModifiers.
+	RawMods string      `json:"raw_mods,omitempty"`
+	Key     snapshotKey `json:"key"`
+	Action  string      `json:"action"`
+}
+
+type snapshotKey struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	Raw  string `json:"raw"`
+}
+
+func toSnapshotKey(k parser.Key) snapshotKey {
+	return snapshotKey{Kind: k.Kind.String(), Name: k.Name, Raw: k.Raw}
+}
+
+func (k snapshotKey) key() (parser.Key, error) {
+	for kind := parser.KeyNamed; kind <= parser.KeyMouse; kind++ {
+		if kind.String() == k.Kind {
+			return parser.Key{Kind: kind, Name: k.Name, Raw: k.Raw}, nil
+		}
+	}
+	return parser.Key{}, fmt.Errorf("unknown key kind %q", k.Kind)
+}
+
+// Snapshot loads a keymap previously written by WriteSnapshot.
+type Snapshot struct {
+	Path string
+}
+
+func (s Snapshot) String() string {
+	return "snapshot " + s.Path
+}
+
+func (s Snapshot) Load(ctx context.Context) (parser.ParseResult, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	defer f.Close()
+	return ReadSnapshot(f)
+}
+
+// WriteSnapshot writes result as an indented JSON snapshot.
+func WriteSnapshot(w io.Writer, result parser.ParseResult) error {
+	snap := snapshot{
+		Version:     snapshotVersion,
+		Wezterm:     result.Version,
+		Format:      result.Format.String(),
+		Tables:      result.Tables,
+		Bindings:    make([]snapshotBinding, len(result.Bindings)),
+		Diagnostics: result.Diagnostics,
+	}
+	if result.Dialect != nil {
+		snap.Dialect = result.Dialect.Name
+	}
+	if l := result.Leader; l != nil {
+		snap.Leader = &snapshotLeader{
+			Mods:      l.Mods.String(),
+			Key:       toSnapshotKey(l.Key),
+			TimeoutMS: l.Timeout.Milliseconds(),
+		}
+	}
+	for i, b := range result.Bindings {
+		snap.Bindings[i] = snapshotBinding{
+			Table:   b.Table,
+			Mods:    b.Modifiers.String(),
+			RawMods: b.RawModifiers,
+			Key:     toSnapshotKey(b.Key),
+			Action:  b.Action,
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(snap)
+}
+
+// ReadSnapshot decodes a JSON snapshot written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (parser.ParseResult, error) {
+	var snap snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return parser.ParseResult{}, fmt.Errorf("snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return parser.ParseResult{}, fmt.Errorf("snapshot: unsupported version %d", snap.Version)
+	}
+
+	result := parser.ParseResult{
+		Version:     snap.Wezterm,
+		Tables:      snap.Tables,
+		Diagnostics: snap.Diagnostics,
+	}
+	if snap.Format != "" {
+		format, err := parser.ParseFormat(snap.Format)
+		if err != nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: %w", err)
+		}
+		result.Format = format
+	}
+	if snap.Dialect != "" {
+		if result.Dialect = parser.DialectByName(snap.Dialect); result.Dialect == nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: unknown dialect %q", snap.Dialect)
+		}
+	}
+	if l := snap.Leader; l != nil {
+		mods, err := parser.ParseModifiers(l.Mods)
+		if err != nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: leader: %w", err)
+		}
+		key, err := l.Key.key()
+		if err != nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: leader: %w", err)
+		}
+		result.Leader = &parser.Leader{
+			Chord:   parser.Chord{Mods: mods, Key: key},
+			Timeout: time.Duration(l.TimeoutMS) * time.Millisecond,
+		}
+	}
+	for i, b := range snap.Bindings {
+		mods, err := parser.ParseModifiers(b.Mods)
+		if err != nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: binding %d: %w", i, err)
+		}
+		key, err := b.Key.key()
+		if err != nil {
+			return parser.ParseResult{}, fmt.Errorf("snapshot: binding %d: %w", i, err)
+		}
+		kb := parser.NewKeybinding(b.Table, mods, key, b.Action)
+		kb.RawModifiers = b.RawMods
+		result.Bindings = append(result.Bindings, kb)
+	}
+	return result, nil
+}
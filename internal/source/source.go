@@ -0,0 +1,302 @@
+// Package source loads keymaps from wherever they come from: a running
+// wezterm, a saved show-keys dump, stdin or an exported JSON snapshot.
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// Source loads a keymap.
+type Source interface {
+	// Load reads and parses the keymap.
+	Load(ctx context.Context) (parser.ParseResult, error)
+	// String describes where the keymap comes from, e.g. "stdin".
+	String() string
+}
+
+// Streamer is implemented by sources that can hand out bindings while
+// the keymap is still being parsed, so that viewers can show them before
+// Load would return. Output of "show-keys --lua" and JSON snapshots are
+// read in full before the first binding is reported.
+type Streamer interface {
+	Source
+	// Stream is like Load but calls fn for every binding as soon as it
+	// has been parsed. If fn returns an error, loading stops.
+	Stream(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, error)
+}
+
+// Exec runs wezterm and parses its show-keys output.
+type Exec struct {
+	// Command runs wezterm, e.g. ["wezterm"], ["/opt/wezterm/bin/wezterm"]
+	// or ["ssh", "devbox", "wezterm"]. It may already contain the
+	// show-keys subcommand, as in ["wsl", "wezterm", "show-keys"]. It
+	// defaults to ["wezterm"].
+	Command []string
+	// ConfigFile is passed as --config-file when set.
+	ConfigFile string
+	// Overrides are passed as repeated --config name=value options.
+	Overrides []string
+	// SkipConfig passes -n, so that wezterm ignores the config file and
+	// reports its defaults.
+	SkipConfig bool
+	// Args are the subcommand and its flags, e.g. ["show-keys", "--lua"].
+	Args []string
+	// Remote is set when Command runs wezterm on another machine or in a
+	// container, as with "ssh devbox wezterm". Local config files then
+	// have nothing to do with the keymap.
+	Remote bool
+}
+
+func (e Exec) command() []string {
+	if len(e.Command) == 0 {
+		return []string{"wezterm"}
+	}
+	return e.Command
+}
+
+// argv returns the full command line. Global options go before the
+// show-keys subcommand, whether it comes from Command or Args.
+func (e Exec) argv() []string {
+	var global []string
+	if e.SkipConfig {
+		global = append(global, "-n")
+	}
+	if e.ConfigFile != "" {
+		global = append(global, "--config-file", e.ConfigFile)
+	}
+	for _, o := range e.Overrides {
+		global = append(global, "--config", o)
+	}
+
+	cmd := e.command()
+	i := slices.Index(cmd, "show-keys")
+	if i < 0 {
+		return slices.Concat(cmd, global, e.Args)
+	}
+	args := e.Args
+	if len(args) > 0 && args[0] == "show-keys" {
+		args = args[1:]
+	}
+	return slices.Concat(cmd[:i], global, cmd[i:], args)
+}
+
+// versionArgv returns the command that prints the wezterm version.
+func (e Exec) versionArgv() []string {
+	cmd := e.command()
+	if i := slices.Index(cmd, "show-keys"); i >= 0 {
+		cmd = cmd[:i]
+	}
+	return append(slices.Clone(cmd), "--version")
+}
+
+// Installed reports whether the wezterm command can be found.
+func (e Exec) Installed() bool {
+	_, err := exec.LookPath(e.command()[0])
+	return err == nil
+}
+
+// Version runs wezterm --version and returns the version string, or ""
+// if it cannot be determined.
+func (e Exec) Version(ctx context.Context) string {
+	argv := e.versionArgv()
+	out, err := exec.CommandContext(ctx, argv[0], argv[1:]...).Output()
+	if err != nil {
+		return ""
+	}
+	version, _ := parser.ParseVersion(string(out))
+	return version
+}
+
+func (e Exec) String() string {
+	argv := e.argv()
+	quoted := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t'\"") {
+			a = strconv.Quote(a)
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Load runs wezterm and parses its output as it streams in. The wezterm
+// version is recorded so that format changes between releases are
+// reported.
+func (e Exec) Load(ctx context.Context) (parser.ParseResult, error) {
+	return e.Stream(ctx, nil)
+}
+
+func (e Exec) Stream(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	return e.load(ctx, e.Version(ctx), fn)
+}
+
+// load runs wezterm, whose version is already known.
+func (e Exec) load(ctx context.Context, version string, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	opts := parser.Options{Version: version, OnBinding: fn}
+
+	argv := e.argv()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return parser.ParseResult{}, &ExecError{Command: e.String(), Err: err}
+	}
+
+	result, parseErr := parser.ParseReaderOptions(ctx, stdout, opts)
+	if parseErr != nil {
+		// Drain the pipe so wezterm is not blocked writing to it.
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return parser.ParseResult{}, &ExecError{Command: e.String(), Err: err, Stderr: stderr.String()}
+	}
+	return result, parseErr
+}
+
+// ExecError is returned when wezterm cannot be run or exits with an
+// error. Stderr holds what wezterm printed, such as a Lua config error.
+type ExecError struct {
+	Command string
+	Err     error
+	Stderr  string
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("failed to run '%s': %v", e.Command, e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// SplitCommand splits a command template such as
+// "ssh devbox wezterm show-keys" into words. Single and double quotes
+// group words; there is no other shell processing. The show-keys
+// subcommand must be a word of its own, since wezterm's options are
+// inserted before it: a quoted 'wezterm show-keys' is rejected.
+func SplitCommand(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command %q", quote, s)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	for _, w := range words {
+		if w != "show-keys" && slices.Contains(strings.Fields(w), "show-keys") {
+			return nil, fmt.Errorf("show-keys must be a word of its own in command %q, not part of %q", s, w)
+		}
+	}
+	return words, nil
+}
+
+// File reads a saved show-keys dump or JSON snapshot from disk.
+type File struct {
+	Path string
+}
+
+func (f File) String() string {
+	return f.Path
+}
+
+func (f File) Load(ctx context.Context) (parser.ParseResult, error) {
+	return f.Stream(ctx, nil)
+}
+
+func (f File) Stream(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return parser.ParseResult{}, err
+	}
+	defer file.Close()
+	return parse(ctx, file, fn)
+}
+
+// Stdin reads a show-keys dump or JSON snapshot piped into wkv, e.g.
+// "wezterm show-keys | wkv".
+type Stdin struct {
+	// Reader overrides os.Stdin, for tests.
+	Reader io.Reader
+}
+
+func (s Stdin) String() string {
+	return "stdin"
+}
+
+func (s Stdin) Load(ctx context.Context) (parser.ParseResult, error) {
+	return s.Stream(ctx, nil)
+}
+
+func (s Stdin) Stream(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	r := s.Reader
+	if r == nil {
+		r = os.Stdin
+	}
+	return parse(ctx, r, fn)
+}
+
+// StdinIsPiped reports whether stdin is a pipe or file rather than a
+// terminal, which means a dump is being piped into wkv.
+func StdinIsPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice == 0
+}
+
+// parse reads show-keys output in either format, or a JSON snapshot when
+// the input starts with "{". fn, if not nil, is called for every binding
+// of show-keys output as it is parsed.
+func parse(ctx context.Context, r io.Reader, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")) {
+		return ReadSnapshot(br)
+	}
+	return parser.ParseReaderFunc(ctx, br, fn)
+}
@@ -0,0 +1,466 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+const testInput = `Leader: Char('a') CTRL 1s
+Default key table
+-----------------
+
+	CTRL                 Tab                ->   ActivateTabRelative(1)
+	LEADER               Char('c')          ->   SpawnTab(CurrentPaneDomain)
+	SHIFT | CTRL         Phys(Space)        ->   QuickSelect
+
+Key Table: copy_mode
+--------------------
+
+	        Escape       ->   CopyMode(Close)
+
+Mouse
+-----
+
+	               Down { streak: 2, button: Left }     ->   SelectTextAtMouseCursor(Word)
+`
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFile(t *testing.T) {
+	path := writeTemp(t, "keys.txt", testInput)
+	src := File{Path: path}
+	result, err := src.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 5 {
+		t.Errorf("expected 5 bindings, got %d", len(result.Bindings))
+	}
+	if src.String() != path {
+		t.Errorf("expected String to be the path, got %q", src.String())
+	}
+
+	if _, err := (File{Path: filepath.Join(t.TempDir(), "missing")}).Load(context.Background()); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestStdin(t *testing.T) {
+	result, err := Stdin{Reader: strings.NewReader(testInput)}.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 5 {
+		t.Errorf("expected 5 bindings, got %d", len(result.Bindings))
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	_, err = Stdin{Reader: strings.NewReader(testInput)}.Stream(context.Background(), func(parser.Keybinding) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("expected the callback's error to stop loading after 1 binding, got %v after %d", err, n)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	original := parser.Parse(testInput)
+	original.Version = "20240203-110809-5046fc22"
+
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, original); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeTemp(t, "keys.json", buf.String())
+	for _, src := range []Source{Snapshot{Path: path}, File{Path: path}, Stdin{Reader: strings.NewReader(buf.String())}} {
+		t.Run(src.String(), func(t *testing.T) {
+			loaded, err := src.Load(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.Version != original.Version {
+				t.Errorf("Version: got %q, want %q", loaded.Version, original.Version)
+			}
+			if loaded.Format != original.Format || loaded.Dialect != original.Dialect {
+				t.Errorf("Format, Dialect: got %v, %v, want %v, %v", loaded.Format, loaded.Dialect, original.Format, original.Dialect)
+			}
+			if loaded.Leader == nil || loaded.Leader.Chord != original.Leader.Chord || loaded.Leader.Timeout != original.Leader.Timeout {
+				t.Errorf("Leader: got %+v, want %+v", loaded.Leader, original.Leader)
+			}
+			if strings.Join(loaded.Tables, ",") != strings.Join(original.Tables, ",") {
+				t.Errorf("Tables: got %v, want %v", loaded.Tables, original.Tables)
+			}
+			if len(loaded.Bindings) != len(original.Bindings) {
+				t.Fatalf("expected %d bindings, got %d", len(original.Bindings), len(loaded.Bindings))
+			}
+			for i, want := range original.Bindings {
+				got := loaded.Bindings[i]
+				if got.Chord() != want.Chord() || got.Action != want.Action || got.ActionName() != want.ActionName() {
+					t.Errorf("binding[%d]: got %+v, want %+v", i, got, want)
+				}
+				if (got.Mouse == nil) != (want.Mouse == nil) {
+					t.Errorf("binding[%d]: mouse event not restored", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSnapshotRoundTripLua(t *testing.T) {
+	original, err := parser.ParseLua(context.Background(), `local wezterm = require 'wezterm'
+return {
+  keys = {
+    { key = 'c', mods = 'CMD|SHIFT', action = wezterm.action.CopyTo 'Clipboard' },
+  },
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, original); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Format != parser.FormatLua || loaded.Dialect != nil {
+		t.Errorf("Format, Dialect: got %v, %v, want lua, nil", loaded.Format, loaded.Dialect)
+	}
+	if len(loaded.Bindings) != 1 || loaded.Bindings[0].RawModifiers != "CMD|SHIFT" {
+		t.Errorf("expected RawModifiers to be kept, got %+v", loaded.Bindings)
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	for _, s := range []string{`{"version": 1, "format": "xml"}`, `{"version": 1, "dialect": "ancient"}`} {
+		if _, err := ReadSnapshot(strings.NewReader(s)); err == nil {
+			t.Errorf("%s: expected error", s)
+		}
+	}
+}
+
+func TestReadSnapshotVersion(t *testing.T) {
+	if _, err := ReadSnapshot(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Error("expected error for unsupported snapshot version")
+	}
+}
+
+func TestExec(t *testing.T) {
+	dir := t.TempDir()
+	dump := writeTemp(t, "keys.txt", testInput)
+	script := `#!/bin/sh
+if [ "$1" = "--version" ]; then
+	echo "wezterm 20240203-110809-5046fc22"
+	exit 0
+fi
+cat "` + dump + `"
+`
+	bin := filepath.Join(dir, "wezterm")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := Exec{Command: []string{bin}, Args: []string{"show-keys"}}
+	result, err := src.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 5 {
+		t.Errorf("expected 5 bindings, got %d", len(result.Bindings))
+	}
+	if result.Version != "20240203-110809-5046fc22" {
+		t.Errorf("expected version to be recorded, got %q", result.Version)
+	}
+	if src.String() != bin+" show-keys" {
+		t.Errorf("unexpected String %q", src.String())
+	}
+
+	var streamed []parser.Keybinding
+	result, err = src.Stream(context.Background(), func(b parser.Keybinding) error {
+		streamed = append(streamed, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(streamed, result.Bindings, func(a, b parser.Keybinding) bool { return a.Action == b.Action }) {
+		t.Errorf("expected every binding to be streamed, got %d of %d", len(streamed), len(result.Bindings))
+	}
+
+	if _, err := (Exec{Command: []string{filepath.Join(dir, "missing")}}).Load(context.Background()); err == nil {
+		t.Error("expected error for missing binary")
+	}
+}
+
+func TestExecArgv(t *testing.T) {
+	cases := []struct {
+		name    string
+		exec    Exec
+		argv    string
+		version string
+	}{
+		{
+			name:    "Default",
+			exec:    Exec{Args: []string{"show-keys"}},
+			argv:    "wezterm show-keys",
+			version: "wezterm --version",
+		},
+		{
+			name: "ConfigAndOverrides",
+			exec: Exec{
+				Command:    []string{"/opt/wezterm/bin/wezterm"},
+				ConfigFile: "/home/me/.wezterm.lua",
+				Overrides:  []string{"leader={key='b'}", "enable_tab_bar=false"},
+				Args:       []string{"show-keys", "--lua"},
+			},
+			argv:    `/opt/wezterm/bin/wezterm --config-file /home/me/.wezterm.lua --config "leader={key='b'}" --config enable_tab_bar=false show-keys --lua`,
+			version: "/opt/wezterm/bin/wezterm --version",
+		},
+		{
+			name:    "TemplateWithSubcommand",
+			exec:    Exec{Command: []string{"ssh", "devbox", "wezterm", "show-keys"}, ConfigFile: "x.lua", Args: []string{"show-keys", "--lua"}},
+			argv:    "ssh devbox wezterm --config-file x.lua show-keys --lua",
+			version: "ssh devbox wezterm --version",
+		},
+		{
+			name:    "TemplatePrefix",
+			exec:    Exec{Command: []string{"wsl", "wezterm"}, Args: []string{"show-keys"}},
+			argv:    "wsl wezterm show-keys",
+			version: "wsl wezterm --version",
+		},
+		{
+			name:    "SkipConfig",
+			exec:    Exec{SkipConfig: true, Args: []string{"show-keys"}},
+			argv:    "wezterm -n show-keys",
+			version: "wezterm --version",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := c.exec.String(); got != c.argv {
+				t.Errorf("argv: got %s, want %s", got, c.argv)
+			}
+			if got := strings.Join(c.exec.versionArgv(), " "); got != c.version {
+				t.Errorf("version: got %s, want %s", got, c.version)
+			}
+		})
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	words, err := SplitCommand(`ssh devbox "/opt/wez term/wezterm" show-keys 'a b'c`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(words, "|"); got != "ssh|devbox|/opt/wez term/wezterm|show-keys|a bc" {
+		t.Errorf("unexpected words %q", got)
+	}
+	if _, err := SplitCommand(`ssh devbox 'wezterm show-keys'`); err == nil {
+		t.Error("expected error for show-keys inside a quoted word")
+	}
+	if _, err := SplitCommand(`ssh "devbox`); err == nil {
+		t.Error("expected error for unterminated quote")
+	}
+	if _, err := SplitCommand("   "); err == nil {
+		t.Error("expected error for empty command")
+	}
+}
+
+func TestExecError(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "wezterm")
+	script := `#!/bin/sh
+echo "runtime error: wezterm.lua:3: attempt to index a nil value" >&2
+exit 1
+`
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Exec{Command: []string{bin}, Args: []string{"show-keys"}}.Load(context.Background())
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected *ExecError, got %v", err)
+	}
+	if !strings.Contains(execErr.Stderr, "attempt to index a nil value") {
+		t.Errorf("expected stderr to be captured, got %q", execErr.Stderr)
+	}
+}
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	config := write("wezterm.lua", `
+local wezterm = require 'wezterm'
+local keys = require("keys")
+local theme = require('ui.theme')
+require("missing")
+return {}
+`)
+	keys := write("keys.lua", `local theme = require "ui.theme"; return {}`)
+	theme := write("ui/theme/init.lua", `return {}`)
+
+	got := ConfigFiles(config)
+	want := []string{config, keys, theme}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got := (Exec{ConfigFile: config}).Files(); !slices.Equal(got, want) {
+		t.Errorf("Exec.Files: got %q, want %q", got, want)
+	}
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+	t.Setenv("WEZTERM_CONFIG_FILE", "/etc/wezterm.lua")
+	if got := DefaultConfigFile(); got != "/etc/wezterm.lua" {
+		t.Errorf("expected $WEZTERM_CONFIG_FILE, got %q", got)
+	}
+
+	dir := t.TempDir()
+	t.Setenv("WEZTERM_CONFIG_FILE", "")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", t.TempDir())
+	if got := DefaultConfigFile(); got != "" {
+		t.Errorf("expected no config, got %q", got)
+	}
+	path := filepath.Join(dir, "wezterm", "wezterm.lua")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultConfigFile(); got != path {
+		t.Errorf("expected %q, got %q", path, got)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	dump := writeTemp(t, "keys.txt", testInput)
+	runs := filepath.Join(dir, "runs")
+	script := `#!/bin/sh
+if [ "$1" = "--version" ]; then
+	echo version >> "` + runs + `"
+	echo "wezterm 20240203-110809-5046fc22"
+	exit 0
+fi
+echo run >> "` + runs + `"
+cat "` + dump + `"
+`
+	bin := filepath.Join(dir, "wezterm")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	config := writeTemp(t, "wezterm.lua", "return {}")
+	count := func(what string) int {
+		data, _ := os.ReadFile(runs)
+		return strings.Count(string(data), what)
+	}
+	countRuns := func() int { return count("run") }
+
+	cache := Cache{
+		Exec: Exec{Command: []string{bin}, ConfigFile: config, Args: []string{"show-keys"}},
+		Dir:  filepath.Join(dir, "cache"),
+	}
+	ctx := context.Background()
+	isCached := func(c Cache) bool {
+		_, ok := c.read(c.key(c.Exec.Version(ctx)))
+		return ok
+	}
+	result, cached, err := cache.Lookup(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached || len(result.Bindings) != 5 || countRuns() != 1 {
+		t.Fatalf("expected wezterm to run once for 5 bindings, got cached %v, %d runs, %d bindings", cached, countRuns(), len(result.Bindings))
+	}
+	if n := count("version"); n != 1 {
+		t.Errorf("expected wezterm --version to run once on a miss, got %d", n)
+	}
+	if result.Version != "20240203-110809-5046fc22" {
+		t.Errorf("expected the version to be recorded, got %q", result.Version)
+	}
+
+	result, err = cache.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Bindings) != 5 || countRuns() != 1 {
+		t.Errorf("expected cache hit, got %d runs, %d bindings", countRuns(), len(result.Bindings))
+	}
+
+	// Other arguments and config changes miss the cache.
+	lua := cache
+	lua.Exec.Overrides = []string{"leader={key='b'}"}
+	if isCached(lua) {
+		t.Error("expected miss for different arguments")
+	}
+	if err := os.WriteFile(config, []byte("return { keys = {} }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if isCached(cache) {
+		t.Error("expected miss after config change")
+	}
+
+	if _, err := cache.Fresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if countRuns() != 2 {
+		t.Errorf("expected Fresh to run wezterm, got %d runs", countRuns())
+	}
+	if !isCached(cache) {
+		t.Error("expected Fresh to refresh the cache")
+	}
+
+	// A remote wezterm does not read the local config.
+	remote := cache
+	remote.Exec.Remote = true
+	before := remote.key("v")
+	if err := os.WriteFile(config, []byte("return { keys = { {} } }"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if remote.Exec.Files() != nil || remote.key("v") != before {
+		t.Error("expected local config files to be left out of a remote key")
+	}
+}
+
+func TestCacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/tmp/xdg-cache")
+	dir, err := CacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != filepath.Join("/tmp/xdg-cache", "wez-kv") {
+		t.Errorf("unexpected cache dir %q", dir)
+	}
+}
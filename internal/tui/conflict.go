@@ -0,0 +1,143 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+)
+
+// conflictColWidth fits a single marker.
+const conflictColWidth = 1
+
+// findConflicts looks for chords bound more than once in a table, and
+// for chords that match the same keystroke as another.
+func (m *Model) findConflicts() {
+	m.conflicts = analysis.Conflicts(m.bindings)
+	m.conflictOf = analysis.ByBinding(m.conflicts)
+	m.shadows = analysis.Equivalents(m.bindings)
+	m.shadowOf = analysis.ShadowsByBinding(m.shadows)
+	if !m.hasConflicts() {
+		m.conflictsOnly = false
+	}
+}
+
+// hasConflicts reports whether there is anything for the conflict
+// column to show.
+func (m Model) hasConflicts() bool {
+	return len(m.conflicts) > 0 || len(m.shadows) > 0
+}
+
+// hasMarkers reports whether the marker column is shown: whether there
+// are conflicts, chords that need an enhanced keyboard protocol or
+// policy violations.
+func (m Model) hasMarkers() bool {
+	return m.hasConflicts() || len(m.ambiguous) > 0 || len(m.violationsOf) > 0
+}
+
+// rowConflict returns the finding the binding in filtered row idx is
+// part of. Removed defaults are never part of one.
+func (m Model) rowConflict(idx int) (analysis.Finding, bool) {
+	if idx < 0 || idx >= len(m.filtered) {
+		return analysis.Finding{}, false
+	}
+	j, ok := m.conflictOf[m.filteredIdx[idx]]
+	if !ok {
+		return analysis.Finding{}, false
+	}
+	return m.conflicts[j], true
+}
+
+// rowShadow returns the shadow the binding in filtered row idx is part
+// of, either as the winner or as one of the bindings it shadows.
+func (m Model) rowShadow(idx int) (analysis.Shadow, bool) {
+	if idx < 0 || idx >= len(m.filtered) {
+		return analysis.Shadow{}, false
+	}
+	j, ok := m.shadowOf[m.filteredIdx[idx]]
+	if !ok {
+		return analysis.Shadow{}, false
+	}
+	return m.shadows[j], true
+}
+
+// rowShadowed reports whether the binding in filtered row idx never
+// fires because an equivalent chord takes precedence.
+func (m Model) rowShadowed(idx int) bool {
+	s, ok := m.rowShadow(idx)
+	return ok && s.Winner != m.filteredIdx[idx]
+}
+
+// matchConflict reports whether row i passes the conflicts filter.
+func (m Model) matchConflict(i int) bool {
+	if !m.conflictsOnly {
+		return true
+	}
+	_, conflict := m.conflictOf[i]
+	_, shadow := m.shadowOf[i]
+	return conflict || shadow
+}
+
+// nextConflict moves the cursor to the next row that is part of a
+// finding or a shadow, wrapping around, in direction dir (1 or -1).
+func (m *Model) nextConflict(dir int) bool {
+	n := len(m.filtered)
+	for step := 1; step <= n; step++ {
+		idx := ((m.cursor+dir*step)%n + n) % n
+		_, conflict := m.rowConflict(idx)
+		_, shadow := m.rowShadow(idx)
+		if conflict || shadow {
+			m.cursor = idx
+			m.clampView()
+			return true
+		}
+	}
+	return false
+}
+
+// renderConflictMarker marks the binding in filtered row idx. Policy
+// violations come first, as the user asked to see them. A shadowed
+// binding never fires, which matters more than how it conflicts, and a
+// conflict more than the keyboard protocol it needs.
+func (m Model) renderConflictMarker(idx int) string {
+	if len(m.rowViolations(idx)) > 0 {
+		return violationStyle.Render("✗")
+	}
+	if m.rowShadowed(idx) {
+		return conflictStyle.Render("⊘")
+	}
+	f, ok := m.rowConflict(idx)
+	if !ok {
+		if _, ok := m.rowAmbiguity(idx); ok {
+			return protocolStyle.Render("~")
+		}
+		return ""
+	}
+	switch f.Kind {
+	case analysis.KindConflict:
+		return conflictStyle.Render("≠")
+	case analysis.KindEquivalent:
+		return duplicateStyle.Render("≈")
+	default:
+		return duplicateStyle.Render("=")
+	}
+}
+
+// renderConflict describes the findings of the selected row.
+func (m Model) renderConflict() string {
+	var parts []string
+	if f, ok := m.rowConflict(m.cursor); ok {
+		if f.Kind == analysis.KindConflict {
+			parts = append(parts, conflictStyle.Render(f.String()))
+		} else {
+			parts = append(parts, duplicateStyle.Render(f.String()))
+		}
+	}
+	if s, ok := m.rowShadow(m.cursor); ok {
+		if m.rowShadowed(m.cursor) {
+			parts = append(parts, conflictStyle.Render("never fires: "+s.String()))
+		} else {
+			parts = append(parts, duplicateStyle.Render(s.String()))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
@@ -0,0 +1,86 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// maxSearchBody bounds how much of a handler's body is searched, so a
+// long handler does not match every query.
+const maxSearchBody = 500
+
+// emittedEvents returns the events an action emits with EmitEvent,
+// including those nested in Multiple or other actions.
+func emittedEvents(n parser.Node) []string {
+	var events []string
+	n.Walk(func(n parser.Node) bool {
+		if n.Kind != parser.NodeCall || n.Name != "EmitEvent" {
+			return true
+		}
+		if arg, ok := n.Arg(0); ok && arg.Kind == parser.NodeString {
+			events = append(events, arg.Value)
+		}
+		return false
+	})
+	return events
+}
+
+// bindingHandlers returns the Lua handlers of the events b emits.
+func (m Model) bindingHandlers(b parser.Keybinding) []luacfg.Handler {
+	if len(m.handlers) == 0 {
+		return nil
+	}
+	var found []luacfg.Handler
+	for _, event := range emittedEvents(b.ActionTree) {
+		found = append(found, m.handlers.For(event)...)
+	}
+	return found
+}
+
+// renderHandlerPreview renders the first handler's body after the
+// action, in at most w cells.
+func (m Model) renderHandlerPreview(b parser.Keybinding, w int) string {
+	hs := m.bindingHandlers(b)
+	const arrow = " ⇒ "
+	avail := w - lipgloss.Width(arrow)
+	if len(hs) == 0 || avail <= 8 {
+		return ""
+	}
+	// Truncate by cells rather than runes, since wide characters take two.
+	preview := ansi.Truncate(hs[0].OneLine(), avail, "…")
+	if preview == "" {
+		return ""
+	}
+	return handlerStyle.Render(arrow + preview)
+}
+
+// renderLocations describes where the selected binding is defined and,
+// if it emits events, where their handlers are.
+func (m Model) renderLocations() string {
+	loc := m.renderLocation()
+	if m.cursor < 0 || m.cursor >= len(m.filtered) {
+		return loc
+	}
+	hs := m.bindingHandlers(m.filtered[m.cursor])
+	if len(hs) == 0 {
+		return loc
+	}
+	paths := make([]string, len(hs))
+	for i, h := range hs {
+		paths[i] = m.relativeLocation(h.Location)
+	}
+	label := "handler"
+	if len(hs) > 1 {
+		label = "handlers"
+	}
+	text := handlerStyle.Render(fmt.Sprintf("%s: %s", label, strings.Join(paths, ", ")))
+	if loc == "" {
+		return text
+	}
+	return loc + "  " + text
+}
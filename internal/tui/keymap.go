@@ -3,17 +3,26 @@ package tui
 import "github.com/charmbracelet/bubbles/key"
 
 type keyMap struct {
-	Up         key.Binding
-	Down       key.Binding
-	Top        key.Binding
-	Bottom     key.Binding
-	Search     key.Binding
-	Escape     key.Binding
-	NextTab    key.Binding
-	PrevTab    key.Binding
-	Quit       key.Binding
+	Up           key.Binding
+	Down         key.Binding
+	Top          key.Binding
+	Bottom       key.Binding
+	Search       key.Binding
+	Escape       key.Binding
+	NextTab      key.Binding
+	PrevTab      key.Binding
+	Quit         key.Binding
 	HalfPageUp   key.Binding
 	HalfPageDown key.Binding
+	Retry        key.Binding
+	Reload       key.Binding
+	OriginFilter key.Binding
+	Customized   key.Binding
+	Edit         key.Binding
+	Conflicts    key.Binding
+	NextConflict key.Binding
+	PrevConflict key.Binding
+	Ambiguous    key.Binding
 }
 
 var keys = keyMap{
@@ -50,6 +59,33 @@ var keys = keyMap{
 	HalfPageDown: key.NewBinding(
 		key.WithKeys("ctrl+d"),
 	),
+	Retry: key.NewBinding(
+		key.WithKeys("r"),
+	),
+	Reload: key.NewBinding(
+		key.WithKeys("R"),
+	),
+	OriginFilter: key.NewBinding(
+		key.WithKeys("o"),
+	),
+	Customized: key.NewBinding(
+		key.WithKeys("c"),
+	),
+	Edit: key.NewBinding(
+		key.WithKeys("e"),
+	),
+	Conflicts: key.NewBinding(
+		key.WithKeys("x"),
+	),
+	NextConflict: key.NewBinding(
+		key.WithKeys("n"),
+	),
+	PrevConflict: key.NewBinding(
+		key.WithKeys("N"),
+	),
+	Ambiguous: key.NewBinding(
+		key.WithKeys("p"),
+	),
 }
 
 type helpItem struct {
@@ -65,3 +101,17 @@ func helpItems() []helpItem {
 		{"q", "quit"},
 	}
 }
+
+func originHelpItems() []helpItem {
+	return []helpItem{
+		{"o", "origin"},
+		{"c", "customized"},
+	}
+}
+
+func conflictHelpItems() []helpItem {
+	return []helpItem{
+		{"x", "conflicts"},
+		{"n/N", "next conflict"},
+	}
+}
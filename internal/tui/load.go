@@ -0,0 +1,233 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// loadedMsg carries the outcome of loading the keymap from the source.
+type loadedMsg struct {
+	result parser.ParseResult
+	err    error
+	// cached is set when the result came from the source's cache and
+	// still has to be revalidated.
+	cached bool
+}
+
+// streamedMsg carries bindings of a load that is still running.
+type streamedMsg struct {
+	bindings []parser.Keybinding
+	stream   *loadStream
+}
+
+// streamInterval is how long bindings are collected before the rows
+// parsed so far are shown.
+const streamInterval = 50 * time.Millisecond
+
+// NewLoader returns a Model that loads its keymap from src when the
+// program starts, showing a spinner until the first bindings are
+// parsed and the rows so far until it is ready. Loading is
+// aborted after timeout; zero means no timeout.
+func NewLoader(src source.Source, timeout time.Duration, opts ...Option) Model {
+	m := New(parser.ParseResult{}, append([]Option{WithSource(src.String())}, opts...)...)
+	m.src = src
+	m.timeout = timeout
+	m.loading = true
+	m.spinner = spinner.New(spinner.WithSpinner(spinner.Dot), spinner.WithStyle(spinnerStyle))
+	return m
+}
+
+// loadCmd loads the keymap in the background. A cached keymap is used
+// when the source has a current one, unless fresh is set.
+func (m Model) loadCmd(fresh bool) tea.Cmd {
+	src, timeout := m.src, m.timeout
+	return func() tea.Msg {
+		return load(src, timeout, fresh, nil)
+	}
+}
+
+// streamCmd is like loadCmd(false), but reports the bindings in batches
+// of streamedMsg while they are parsed, before the final loadedMsg, so
+// that the first rows are shown while wezterm is still running.
+func (m Model) streamCmd() tea.Cmd {
+	src, timeout := m.src, m.timeout
+	return func() tea.Msg {
+		s := &loadStream{bindings: make(chan parser.Keybinding), done: make(chan loadedMsg, 1)}
+		go func() {
+			s.done <- load(src, timeout, false, func(b parser.Keybinding) error {
+				s.bindings <- b
+				return nil
+			})
+			close(s.bindings)
+		}()
+		return s.next()
+	}
+}
+
+// load loads the keymap from src. fn, if not nil, is called for every
+// binding as it is parsed, if src supports it.
+func load(src source.Source, timeout time.Duration, fresh bool, fn func(parser.Keybinding) error) loadedMsg {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var result parser.ParseResult
+	var err error
+	c, ok := src.(source.Cacher)
+	s, streams := src.(source.Streamer)
+	switch {
+	case ok && fresh:
+		result, err = c.Fresh(ctx)
+	case ok:
+		var cached bool
+		result, cached, err = c.Lookup(ctx, fn)
+		if err == nil && cached {
+			return loadedMsg{result: result, cached: true}
+		}
+	case streams && fn != nil:
+		result, err = s.Stream(ctx, fn)
+	default:
+		result, err = src.Load(ctx)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s: %w", formatDuration(timeout), err)
+	}
+	return loadedMsg{result: result, err: err}
+}
+
+// loadStream connects a load running in the background to the model.
+// The load sends every binding on bindings, and its outcome on done
+// before closing bindings.
+type loadStream struct {
+	bindings chan parser.Keybinding
+	done     chan loadedMsg
+}
+
+// next waits for the next binding and collects those that follow within
+// streamInterval, so that a fast load is not redrawn for every binding.
+// Once the load is done it returns its loadedMsg.
+func (s *loadStream) next() tea.Msg {
+	b, ok := <-s.bindings
+	if !ok {
+		return <-s.done
+	}
+	batch := []parser.Keybinding{b}
+	timer := time.NewTimer(streamInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case b, ok := <-s.bindings:
+			if !ok {
+				return streamedMsg{bindings: batch, stream: s}
+			}
+			batch = append(batch, b)
+		case <-timer.C:
+			return streamedMsg{bindings: batch, stream: s}
+		}
+	}
+}
+
+// handleStreamed shows the bindings parsed so far and waits for more.
+func (m Model) handleStreamed(msg streamedMsg) (Model, tea.Cmd) {
+	if m.loading {
+		bindings := slices.Concat(m.bindings, msg.bindings)
+		m.replaceResult(parser.ParseResult{Bindings: bindings, Tables: tablesOf(bindings)})
+	}
+	return m, msg.stream.next
+}
+
+// tablesOf lists the key tables of bindings in order of appearance.
+func tablesOf(bindings []parser.Keybinding) []string {
+	var tables []string
+	for _, b := range bindings {
+		if !slices.Contains(tables, b.Table) {
+			tables = append(tables, b.Table)
+		}
+	}
+	return tables
+}
+
+// startLoad enters the loading state and kicks off a load.
+func (m Model) startLoad() (Model, tea.Cmd) {
+	m.loading = true
+	m.loadErr = nil
+	m.setResult(parser.ParseResult{})
+	return m, tea.Batch(m.spinner.Tick, m.streamCmd())
+}
+
+func (m Model) handleLoaded(msg loadedMsg) (Model, tea.Cmd) {
+	m.loading = false
+	if msg.err != nil {
+		m.loadErr = msg.err
+		return m, nil
+	}
+	m.loadErr = nil
+	m.replaceResult(msg.result)
+	if msg.cached {
+		// Show the cached keymap now and check it against wezterm.
+		m.revalidating = true
+		m, cmd := m.startReload()
+		return m, tea.Batch(cmd, m.analyzeCmd())
+	}
+	return m, m.analyzeCmd()
+}
+
+// updateLoadState handles keys while loading or showing a load error.
+func (m Model) updateLoadState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, keys.Quit):
+		return m, tea.Quit
+	case m.loadErr != nil && key.Matches(msg, keys.Retry):
+		return m.startLoad()
+	}
+	return m, nil
+}
+
+func (m Model) renderLoading() string {
+	var b strings.Builder
+	b.WriteString(m.renderTitle())
+	b.WriteString("\n\n")
+	b.WriteString(" " + m.spinner.View() + " " + loadingStyle.Render("Loading keymap from "+m.source+"…"))
+	b.WriteString(strings.Repeat("\n", max(1, m.height-3)))
+	b.WriteString(m.renderHelpItems([]helpItem{{"q", "quit"}}))
+	return b.String()
+}
+
+func (m Model) renderLoadError() string {
+	var b strings.Builder
+	b.WriteString(m.renderTitle())
+	b.WriteString("\n\n")
+	b.WriteString(" " + errorStyle.Render("Failed to load keymap") + "\n")
+	b.WriteString(" " + m.loadErr.Error() + "\n")
+	lines := 4
+
+	var execErr *source.ExecError
+	if errors.As(m.loadErr, &execErr) && strings.TrimSpace(execErr.Stderr) != "" {
+		b.WriteString("\n " + headerStyle.Render("wezterm stderr:") + "\n")
+		lines += 2
+		for _, line := range strings.Split(strings.TrimRight(execErr.Stderr, "\n"), "\n") {
+			if lines >= m.height-2 {
+				break
+			}
+			b.WriteString(" " + stderrStyle.Render(line) + "\n")
+			lines++
+		}
+	}
+
+	b.WriteString(strings.Repeat("\n", max(1, m.height-lines-1)))
+	b.WriteString(m.renderHelpItems([]helpItem{{"r", "retry"}, {"q", "quit"}}))
+	return b.String()
+}
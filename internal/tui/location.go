@@ -0,0 +1,129 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
+)
+
+type (
+	// analyzedMsg carries the analysis of the config: where it defines
+	// its bindings and its event handlers.
+	analyzedMsg struct {
+		config *luacfg.Config
+		err    error
+	}
+	// editedMsg reports that the editor opened with e has exited.
+	editedMsg struct{ err error }
+)
+
+// WithConfig analyzes the wezterm config at path to map bindings to
+// where it defines them, shown for the selected row, and to the Lua
+// handlers of the events they emit. e opens a binding's definition in
+// $EDITOR.
+func WithConfig(path string) Option {
+	return func(m *Model) {
+		m.configPath = path
+	}
+}
+
+// analyzeCmd analyzes the config in the background. It runs again after
+// every reload, since edits move bindings around.
+func (m Model) analyzeCmd() tea.Cmd {
+	if m.configPath == "" {
+		return nil
+	}
+	path := m.configPath
+	return func() tea.Msg {
+		cfg, err := luacfg.Analyze(context.Background(), path)
+		return analyzedMsg{config: cfg, err: err}
+	}
+}
+
+func (m Model) handleAnalyzed(msg analyzedMsg) (Model, tea.Cmd) {
+	if msg.err != nil {
+		// Keep the previous analysis; the config may be mid-edit.
+		return m, nil
+	}
+	m.locations = msg.config.Locations
+	m.handlers = msg.config.Handlers
+	if m.query != "" {
+		// Handler bodies are searchable, so the matches may change.
+		cursor, offset := m.cursor, m.offset
+		m.applyFilter()
+		m.cursor = min(cursor, max(0, len(m.filtered)-1))
+		m.offset = min(offset, m.cursor)
+		m.clampView()
+	}
+	return m, nil
+}
+
+// rowLocation returns where the binding in filtered row idx is defined.
+func (m Model) rowLocation(idx int) (luacfg.Location, bool) {
+	if m.locations == nil || idx < 0 || idx >= len(m.filtered) {
+		return luacfg.Location{}, false
+	}
+	return m.locations.Lookup(m.filtered[idx])
+}
+
+// renderLocation describes where the selected binding is defined, with
+// the path relative to the config's directory.
+func (m Model) renderLocation() string {
+	loc, ok := m.rowLocation(m.cursor)
+	if !ok {
+		return ""
+	}
+	return locationStyle.Render(m.relativeLocation(loc))
+}
+
+// relativeLocation formats loc with the path relative to the config's
+// directory.
+func (m Model) relativeLocation(loc luacfg.Location) string {
+	path := loc.File
+	if rel, err := filepath.Rel(filepath.Dir(m.configPath), path); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	return fmt.Sprintf("%s:%d", path, loc.Line)
+}
+
+// editorCommand builds the command that opens file at line in $EDITOR,
+// which may include arguments, e.g. "code --wait".
+func editorCommand(file string, line int) *exec.Cmd {
+	argv := strings.Fields(os.Getenv("EDITOR"))
+	if len(argv) == 0 {
+		argv = []string{"vi"}
+	}
+	argv = append(argv, "+"+strconv.Itoa(line), file)
+	return exec.Command(argv[0], argv[1:]...)
+}
+
+// edit opens the selected binding's definition in $EDITOR, suspending
+// the TUI until the editor exits.
+func (m Model) edit() (Model, tea.Cmd) {
+	loc, ok := m.rowLocation(m.cursor)
+	if !ok {
+		return m.showNotice("no definition found in the config for this binding", true)
+	}
+	return m, tea.ExecProcess(editorCommand(loc.File, loc.Line), func(err error) tea.Msg {
+		return editedMsg{err: err}
+	})
+}
+
+func (m Model) handleEdited(msg editedMsg) (Model, tea.Cmd) {
+	if msg.err != nil {
+		return m.showNotice("editor failed: "+msg.err.Error(), true)
+	}
+	m, cmd := m.startReload()
+	if cmd == nil {
+		// No reload will follow to analyze the config again.
+		cmd = m.analyzeCmd()
+	}
+	return m, cmd
+}
@@ -2,22 +2,85 @@ package tui
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/sahilm/fuzzy"
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
 	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/policy"
+	"github.com/sorafujitani/wez-kv/internal/source"
+	"github.com/sorafujitani/wez-kv/internal/watch"
 )
 
 type Model struct {
 	bindings     []parser.Keybinding
 	filtered     []parser.Keybinding
+	filteredIdx  []int   // index into rows() per filtered row
 	matchIndices [][]int // fuzzy match indices per filtered row
 	tables       []string
 	leader       *parser.Leader
+	diagnostics  []parser.Diagnostic
+	source       string // where the keymap came from, e.g. "wezterm show-keys"
+	banner       string // highlighted note about the keymap, see WithBanner
+
+	// Asynchronous loading, see NewLoader
+	src     source.Source
+	timeout time.Duration
+	loading bool
+	loadErr error
+	spinner spinner.Model
+
+	// Classification against the defaults, see WithDefaults
+	defaultsSrc     source.Source
+	defaultBindings []parser.Keybinding
+	origins         []defaults.Origin // per row; nil until classified
+	removed         []parser.Keybinding
+	originFilter    int // -1 = All, else a defaults.Origin
+	customizedOnly  bool
+
+	// Chords bound more than once in a table
+	conflicts     []analysis.Finding
+	conflictOf    map[int]int // binding index to index into conflicts
+	shadows       []analysis.Shadow
+	shadowOf      map[int]int // binding index to index into shadows
+	conflictsOnly bool
+
+	// Chords that need an enhanced keyboard protocol, by binding index
+	ambiguous     map[int]analysis.Ambiguity
+	ambiguousOnly bool
+
+	// Violations of a team policy, see WithPolicy
+	policy       *policy.Policy
+	policyOS     string
+	violations   []lint.Finding
+	violationsOf map[int][]int // binding index to indices into violations
+
+	// Reloading, see WithWatch and WithoutReload
+	poller        *watch.Poller
+	watchInterval time.Duration
+	noReload      bool
+	reloading     bool
+	pendingChange bool // a watched file changed during a load or reload
+	revalidating  bool // the reload checks a cached keymap
+	notice        string
+	noticeErr     bool
+	noticeSeq     int
+
+	// Where bindings are defined, see WithConfig
+	configPath string
+	locations  luacfg.Locations
+	handlers   luacfg.Handlers
 
 	cursor      int
 	offset      int
@@ -29,24 +92,61 @@ type Model struct {
 	query       string
 }
 
-func New(result parser.ParseResult) Model {
+// Option configures a Model.
+type Option func(*Model)
+
+// WithSource sets the description of where the keymap came from, which
+// is shown in the title bar.
+func WithSource(source string) Option {
+	return func(m *Model) {
+		m.source = source
+	}
+}
+
+// WithBanner shows text prominently in the title bar, for facts about the
+// keymap that are easy to miss, such as it not coming from the user's
+// wezterm.
+func WithBanner(text string) Option {
+	return func(m *Model) {
+		m.banner = text
+	}
+}
+
+func New(result parser.ParseResult, opts ...Option) Model {
 	ti := textinput.New()
 	ti.Prompt = "> "
 	ti.CharLimit = 128
 
 	m := Model{
-		bindings:    result.Bindings,
-		tables:      result.Tables,
-		leader:      result.Leader,
-		activeTable: -1,
-		searchInput: ti,
+		activeTable:  -1,
+		originFilter: -1,
+		searchInput:  ti,
 	}
-	m.applyFilter()
+	for _, opt := range opts {
+		opt(&m)
+	}
+	m.setResult(result)
 	return m
 }
 
+// setResult replaces the keymap shown by the model.
+func (m *Model) setResult(result parser.ParseResult) {
+	m.bindings = result.Bindings
+	m.tables = result.Tables
+	m.leader = result.Leader
+	m.diagnostics = result.Diagnostics
+	m.findConflicts()
+	m.findAmbiguous()
+	m.checkPolicy(result)
+	m.classify()
+	m.applyFilter()
+}
+
 func (m Model) Init() tea.Cmd {
-	return nil
+	if m.loading {
+		return tea.Batch(m.spinner.Tick, m.streamCmd(), m.defaultsCmd(), m.watchTick())
+	}
+	return tea.Batch(m.defaultsCmd(), m.analyzeCmd(), m.watchTick())
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -57,7 +157,45 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.clampView()
 		return m, nil
 
+	case loadedMsg:
+		return m.handleLoaded(msg)
+
+	case streamedMsg:
+		return m.handleStreamed(msg)
+
+	case reloadedMsg:
+		return m.handleReloaded(msg)
+
+	case defaultsLoadedMsg:
+		return m.handleDefaultsLoaded(msg)
+
+	case watchTickMsg:
+		return m.handleWatchTick(msg)
+
+	case analyzedMsg:
+		return m.handleAnalyzed(msg)
+
+	case editedMsg:
+		return m.handleEdited(msg)
+
+	case clearNoticeMsg:
+		if msg.seq == m.noticeSeq {
+			m.notice = ""
+		}
+		return m, nil
+
+	case spinner.TickMsg:
+		if !m.loading {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
 	case tea.KeyMsg:
+		if m.loadErr != nil || m.loading && len(m.bindings) == 0 {
+			return m.updateLoadState(msg)
+		}
 		if m.searching {
 			return m.updateSearch(msg)
 		}
@@ -90,6 +228,40 @@ func (m Model) updateNormal(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		for range half {
 			m.cursorUp()
 		}
+	case key.Matches(msg, keys.OriginFilter):
+		if m.origins != nil {
+			m.nextOriginFilter()
+			m.applyFilter()
+		}
+	case key.Matches(msg, keys.Customized):
+		if m.origins != nil {
+			m.customizedOnly = !m.customizedOnly
+			m.applyFilter()
+		}
+	case key.Matches(msg, keys.Conflicts):
+		if m.hasConflicts() {
+			m.conflictsOnly = !m.conflictsOnly
+			m.applyFilter()
+		}
+	case key.Matches(msg, keys.Ambiguous):
+		if len(m.ambiguous) > 0 {
+			m.ambiguousOnly = !m.ambiguousOnly
+			m.applyFilter()
+		}
+	case key.Matches(msg, keys.NextConflict):
+		if m.hasConflicts() && !m.nextConflict(1) {
+			return m.showNotice("no conflicts in this view", true)
+		}
+	case key.Matches(msg, keys.PrevConflict):
+		if m.hasConflicts() && !m.nextConflict(-1) {
+			return m.showNotice("no conflicts in this view", true)
+		}
+	case key.Matches(msg, keys.Reload):
+		return m.startReload()
+	case key.Matches(msg, keys.Edit):
+		if m.configPath != "" {
+			return m.edit()
+		}
 	case key.Matches(msg, keys.Search):
 		m.searching = true
 		m.searchInput.Focus()
@@ -139,33 +311,45 @@ func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func (m *Model) applyFilter() {
-	// First filter by table
+	text, terms := parseQuery(m.query)
+
+	// First filter by table and structured terms
 	var candidates []parser.Keybinding
 	var candidateIndices []int
-	for i, b := range m.bindings {
-		if m.activeTable == -1 || (m.activeTable < len(m.tables) && b.Table == m.tables[m.activeTable]) {
-			candidates = append(candidates, b)
-			candidateIndices = append(candidateIndices, i)
+	for i, b := range m.rows() {
+		if m.activeTable != -1 && (m.activeTable >= len(m.tables) || b.Table != m.tables[m.activeTable]) {
+			continue
+		}
+		if !terms.match(b) || !m.matchOrigin(i) || !m.matchConflict(i) || !m.matchAmbiguous(i) {
+			continue
 		}
+		candidates = append(candidates, b)
+		candidateIndices = append(candidateIndices, i)
 	}
 
 	m.matchIndices = nil
 
-	if m.query == "" {
+	if text == "" {
 		m.filtered = candidates
+		m.filteredIdx = candidateIndices
 		m.matchIndices = make([][]int, len(candidates))
 	} else {
 		// Build searchable strings
 		strs := make([]string, len(candidates))
 		for i, b := range candidates {
-			strs[i] = b.Modifiers + " " + b.Key + " " + b.Action
+			strs[i] = b.Modifiers.String() + " " + b.Key.String() + " " + b.Action
+			for _, h := range m.bindingHandlers(b) {
+				strs[i] += " " + h.Preview(maxSearchBody)
+			}
 		}
 
-		matches := fuzzy.Find(m.query, strs)
+		matches := fuzzy.Find(text, strs)
 		m.filtered = make([]parser.Keybinding, len(matches))
+		m.filteredIdx = make([]int, len(matches))
 		m.matchIndices = make([][]int, len(matches))
 		for i, match := range matches {
 			m.filtered[i] = candidates[match.Index]
+			m.filteredIdx[i] = candidateIndices[match.Index]
 			m.matchIndices[i] = match.MatchedIndexes
 		}
 	}
@@ -215,6 +399,12 @@ func (m Model) View() string {
 	if m.width == 0 {
 		return ""
 	}
+	if m.loading && len(m.bindings) == 0 {
+		return m.renderLoading()
+	}
+	if m.loadErr != nil {
+		return m.renderLoadError()
+	}
 
 	var b strings.Builder
 
@@ -268,17 +458,36 @@ func (m Model) View() string {
 
 func (m Model) renderTitle() string {
 	title := titleStyle.Render(" wez-kv")
+	switch {
+	case m.banner != "":
+		title += " " + bannerStyle.Render(" "+m.banner+" ")
+	case m.source != "":
+		title += " " + sourceStyle.Render(m.source)
+	}
+	if n := len(m.diagnostics); n > 0 {
+		title += " " + warningStyle.Render(fmt.Sprintf("⚠ %d skipped %s", n, plural(n, "line", "lines")))
+	}
+	if badge := m.renderPolicyBadge(); badge != "" {
+		title += " " + badge
+	}
+	switch {
+	case m.loading:
+		title += " " + m.spinner.View() + noticeStyle.Render("loading…")
+	case m.revalidating:
+		title += " " + noticeStyle.Render("cached, revalidating…")
+	case m.reloading:
+		title += " " + noticeStyle.Render("reloading…")
+	case m.notice != "" && m.noticeErr:
+		title += " " + errorStyle.Render(m.notice)
+	case m.notice != "":
+		title += " " + noticeStyle.Render(m.notice)
+	}
 	if m.leader == nil {
 		return title
 	}
 
-	var leaderParts []string
-	if m.leader.Mods != "" {
-		leaderParts = append(leaderParts, m.leader.Mods)
-	}
-	leaderParts = append(leaderParts, m.leader.Key)
-	leaderStr := leaderValueStyle.Render(strings.Join(leaderParts, "+"))
-	timeout := leaderStyle.Render(fmt.Sprintf("(%s)", m.leader.Timeout))
+	leaderStr := leaderValueStyle.Render(m.leader.Chord.String())
+	timeout := leaderStyle.Render(fmt.Sprintf("(%s timeout)", formatDuration(m.leader.Timeout)))
 
 	right := leaderStyle.Render("Leader: ") + leaderStr + " " + timeout
 	gap := m.width - lipgloss.Width(title) - lipgloss.Width(right)
@@ -305,7 +514,40 @@ func (m Model) renderTabBar() string {
 		}
 	}
 
-	return " " + strings.Join(parts, "  ")
+	bar := " " + strings.Join(parts, "  ")
+	if filter := m.renderFilters(); filter != "" {
+		gap := max(1, m.width-lipgloss.Width(bar)-lipgloss.Width(filter)-1)
+		bar += strings.Repeat(" ", gap) + filter
+	}
+	return bar
+}
+
+// renderFilters describes the active filters besides the table for the
+// tab bar.
+func (m Model) renderFilters() string {
+	var parts []string
+	if filter := m.renderOriginFilter(); filter != "" {
+		parts = append(parts, filter)
+	}
+	if m.conflictsOnly {
+		parts = append(parts, activeTabStyle.Render("conflicts only"))
+	}
+	if m.ambiguousOnly {
+		parts = append(parts, activeTabStyle.Render("enhanced keys only"))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// renderStatus describes the selected row for the search bar: what is
+// wrong with it, if anything, and where it is defined.
+func (m Model) renderStatus() string {
+	var parts []string
+	for _, s := range []string{m.renderViolations(), m.renderConflict(), m.renderAmbiguity(), m.renderLocations()} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "  ")
 }
 
 func (m Model) renderSeparator() string {
@@ -313,14 +555,23 @@ func (m Model) renderSeparator() string {
 }
 
 func (m Model) renderColumnHeader() string {
+	if m.mouseView() {
+		return headerStyle.Render(m.formatMouseColumns("Table", "Modifiers", "Event", "Button", "Streak", "Action"))
+	}
 	return headerStyle.Render(m.formatColumns("Table", "Modifiers", "Key", "Action"))
 }
 
+// mouseView reports whether the active table is a Mouse section, which
+// is shown with Event/Button/Streak columns instead of Key.
+func (m Model) mouseView() bool {
+	return m.activeTable >= 0 && m.activeTable < len(m.tables) && parser.IsMouseTable(m.tables[m.activeTable])
+}
+
 func (m Model) colWidths() (int, int, int, int) {
 	tW := 18
 	mW := 18
 	kW := 20
-	aW := m.width - tW - mW - kW - 5 // 5 = leading space + 3 separators + trailing
+	aW := m.width - tW - mW - kW - 5 - m.extraColsWidth() // 5 = leading space + 3 separators + trailing
 	if aW < 20 {
 		aW = 20
 	}
@@ -329,7 +580,52 @@ func (m Model) colWidths() (int, int, int, int) {
 
 func (m Model) formatColumns(table, mods, key, action string) string {
 	tW, mW, kW, _ := m.colWidths()
-	return fmt.Sprintf(" %-*s %-*s %-*s %s", tW, table, mW, mods, kW, key, action)
+	return fmt.Sprintf(" %-*s %-*s %-*s %s%s", tW, table, mW, mods, kW, key, m.extraColsHeader(), action)
+}
+
+// extraColsWidth is the width taken by the optional columns shown
+// between the key and the action, including separators.
+func (m Model) extraColsWidth() int {
+	w := 0
+	if m.hasMarkers() {
+		w += conflictColWidth + 1
+	}
+	if m.origins != nil {
+		w += originColWidth + 1
+	}
+	return w
+}
+
+func (m Model) extraColsHeader() string {
+	var h string
+	if m.hasMarkers() {
+		h += fmt.Sprintf("%-*s ", conflictColWidth, "!")
+	}
+	if m.origins != nil {
+		h += fmt.Sprintf("%-*s ", originColWidth, "Origin")
+	}
+	return h
+}
+
+func (m Model) renderExtraCols(idx int) string {
+	var cols string
+	if m.hasMarkers() {
+		cols += padCell(m.renderConflictMarker(idx), conflictColWidth) + " "
+	}
+	if o, ok := m.rowOrigin(idx); ok {
+		cols += padCell(renderOrigin(o), originColWidth) + " "
+	}
+	return cols
+}
+
+func mouseColWidths() (int, int, int) {
+	return 6, 14, 6 // event, button, streak
+}
+
+func (m Model) formatMouseColumns(table, mods, event, button, streak, action string) string {
+	tW, mW, _, _ := m.colWidths()
+	eW, bW, sW := mouseColWidths()
+	return fmt.Sprintf(" %-*s %-*s %-*s %-*s %-*s %s%s", tW, table, mW, mods, eW, event, bW, button, sW, streak, m.extraColsHeader(), action)
 }
 
 func (m Model) renderRow(idx int) string {
@@ -338,30 +634,36 @@ func (m Model) renderRow(idx int) string {
 
 	table := tableStyle.Render(b.Table)
 	mods := renderModifiers(b.Modifiers)
-	k := keyStyle.Render(b.Key)
 	action := actionStyle.Render(b.Action)
+	if o, ok := m.rowOrigin(idx); ok && o == defaults.OriginRemoved {
+		action = removedActionStyle.Render(b.Action)
+	}
 
-	tW, mW, kW, _ := m.colWidths()
+	tW, mW, kW, aW := m.colWidths()
 
-	// Pad columns accounting for ANSI codes
-	tablePad := tW - lipgloss.Width(table)
-	modsPad := mW - lipgloss.Width(mods)
-	keyPad := kW - lipgloss.Width(k)
-	if tablePad < 0 {
-		tablePad = 0
+	// The trigger of a binding that violates the policy is highlighted.
+	trigger := keyStyle
+	if len(m.rowViolations(idx)) > 0 {
+		trigger = violationStyle
 	}
-	if modsPad < 0 {
-		modsPad = 0
+	row := " " + padCell(table, tW) + " " + padCell(mods, mW) + " "
+	eW, bW, sW := mouseColWidths()
+	switch {
+	case m.mouseView() && b.Mouse != nil:
+		row += padCell(trigger.Render(b.Mouse.Kind.String()), eW) + " " +
+			padCell(trigger.Render(b.Mouse.Button), bW) + " " +
+			padCell(trigger.Render(strconv.Itoa(b.Mouse.Streak)), sW) + " "
+	case m.mouseView():
+		// Unrecognized mouse trigger: span the Event/Button/Streak columns
+		row += padCell(trigger.Render(b.Key.String()), eW+bW+sW+2) + " "
+	default:
+		row += padCell(trigger.Render(b.Key.String()), kW) + " "
 	}
-	if keyPad < 0 {
-		keyPad = 0
+	row += m.renderExtraCols(idx) + action
+	if preview := m.renderHandlerPreview(b, aW-lipgloss.Width(action)); preview != "" {
+		row += preview
 	}
 
-	row := " " + table + strings.Repeat(" ", tablePad) + " " +
-		mods + strings.Repeat(" ", modsPad) + " " +
-		k + strings.Repeat(" ", keyPad) + " " +
-		action
-
 	if selected {
 		// Apply background to the full width
 		padLen := m.width - lipgloss.Width(row)
@@ -374,13 +676,14 @@ func (m Model) renderRow(idx int) string {
 	return row
 }
 
-func renderModifiers(mods string) string {
-	if mods == "" {
-		return ""
-	}
-	parts := strings.Split(mods, " | ")
+// padCell pads a rendered cell to width w, accounting for ANSI codes.
+func padCell(s string, w int) string {
+	return s + strings.Repeat(" ", max(0, w-lipgloss.Width(s)))
+}
+
+func renderModifiers(mods parser.Modifiers) string {
 	var rendered []string
-	for _, p := range parts {
+	for _, p := range mods.Names() {
 		rendered = append(rendered, modifierStyle(p).Render(p))
 	}
 	return strings.Join(rendered, lipgloss.NewStyle().Foreground(lipgloss.Color("243")).Render(" | "))
@@ -400,6 +703,9 @@ func (m Model) renderSearchBar() string {
 	if m.query != "" {
 		prompt := searchPromptStyle.Render("> ") + m.query
 		count := matchCountStyle.Render(fmt.Sprintf("%d/%d matches", len(m.filtered), len(m.bindings)))
+		if status := m.renderStatus(); status != "" {
+			count = status + "  " + count
+		}
 		gap := m.width - lipgloss.Width(prompt) - lipgloss.Width(count) - 2
 		if gap < 1 {
 			gap = 1
@@ -408,14 +714,54 @@ func (m Model) renderSearchBar() string {
 	}
 
 	count := matchCountStyle.Render(fmt.Sprintf("%d entries", len(m.filtered)))
+	if status := m.renderStatus(); status != "" {
+		gap := max(1, m.width-lipgloss.Width(count)-lipgloss.Width(status)-2)
+		return " " + count + strings.Repeat(" ", gap) + status
+	}
 	return " " + count
 }
 
 func (m Model) renderHelp() string {
 	items := helpItems()
+	if m.canReload() {
+		// Before quit, which stays last.
+		items = slices.Insert(items, len(items)-1, helpItem{"R", "reload"})
+	}
+	if m.origins != nil {
+		items = slices.Insert(items, len(items)-1, originHelpItems()...)
+	}
+	if m.hasConflicts() {
+		items = slices.Insert(items, len(items)-1, conflictHelpItems()...)
+	}
+	if len(m.ambiguous) > 0 {
+		items = slices.Insert(items, len(items)-1, helpItem{"p", "enhanced keys"})
+	}
+	if m.locations != nil {
+		items = slices.Insert(items, len(items)-1, helpItem{"e", "edit"})
+	}
+	return m.renderHelpItems(items)
+}
+
+func (m Model) renderHelpItems(items []helpItem) string {
 	var parts []string
 	for _, item := range items {
 		parts = append(parts, helpKeyStyle.Render(item.key)+helpStyle.Render(":"+item.desc))
 	}
 	return " " + strings.Join(parts, helpStyle.Render("  "))
 }
+
+// formatDuration renders d as milliseconds below one second and as
+// seconds otherwise, e.g. "500ms" or "2.001s".
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return strconv.FormatFloat(d.Round(time.Millisecond).Seconds(), 'f', -1, 64) + "s"
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
@@ -1,20 +1,31 @@
 package tui
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sorafujitani/wez-kv/internal/luacfg"
 	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/policy"
+	"github.com/sorafujitani/wez-kv/internal/source"
 )
 
 func testBindings() []parser.Keybinding {
 	return []parser.Keybinding{
-		{Table: "Default", Modifiers: "CTRL", Key: "c", Action: "CopyTo"},
-		{Table: "Default", Modifiers: "CTRL", Key: "v", Action: "Paste"},
-		{Table: "Default", Modifiers: "", Key: "Enter", Action: "ActivatePaneDirection"},
-		{Table: "Copy", Modifiers: "CTRL", Key: "c", Action: "CopyMode"},
-		{Table: "Copy", Modifiers: "", Key: "q", Action: "QuitCopy"},
-		{Table: "Search", Modifiers: "", Key: "/", Action: "SearchForward"},
+		{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("c"), Action: "CopyTo"},
+		{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("v"), Action: "Paste"},
+		{Table: "Default", Modifiers: 0, Key: parser.ParseKey("Enter"), Action: "ActivatePaneDirection"},
+		{Table: "Copy", Modifiers: parser.ModCtrl, Key: parser.ParseKey("c"), Action: "CopyMode"},
+		{Table: "Copy", Modifiers: 0, Key: parser.ParseKey("q"), Action: "QuitCopy"},
+		{Table: "Search", Modifiers: 0, Key: parser.ParseKey("/"), Action: "SearchForward"},
 	}
 }
 
@@ -22,7 +33,10 @@ func testResult() parser.ParseResult {
 	return parser.ParseResult{
 		Bindings: testBindings(),
 		Tables:   []string{"Default", "Copy", "Search"},
-		Leader:   &parser.Leader{Key: "a", Mods: "CTRL", Timeout: "1000ms"},
+		Leader: &parser.Leader{
+			Chord:   parser.Chord{Mods: parser.ModCtrl, Key: parser.ParseKey("a")},
+			Timeout: time.Second,
+		},
 	}
 }
 
@@ -310,3 +324,872 @@ func TestCursorResetOnFilter(t *testing.T) {
 		t.Errorf("expected cursor 0 after tab switch, got %d", m.cursor)
 	}
 }
+
+func mouseTestModel() Model {
+	result := parser.Parse(`Mouse
+-----
+
+	               Down { streak: 1, button: Left }     ->   SelectTextAtMouseCursor(Cell)
+	               Down { streak: 2, button: Left }     ->   SelectTextAtMouseCursor(Word)
+	               Up { streak: 1, button: Middle }     ->   PasteFrom(PrimarySelection)
+`)
+	result.Bindings = append(testBindings(), result.Bindings...)
+	result.Tables = append([]string{"Default", "Copy", "Search"}, result.Tables...)
+	m := New(result)
+	m.width = 120
+	m.height = 30
+	return m
+}
+
+func TestMouseView(t *testing.T) {
+	m := mouseTestModel()
+	if m.mouseView() {
+		t.Error("expected All view not to be a mouse view")
+	}
+
+	m.activeTable = 3
+	m.applyFilter()
+	if !m.mouseView() {
+		t.Fatal("expected Mouse table to be a mouse view")
+	}
+	if len(m.filtered) != 3 {
+		t.Errorf("expected 3 mouse bindings, got %d", len(m.filtered))
+	}
+	if h := m.renderColumnHeader(); !strings.Contains(h, "Button") || !strings.Contains(h, "Streak") {
+		t.Errorf("expected mouse columns in header, got %q", h)
+	}
+	if row := m.renderRow(2); !strings.Contains(row, "Middle") {
+		t.Errorf("expected button in row, got %q", row)
+	}
+}
+
+func TestMouseQueryTerms(t *testing.T) {
+	m := mouseTestModel()
+
+	m.query = "button:left"
+	m.applyFilter()
+	if len(m.filtered) != 2 {
+		t.Errorf("button:left: expected 2, got %d", len(m.filtered))
+	}
+
+	m.query = "streak:2"
+	m.applyFilter()
+	if len(m.filtered) != 1 {
+		t.Errorf("streak:2: expected 1, got %d", len(m.filtered))
+	}
+
+	m.query = "button:left Cell"
+	m.applyFilter()
+	if len(m.filtered) != 1 {
+		t.Errorf("button:left Cell: expected 1, got %d", len(m.filtered))
+	}
+}
+
+func TestDiagnosticsBadge(t *testing.T) {
+	m := newTestModel()
+	if strings.Contains(m.renderTitle(), "skipped") {
+		t.Error("expected no badge without diagnostics")
+	}
+
+	result := testResult()
+	result.Diagnostics = []parser.Diagnostic{
+		{Line: 3, Text: "???", Reason: "unrecognized line"},
+		{Line: 9, Text: "???", Reason: "unrecognized line"},
+	}
+	m = New(result)
+	m.width = 120
+	if title := m.renderTitle(); !strings.Contains(title, "2 skipped lines") {
+		t.Errorf("expected badge with count, got %q", title)
+	}
+}
+
+func TestRenderTitleLeader(t *testing.T) {
+	m := newTestModel()
+	title := m.renderTitle()
+	if !strings.Contains(title, "CTRL+a") {
+		t.Errorf("expected leader chord in title, got %q", title)
+	}
+	if !strings.Contains(title, "1s timeout") {
+		t.Errorf("expected leader timeout in title, got %q", title)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	cases := map[time.Duration]string{
+		500 * time.Millisecond:  "500ms",
+		time.Second:             "1s",
+		2001 * time.Millisecond: "2.001s",
+		1500 * time.Millisecond: "1.5s",
+	}
+	for d, want := range cases {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v): got %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestRenderTitleSource(t *testing.T) {
+	m := New(testResult(), WithSource("ssh devbox wezterm show-keys"))
+	m.width = 120
+	if title := m.renderTitle(); !strings.Contains(title, "ssh devbox wezterm show-keys") {
+		t.Errorf("expected invocation in title, got %q", title)
+	}
+}
+
+// fakeSource returns its results in order, one per Load call.
+type fakeSource struct {
+	results []parser.ParseResult
+	errs    []error
+	calls   *int
+}
+
+func (s fakeSource) Load(ctx context.Context) (parser.ParseResult, error) {
+	i := *s.calls
+	*s.calls++
+	return s.results[i], s.errs[i]
+}
+
+func (s fakeSource) String() string { return "fake" }
+
+func TestLoaderSuccess(t *testing.T) {
+	calls := 0
+	src := fakeSource{results: []parser.ParseResult{testResult()}, errs: []error{nil}, calls: &calls}
+	m := NewLoader(src, time.Second)
+	m.width, m.height = 120, 30
+
+	if !m.loading {
+		t.Fatal("expected loading state")
+	}
+	if v := m.View(); !strings.Contains(v, "Loading keymap from fake") {
+		t.Errorf("expected loading message, got %q", v)
+	}
+
+	msg := m.loadCmd(false)()
+	updated, _ := m.Update(msg)
+	m = updated.(Model)
+	if m.loading || m.loadErr != nil {
+		t.Fatalf("expected loaded state, got loading=%v err=%v", m.loading, m.loadErr)
+	}
+	if len(m.filtered) != len(testBindings()) {
+		t.Errorf("expected %d bindings, got %d", len(testBindings()), len(m.filtered))
+	}
+}
+
+func TestLoaderErrorAndRetry(t *testing.T) {
+	calls := 0
+	execErr := &source.ExecError{Command: "wezterm show-keys", Err: errors.New("exit status 1"), Stderr: "config error: oops\n"}
+	src := fakeSource{
+		results: []parser.ParseResult{{}, testResult()},
+		errs:    []error{execErr, nil},
+		calls:   &calls,
+	}
+	m := NewLoader(src, time.Second)
+	m.width, m.height = 120, 30
+
+	updated, _ := m.Update(m.loadCmd(false)())
+	m = updated.(Model)
+	if m.loadErr == nil {
+		t.Fatal("expected load error")
+	}
+	v := m.View()
+	if !strings.Contains(v, "config error: oops") {
+		t.Errorf("expected stderr in error view, got %q", v)
+	}
+
+	// Navigation keys are ignored in the error state.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = updated.(Model)
+	if m.loadErr == nil {
+		t.Fatal("expected error state to persist")
+	}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if !m.loading || cmd == nil {
+		t.Fatal("expected retry to start loading")
+	}
+
+	updated, _ = m.Update(m.loadCmd(false)())
+	m = updated.(Model)
+	if m.loadErr != nil || len(m.filtered) != len(testBindings()) {
+		t.Errorf("expected successful retry, got err=%v bindings=%d", m.loadErr, len(m.filtered))
+	}
+}
+
+type blockingSource struct{}
+
+func (blockingSource) Load(ctx context.Context) (parser.ParseResult, error) {
+	<-ctx.Done()
+	return parser.ParseResult{}, ctx.Err()
+}
+
+func (blockingSource) String() string { return "slow" }
+
+func TestLoaderTimeout(t *testing.T) {
+	m := NewLoader(blockingSource{}, 10*time.Millisecond)
+	msg := m.loadCmd(false)().(loadedMsg)
+	if !errors.Is(msg.err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", msg.err)
+	}
+	if !strings.Contains(msg.err.Error(), "timed out after") {
+		t.Errorf("expected timeout message, got %q", msg.err)
+	}
+}
+
+// streamingSource is a source.Streamer that pauses after two bindings
+// until release is closed.
+type streamingSource struct {
+	result  parser.ParseResult
+	release chan struct{}
+}
+
+func (s streamingSource) Load(ctx context.Context) (parser.ParseResult, error) {
+	return s.Stream(ctx, nil)
+}
+
+func (s streamingSource) Stream(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, error) {
+	for i, b := range s.result.Bindings {
+		if i == 2 {
+			<-s.release
+		}
+		if fn != nil {
+			if err := fn(b); err != nil {
+				return parser.ParseResult{}, err
+			}
+		}
+	}
+	return s.result, nil
+}
+
+func (streamingSource) String() string { return "stream" }
+
+func TestLoaderStreams(t *testing.T) {
+	src := streamingSource{result: testResult(), release: make(chan struct{})}
+	m := NewLoader(src, time.Second)
+	m.width, m.height = 120, 30
+
+	msg, ok := m.streamCmd()().(streamedMsg)
+	if !ok || len(msg.bindings) != 2 {
+		t.Fatalf("expected the first 2 bindings while loading, got %#v", msg)
+	}
+	updated, cmd := m.Update(msg)
+	m = updated.(Model)
+	if !m.loading || len(m.filtered) != 2 {
+		t.Fatalf("expected 2 rows while loading, got loading=%v rows=%d", m.loading, len(m.filtered))
+	}
+	if v := m.View(); strings.Contains(v, "Loading keymap") || !strings.Contains(v, "loading…") {
+		t.Errorf("expected the rows so far with a loading notice, got %q", v)
+	}
+
+	// The rows can be browsed while the rest is parsed.
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("j")})
+	m = updated.(Model)
+	if m.cursor != 1 {
+		t.Errorf("expected cursor 1, got %d", m.cursor)
+	}
+
+	close(src.release)
+	for m.loading {
+		updated, cmd = m.Update(cmd())
+		m = updated.(Model)
+	}
+	if m.loadErr != nil || len(m.bindings) != len(testBindings()) {
+		t.Fatalf("expected all %d bindings, got err=%v bindings=%d", len(testBindings()), m.loadErr, len(m.bindings))
+	}
+	if m.cursor != 1 {
+		t.Errorf("expected the cursor to be kept, got %d", m.cursor)
+	}
+}
+
+func TestReloadKeepsState(t *testing.T) {
+	updatedResult := testResult()
+	updatedResult.Bindings = append(updatedResult.Bindings[1:],
+		parser.Keybinding{Table: "Copy", Key: parser.ParseKey("y"), Action: "Yank"},
+		parser.Keybinding{Table: "Copy", Key: parser.ParseKey("v"), Action: "Select"},
+		parser.Keybinding{Table: "Copy", Key: parser.ParseKey("w"), Action: "Word"},
+	)
+	calls := 0
+	src := fakeSource{results: []parser.ParseResult{updatedResult}, errs: []error{nil}, calls: &calls}
+	m := New(testResult(), WithSource("fake"))
+	m.src = src
+	m.width, m.height = 120, 30
+
+	m.activeTable = 1 // Copy
+	m.applyFilter()
+	m.cursor = 1
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("R")})
+	m = updated.(Model)
+	if !m.reloading || cmd == nil {
+		t.Fatal("expected R to start a reload")
+	}
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+
+	if m.reloading {
+		t.Error("expected reload to finish")
+	}
+	if m.tables[m.activeTable] != "Copy" {
+		t.Errorf("expected Copy table to stay active, got %d", m.activeTable)
+	}
+	if m.cursor != 1 {
+		t.Errorf("expected cursor 1, got %d", m.cursor)
+	}
+	if len(m.filtered) != 5 {
+		t.Errorf("expected 5 Copy bindings, got %d", len(m.filtered))
+	}
+	if m.notice != "reloaded: +3 −1 bindings" {
+		t.Errorf("unexpected notice %q", m.notice)
+	}
+	if !strings.Contains(m.renderTitle(), "reloaded: +3 −1 bindings") {
+		t.Error("expected notice in title")
+	}
+
+	updated, _ = m.Update(clearNoticeMsg{seq: m.noticeSeq})
+	if updated.(Model).notice != "" {
+		t.Error("expected notice to clear")
+	}
+}
+
+func TestReloadFailureKeepsKeymap(t *testing.T) {
+	calls := 0
+	src := fakeSource{results: []parser.ParseResult{{}}, errs: []error{errors.New("boom")}, calls: &calls}
+	m := New(testResult())
+	m.src = src
+
+	m, cmd := m.startReload()
+	updated, _ := m.Update(cmd())
+	m = updated.(Model)
+	if len(m.bindings) != len(testBindings()) {
+		t.Errorf("expected keymap to be kept, got %d bindings", len(m.bindings))
+	}
+	if !m.noticeErr || !strings.Contains(m.notice, "boom") {
+		t.Errorf("expected error notice, got %q", m.notice)
+	}
+}
+
+func TestWithoutReload(t *testing.T) {
+	m := New(testResult(), WithoutReload())
+	m.src = fakeSource{}
+	if _, cmd := m.startReload(); cmd != nil {
+		t.Error("expected no reload")
+	}
+	if help := m.renderHelp(); strings.Contains(help, "reload") {
+		t.Errorf("expected no reload key in help, got %q", help)
+	}
+
+	m = New(testResult())
+	if help := m.renderHelp(); strings.Contains(help, "reload") {
+		t.Errorf("expected no reload key in help without a source, got %q", help)
+	}
+	m.src = fakeSource{}
+	if help := m.renderHelp(); !strings.Contains(help, "R") || !strings.Contains(help, "reload") {
+		t.Errorf("expected the reload key in help, got %q", help)
+	}
+}
+
+func TestDiffBindings(t *testing.T) {
+	old := testBindings()
+	new := append(slices.Clone(old[2:]), old[0], parser.Keybinding{Table: "Default", Key: parser.ParseKey("x"), Action: "Nop"})
+	added, removed := diffBindings(old, new)
+	if added != 1 || removed != 1 {
+		t.Errorf("expected +1 -1, got +%d -%d", added, removed)
+	}
+}
+
+// fakeCache is a source.Cacher with a fixed cached and fresh keymap.
+type fakeCache struct {
+	fakeSource
+	cached parser.ParseResult
+}
+
+func (c fakeCache) Lookup(ctx context.Context, fn func(parser.Keybinding) error) (parser.ParseResult, bool, error) {
+	return c.cached, true, nil
+}
+
+func (c fakeCache) Fresh(ctx context.Context) (parser.ParseResult, error) {
+	return c.Load(ctx)
+}
+
+func TestLoaderRevalidatesCache(t *testing.T) {
+	stale := testResult()
+	stale.Bindings = stale.Bindings[:2]
+	calls := 0
+	src := fakeCache{
+		fakeSource: fakeSource{results: []parser.ParseResult{testResult(), testResult()}, errs: []error{nil, nil}, calls: &calls},
+		cached:     stale,
+	}
+	m := NewLoader(src, time.Second)
+	m.width, m.height = 120, 30
+
+	msg := m.loadCmd(false)()
+	if !msg.(loadedMsg).cached || calls != 0 {
+		t.Fatal("expected the cached keymap without running the source")
+	}
+	updated, cmd := m.Update(msg)
+	m = updated.(Model)
+	if len(m.bindings) != 2 || !m.revalidating || cmd == nil {
+		t.Fatalf("expected cached keymap shown while revalidating, got %d bindings", len(m.bindings))
+	}
+	if !strings.Contains(m.renderTitle(), "revalidating") {
+		t.Error("expected revalidation in title")
+	}
+
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+	if m.revalidating || len(m.bindings) != len(testBindings()) {
+		t.Errorf("expected fresh keymap, got %d bindings", len(m.bindings))
+	}
+	if m.notice != "reloaded: +4 −0 bindings" {
+		t.Errorf("unexpected notice %q", m.notice)
+	}
+
+	// A current cache is revalidated silently.
+	m.notice = ""
+	m.revalidating = true
+	m, cmd = m.startReload()
+	updated, _ = m.Update(cmd())
+	if n := updated.(Model).notice; n != "" {
+		t.Errorf("expected no notice for unchanged keymap, got %q", n)
+	}
+}
+
+func TestRenderTitleBanner(t *testing.T) {
+	m := New(testResult(), WithSource("built-in defaults"), WithBanner("showing built-in defaults for wezterm 20240203"))
+	m.width = 120
+	if title := m.renderTitle(); !strings.Contains(title, "showing built-in defaults for wezterm 20240203") {
+		t.Errorf("expected banner in title, got %q", title)
+	}
+}
+
+func TestOriginClassification(t *testing.T) {
+	m := newTestModel()
+	defaultBindings := []parser.Keybinding{
+		{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("c"), Action: "CopyTo"},
+		{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("v"), Action: "PasteFrom"},
+		{Table: "Default", Modifiers: parser.ModSuper, Key: parser.ParseKey("m"), Action: "Hide"},
+	}
+	updated, _ := m.Update(defaultsLoadedMsg{result: parser.ParseResult{Bindings: defaultBindings}})
+	m = updated.(Model)
+
+	if len(m.origins) != len(testBindings())+1 {
+		t.Fatalf("expected %d origins, got %d", len(testBindings())+1, len(m.origins))
+	}
+	if len(m.filtered) != len(testBindings())+1 {
+		t.Errorf("expected removed default to be listed, got %d rows", len(m.filtered))
+	}
+	if !strings.Contains(m.renderColumnHeader(), "Origin") {
+		t.Error("expected Origin column")
+	}
+	if row := m.renderRow(1); !strings.Contains(row, "overridden") {
+		t.Errorf("expected CTRL+v to be overridden, got %q", row)
+	}
+
+	// o cycles the origin filter: default, overridden, added, removed.
+	press := func(k string) {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)})
+		m = updated.(Model)
+	}
+	counts := []int{1, 1, 4, 1, 7}
+	for _, want := range counts {
+		press("o")
+		if len(m.filtered) != want {
+			t.Errorf("origin filter %d: expected %d rows, got %d", m.originFilter, want, len(m.filtered))
+		}
+	}
+	if m.originFilter != -1 {
+		t.Errorf("expected filter to wrap to all, got %d", m.originFilter)
+	}
+
+	press("c")
+	if len(m.filtered) != 6 {
+		t.Errorf("expected 6 customized rows, got %d", len(m.filtered))
+	}
+	if !strings.Contains(m.renderTabBar(), "customized only") {
+		t.Error("expected customized toggle in tab bar")
+	}
+}
+
+func TestOriginKeysWithoutDefaults(t *testing.T) {
+	m := newTestModel()
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	m = updated.(Model)
+	if m.customizedOnly || strings.Contains(m.renderColumnHeader(), "Origin") {
+		t.Error("expected origin features to stay off until defaults load")
+	}
+}
+
+func TestLocation(t *testing.T) {
+	dir := t.TempDir()
+	m := New(testResult(), WithConfig(filepath.Join(dir, "wezterm.lua")))
+	m.width, m.height = 120, 30
+
+	// e does nothing useful until the config has been analyzed.
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("e")})
+	m = updated.(Model)
+	if !m.noticeErr {
+		t.Error("expected a notice when the location is unknown")
+	}
+
+	cfg := filepath.Join(dir, "wezterm.lua")
+	os.WriteFile(cfg, []byte("return { keys = {\n  { key = 'c', mods = 'CTRL', action = require('wezterm').action.Nop },\n} }\n"), 0o644)
+	analyzed, err := luacfg.Analyze(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, _ = m.Update(analyzedMsg{config: analyzed})
+	m = updated.(Model)
+
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "wezterm.lua:2") {
+		t.Errorf("expected the location of the selected row, got %q", bar)
+	}
+	if help := m.renderHelp(); !strings.Contains(help, "edit") {
+		t.Errorf("expected e in help, got %q", help)
+	}
+	m = sendKey(m, "j")
+	if bar := m.renderSearchBar(); strings.Contains(bar, "wezterm.lua") {
+		t.Errorf("expected no location for CTRL+v, got %q", bar)
+	}
+
+	// A failed analysis keeps the last known locations.
+	updated, _ = m.Update(analyzedMsg{err: errors.New("syntax error")})
+	if updated.(Model).locations == nil {
+		t.Error("expected locations to be kept")
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "wezterm.lua")
+	os.WriteFile(cfg, []byte(`local wezterm = require 'wezterm'
+local act = wezterm.action
+wezterm.on('open-picker', function(window, pane)
+  window:perform_action(act.ShowLauncher, pane)
+end)
+wezterm.on('greet', function(window, pane)
+  window:set_right_status('こんにちは世界、こんにちは世界、こんにちは世界、こんにちは世界、こんにちは世界、こんにちは世界')
+end)
+return { keys = {
+  { key = 'p', mods = 'CTRL', action = act.EmitEvent 'open-picker' },
+  { key = 'n', mods = 'CTRL', action = wezterm.action_callback(function(window, pane)
+    window:toast_notification('wezterm', 'hello')
+  end) },
+  { key = 'c', mods = 'CTRL', action = act.Multiple { act.CopyTo 'Clipboard', act.EmitEvent 'open-picker' } },
+  { key = 'g', mods = 'CTRL', action = act.EmitEvent 'greet' },
+} }
+`), 0o644)
+	analyzed, err := luacfg.Analyze(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(analyzed.Result, WithConfig(cfg))
+	m.width, m.height = 160, 30
+	updated, _ := m.Update(analyzedMsg{config: analyzed})
+	m = updated.(Model)
+
+	if row := m.renderRow(0); !strings.Contains(row, "⇒ window:perform_action(act.ShowLauncher, pane)") {
+		t.Errorf("expected a handler preview, got %q", row)
+	}
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "wezterm.lua:10") || !strings.Contains(bar, "handler: wezterm.lua:3") {
+		t.Errorf("expected the binding and handler locations, got %q", bar)
+	}
+	m = sendKey(m, "j")
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "handler: wezterm.lua:11") {
+		t.Errorf("expected the callback's location, got %q", bar)
+	}
+	m = sendKey(m, "j")
+	if row := m.renderRow(2); !strings.Contains(row, "⇒ window:perform_action") {
+		t.Errorf("expected a preview for an event nested in Multiple, got %q", row)
+	}
+
+	// Handler bodies are searchable.
+	m.query = "toast_notification"
+	m.applyFilter()
+	if len(m.filtered) != 1 || m.filtered[0].Key.String() != "n" {
+		t.Errorf("expected the callback binding to match, got %v", m.filtered)
+	}
+
+	// Wide characters take two cells, so the preview stops short of
+	// overflowing the row.
+	m.query = ""
+	m.applyFilter()
+	for _, width := range []int{100, 101, 120} {
+		m.width = width
+		if row := m.renderRow(3); !strings.Contains(row, "⇒ window:set_right") || !strings.Contains(row, "…") || lipgloss.Width(row) > width {
+			t.Errorf("width %d: expected the preview to fit, got %d cells: %q", width, lipgloss.Width(row), row)
+		}
+	}
+
+	// Without room, the preview is left out.
+	m.width = 80
+	if row := m.renderRow(0); strings.Contains(row, "⇒") {
+		t.Errorf("expected no preview in a narrow terminal, got %q", row)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	result := testResult()
+	result.Bindings = append(result.Bindings,
+		parser.Keybinding{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("c"), Action: "Nop"},
+		parser.Keybinding{Table: "Copy", Modifiers: 0, Key: parser.ParseKey("q"), Action: "QuitCopy"},
+	)
+	m := New(result)
+	m.width, m.height = 120, 30
+
+	if header := m.renderColumnHeader(); !strings.Contains(header, "!") {
+		t.Errorf("expected a conflict column, got %q", header)
+	}
+	if row := m.renderRow(0); !strings.Contains(row, "≠") {
+		t.Errorf("expected a conflict marker, got %q", row)
+	}
+	if row := m.renderRow(1); strings.Contains(row, "≠") {
+		t.Errorf("expected no marker for CTRL+v, got %q", row)
+	}
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "conflict: CTRL+c is bound to 2 different actions in Default") {
+		t.Errorf("expected the conflict in the status line, got %q", bar)
+	}
+
+	// n and N jump between conflicting rows, wrapping around.
+	m = sendKey(m, "n")
+	if m.cursor != 4 {
+		t.Errorf("expected the cursor on the duplicate in Copy, got %d", m.cursor)
+	}
+	m = sendKey(m, "n")
+	if m.cursor != 6 {
+		t.Errorf("expected the cursor on the second CTRL+c, got %d", m.cursor)
+	}
+	m = sendKey(m, "n")
+	m = sendKey(m, "n")
+	if m.cursor != 0 {
+		t.Errorf("expected the cursor to wrap around, got %d", m.cursor)
+	}
+	m = sendKey(m, "N")
+	if m.cursor != 7 {
+		t.Errorf("expected the cursor on the last duplicate, got %d", m.cursor)
+	}
+
+	m = sendKey(m, "x")
+	if len(m.filtered) != 4 || !strings.Contains(m.renderTabBar(), "conflicts only") {
+		t.Errorf("expected only the conflicting rows, got %v", m.filtered)
+	}
+	m = sendKey(m, "x")
+	if len(m.filtered) != 8 {
+		t.Errorf("expected all rows again, got %d", len(m.filtered))
+	}
+}
+
+func TestShadowed(t *testing.T) {
+	result := testResult()
+	result.Bindings = append(result.Bindings,
+		parser.Keybinding{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.LuaKey("phys:V"), Action: "PasteFrom(Clipboard)"},
+	)
+	m := New(result)
+	m.width, m.height = 200, 30
+
+	// CTRL+v is row 1; CTRL+phys:V, row 6, takes precedence over it.
+	if row := m.renderRow(1); !strings.Contains(row, "⊘") {
+		t.Errorf("expected CTRL+v to be marked as shadowed, got %q", row)
+	}
+	if row := m.renderRow(6); strings.Contains(row, "⊘") {
+		t.Errorf("expected the winner to be unmarked, got %q", row)
+	}
+	m = sendKey(m, "n")
+	if m.cursor != 1 {
+		t.Fatalf("expected n to jump to the shadowed binding, got %d", m.cursor)
+	}
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "never fires: CTRL+phys:V shadows CTRL+v in Default: physical keys are matched first") {
+		t.Errorf("expected the shadowing in the status line, got %q", bar)
+	}
+	m = sendKey(m, "x")
+	if len(m.filtered) != 2 {
+		t.Errorf("expected the shadowed binding and its winner, got %v", m.filtered)
+	}
+}
+
+func TestAmbiguous(t *testing.T) {
+	result := testResult()
+	result.Bindings = append(result.Bindings,
+		parser.Keybinding{Table: "Default", Modifiers: parser.ModCtrl, Key: parser.ParseKey("i"), Action: "ActivateTabRelative(1)"},
+		parser.Keybinding{Table: "Default", Modifiers: parser.ModCtrl | parser.ModShift, Key: parser.ParseKey("t"), Action: "SpawnTab"},
+	)
+	m := New(result)
+	m.width, m.height = 200, 30
+
+	if row := m.renderRow(6); !strings.Contains(row, "~") {
+		t.Errorf("expected CTRL+i to be marked, got %q", row)
+	}
+	if row := m.renderRow(0); strings.Contains(row, "~") {
+		t.Errorf("expected CTRL+c to be unmarked, got %q", row)
+	}
+	m.cursor = 6
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "CTRL+i is sent as Tab unless an enhanced keyboard protocol") {
+		t.Errorf("expected the requirement in the status line, got %q", bar)
+	}
+
+	m = sendKey(m, "p")
+	if len(m.filtered) != 2 || !strings.Contains(m.renderTabBar(), "enhanced keys only") {
+		t.Errorf("expected only the ambiguous chords, got %v", m.filtered)
+	}
+	if help := m.renderHelp(); !strings.Contains(help, "enhanced keys") {
+		t.Errorf("expected p in help, got %q", help)
+	}
+	m = sendKey(m, "p")
+	if len(m.filtered) != 8 {
+		t.Errorf("expected all rows again, got %d", len(m.filtered))
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p, err := policy.Parse([]byte(`{
+		"required": [{"mods": "CTRL", "key": "z"}, {"mods": "CTRL", "key": "c"}],
+		"rules": [{"name": "pane-leader", "table": "Default", "action": "*Pane*", "require_mods": "LEADER"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := testResult()
+	result.Bindings = append(result.Bindings,
+		parser.NewKeybinding("Default", parser.ModAlt, parser.ParseKey("l"), "ActivatePaneDirection(Right)"))
+	m := New(result, WithPolicy(p, "linux"))
+	m.width, m.height = 200, 30
+
+	if title := m.renderTitle(); !strings.Contains(title, "3 policy violations") {
+		t.Errorf("expected the violations to be counted, got %q", title)
+	}
+	for _, idx := range []int{2, 6} {
+		if row := m.renderRow(idx); !strings.Contains(row, "✗") {
+			t.Errorf("expected pane action %d to be marked, got %q", idx, row)
+		}
+	}
+	if row := m.renderRow(0); strings.Contains(row, "✗") {
+		t.Errorf("expected CTRL+c to be unmarked, got %q", row)
+	}
+	m.cursor = 6
+	if bar := m.renderSearchBar(); !strings.Contains(bar, "ALT+l is bound to ActivatePaneDirection(Right) without LEADER [pane-leader]") {
+		t.Errorf("expected the violation in the status line, got %q", bar)
+	}
+
+	m = New(testResult())
+	if title := m.renderTitle(); strings.Contains(title, "policy") {
+		t.Errorf("expected no policy badge without a policy, got %q", title)
+	}
+}
+
+func TestPolicyHighlight(t *testing.T) {
+	// Tests render without colors, so mark highlighted text instead.
+	defer func(s lipgloss.Style) { violationStyle = s }(violationStyle)
+	violationStyle = lipgloss.NewStyle().Transform(func(s string) string { return "<" + s + ">" })
+
+	p, err := policy.Parse([]byte(`{"rules": [{"name": "no-super", "forbid_mods": "SUPER"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := parser.Parse(`Default key table
+-----------------
+
+	SUPER                Char('t')          ->   SpawnTab(CurrentPaneDomain)
+	CTRL                 Char('t')          ->   SpawnTab(CurrentPaneDomain)
+
+Mouse
+-----
+
+	SUPER          Down { streak: 1, button: Left }     ->   SelectTextAtMouseCursor(Cell)
+	               Down { streak: 2, button: Left }     ->   SelectTextAtMouseCursor(Word)
+`)
+	m := New(result, WithPolicy(p, "linux"))
+	m.width, m.height = 200, 30
+	m.cursor = -1 // leave every row unselected
+
+	if row := m.renderRow(0); !strings.Contains(row, violationStyle.Render("t")) {
+		t.Errorf("expected the violating key to be highlighted, got %q", row)
+	}
+	if row := m.renderRow(1); strings.Contains(row, violationStyle.Render("t")) {
+		t.Errorf("expected CTRL+t not to be highlighted, got %q", row)
+	}
+
+	m.activeTable = 1
+	m.applyFilter()
+	m.cursor = -1
+	if !m.mouseView() {
+		t.Fatal("expected a mouse view")
+	}
+	if row := m.renderRow(0); !strings.Contains(row, violationStyle.Render("Left")) || !strings.Contains(row, violationStyle.Render("1")) {
+		t.Errorf("expected the violating mouse binding to be highlighted, got %q", row)
+	}
+	if row := m.renderRow(1); strings.Contains(row, violationStyle.Render("Left")) {
+		t.Errorf("expected the other mouse binding not to be highlighted, got %q", row)
+	}
+}
+
+func TestNoConflicts(t *testing.T) {
+	m := newTestModel()
+	if header := m.renderColumnHeader(); strings.Contains(header, "!") {
+		t.Errorf("expected no conflict column, got %q", header)
+	}
+	m = sendKey(m, "x")
+	m = sendKey(m, "n")
+	if m.conflictsOnly || m.cursor != 0 {
+		t.Error("expected x and n to do nothing without conflicts")
+	}
+	if help := m.renderHelp(); strings.Contains(help, "conflicts") {
+		t.Errorf("expected no conflict keys in help, got %q", help)
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("EDITOR", "code --wait")
+	cmd := editorCommand("/tmp/keys.lua", 12)
+	if got := strings.Join(cmd.Args, " "); got != "code --wait +12 /tmp/keys.lua" {
+		t.Errorf("unexpected editor command %q", got)
+	}
+	t.Setenv("EDITOR", "")
+	if cmd := editorCommand("/tmp/keys.lua", 1); cmd.Args[0] != "vi" {
+		t.Errorf("expected vi fallback, got %q", cmd.Args)
+	}
+}
+
+func TestEditReloads(t *testing.T) {
+	calls := 0
+	src := fakeSource{results: []parser.ParseResult{testResult()}, errs: []error{nil}, calls: &calls}
+	m := New(testResult(), WithConfig("wezterm.lua"))
+	m.src = src
+
+	updated, cmd := m.Update(editedMsg{})
+	m = updated.(Model)
+	if !m.reloading || cmd == nil {
+		t.Error("expected the keymap to reload after editing")
+	}
+
+	updated, _ = m.Update(editedMsg{err: errors.New("exit status 1")})
+	if m = updated.(Model); !m.noticeErr || !strings.Contains(m.notice, "editor failed") {
+		t.Errorf("expected an editor error notice, got %q", m.notice)
+	}
+}
+
+func TestWatchChangeDuringReload(t *testing.T) {
+	calls := 0
+	src := fakeSource{results: []parser.ParseResult{testResult(), testResult()}, errs: []error{nil, nil}, calls: &calls}
+	m := New(testResult(), WithWatch(func() []string { return nil }, time.Second))
+	m.src = src
+
+	m, reload := m.startReload()
+	updated, cmd := m.Update(watchTickMsg{changed: true})
+	m = updated.(Model)
+	if !m.pendingChange || cmd == nil {
+		t.Fatal("expected a change during a reload to stay pending and the watch to go on")
+	}
+	if calls != 0 {
+		t.Fatalf("expected no second reload while one is running, got %d loads", calls)
+	}
+
+	updated, _ = m.Update(reload())
+	m = updated.(Model)
+	if m.reloading {
+		t.Fatal("expected the first reload to finish")
+	}
+
+	updated, _ = m.Update(watchTickMsg{})
+	m = updated.(Model)
+	if !m.reloading || m.pendingChange {
+		t.Error("expected the pending change to be reloaded on the next tick")
+	}
+}
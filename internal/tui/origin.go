@@ -0,0 +1,127 @@
+package tui
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/source"
+)
+
+// originColWidth fits the longest origin, "overridden".
+const originColWidth = 10
+
+// defaultsLoadedMsg carries wezterm's default keymap.
+type defaultsLoadedMsg loadedMsg
+
+// WithDefaults loads wezterm's default keymap from src alongside the
+// user's, and classifies every binding against it.
+func WithDefaults(src source.Source) Option {
+	return func(m *Model) {
+		m.defaultsSrc = src
+	}
+}
+
+func (m Model) defaultsCmd() tea.Cmd {
+	if m.defaultsSrc == nil {
+		return nil
+	}
+	src, timeout := m.defaultsSrc, m.timeout
+	return func() tea.Msg {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		result, err := src.Load(ctx)
+		return defaultsLoadedMsg{result: result, err: err}
+	}
+}
+
+func (m Model) handleDefaultsLoaded(msg defaultsLoadedMsg) (Model, tea.Cmd) {
+	if msg.err != nil {
+		// The keymap is still useful without the Origin column.
+		return m.showNotice("defaults unavailable: "+msg.err.Error(), true)
+	}
+	m.defaultBindings = msg.result.Bindings
+	m.classify()
+	m.applyFilter()
+	return m, nil
+}
+
+// classify compares the bindings with the defaults, once both are loaded.
+func (m *Model) classify() {
+	m.origins, m.removed = nil, nil
+	if m.defaultBindings == nil || m.loading || m.loadErr != nil {
+		return
+	}
+	c := defaults.Classify(m.bindings, m.defaultBindings)
+	m.removed = c.Removed
+	m.origins = c.Origins
+	for range c.Removed {
+		m.origins = append(m.origins, defaults.OriginRemoved)
+	}
+	for _, b := range c.Removed {
+		if !slices.Contains(m.tables, b.Table) {
+			m.tables = append(m.tables, b.Table)
+		}
+	}
+}
+
+// rows returns the bindings followed by the removed defaults, which are
+// listed so that what the config takes away can be seen too.
+func (m Model) rows() []parser.Keybinding {
+	if len(m.removed) == 0 {
+		return m.bindings
+	}
+	return append(m.bindings[:len(m.bindings):len(m.bindings)], m.removed...)
+}
+
+// matchOrigin reports whether row i passes the origin filters.
+func (m Model) matchOrigin(i int) bool {
+	if m.origins == nil {
+		return true
+	}
+	o := m.origins[i]
+	if m.customizedOnly && !o.Customized() {
+		return false
+	}
+	return m.originFilter < 0 || o == defaults.Origin(m.originFilter)
+}
+
+// nextOriginFilter cycles through all, default, overridden, added and
+// removed.
+func (m *Model) nextOriginFilter() {
+	m.originFilter++
+	if m.originFilter > int(defaults.OriginRemoved) {
+		m.originFilter = -1
+	}
+}
+
+func (m Model) rowOrigin(idx int) (defaults.Origin, bool) {
+	if m.origins == nil {
+		return 0, false
+	}
+	return m.origins[m.filteredIdx[idx]], true
+}
+
+func renderOrigin(o defaults.Origin) string {
+	return originStyle(o).Render(o.String())
+}
+
+// renderOriginFilter describes the active origin filters for the tab bar.
+func (m Model) renderOriginFilter() string {
+	var parts []string
+	if m.originFilter >= 0 {
+		o := defaults.Origin(m.originFilter)
+		parts = append(parts, tabBarStyle.Render("origin: ")+originStyle(o).Render(o.String()))
+	}
+	if m.customizedOnly {
+		parts = append(parts, activeTabStyle.Render("customized only"))
+	}
+	return strings.Join(parts, "  ")
+}
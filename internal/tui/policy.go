@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/lint"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/policy"
+)
+
+// WithPolicy marks the bindings that violate p on the operating system
+// goos, and counts its violations in the title bar.
+func WithPolicy(p *policy.Policy, goos string) Option {
+	return func(m *Model) {
+		m.policy = p
+		m.policyOS = goos
+	}
+}
+
+// checkPolicy looks for violations of the policy in result, if there is
+// one.
+func (m *Model) checkPolicy(result parser.ParseResult) {
+	m.violations = nil
+	m.violationsOf = make(map[int][]int)
+	if m.policy == nil {
+		return
+	}
+	m.violations = m.policy.Check(result, m.policyOS)
+	for i, f := range m.violations {
+		for _, b := range f.Bindings {
+			m.violationsOf[b] = append(m.violationsOf[b], i)
+		}
+	}
+}
+
+// rowViolations returns the policy violations of the binding in filtered
+// row idx.
+func (m Model) rowViolations(idx int) []lint.Finding {
+	if idx < 0 || idx >= len(m.filtered) {
+		return nil
+	}
+	var found []lint.Finding
+	for _, i := range m.violationsOf[m.filteredIdx[idx]] {
+		found = append(found, m.violations[i])
+	}
+	return found
+}
+
+// renderViolations describes the policy violations of the selected row.
+func (m Model) renderViolations() string {
+	var parts []string
+	for _, f := range m.rowViolations(m.cursor) {
+		parts = append(parts, violationStyle.Render(fmt.Sprintf("%s [%s]", f.Message, f.Rule)))
+	}
+	return strings.Join(parts, "  ")
+}
+
+// renderPolicyBadge counts the policy violations for the title bar,
+// including required bindings that are missing and so have no row.
+func (m Model) renderPolicyBadge() string {
+	n := len(m.violations)
+	if n == 0 {
+		return ""
+	}
+	return violationStyle.Bold(true).Render(fmt.Sprintf("✗ %d policy %s", n, plural(n, "violation", "violations")))
+}
@@ -0,0 +1,51 @@
+package tui
+
+import (
+	"github.com/sorafujitani/wez-kv/internal/analysis"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// findAmbiguous looks for chords that need an enhanced keyboard
+// protocol to be told apart from another key press.
+func (m *Model) findAmbiguous() {
+	m.ambiguous = make(map[int]analysis.Ambiguity)
+	for i, b := range m.bindings {
+		if parser.IsMouseTable(b.Table) {
+			continue
+		}
+		if a, ok := analysis.Ambiguous(b.Chord()); ok {
+			m.ambiguous[i] = a
+		}
+	}
+	if len(m.ambiguous) == 0 {
+		m.ambiguousOnly = false
+	}
+}
+
+// rowAmbiguity returns why the binding in filtered row idx needs an
+// enhanced keyboard protocol, if it does.
+func (m Model) rowAmbiguity(idx int) (analysis.Ambiguity, bool) {
+	if idx < 0 || idx >= len(m.filtered) {
+		return analysis.Ambiguity{}, false
+	}
+	a, ok := m.ambiguous[m.filteredIdx[idx]]
+	return a, ok
+}
+
+// matchAmbiguous reports whether row i passes the enhanced keys filter.
+func (m Model) matchAmbiguous(i int) bool {
+	if !m.ambiguousOnly {
+		return true
+	}
+	_, ok := m.ambiguous[i]
+	return ok
+}
+
+// renderAmbiguity explains the requirement of the selected row.
+func (m Model) renderAmbiguity() string {
+	a, ok := m.rowAmbiguity(m.cursor)
+	if !ok {
+		return ""
+	}
+	return protocolStyle.Render(a.String())
+}
@@ -0,0 +1,57 @@
+package tui
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sorafujitani/wez-kv/internal/parser"
+)
+
+// queryTerms holds the structured terms of a search query. A query like
+// "button:left streak:2 select" keeps only double-click left button
+// bindings and fuzzy-matches the rest of the text.
+type queryTerms struct {
+	button string // lowercased button prefix
+	streak int    // 0 = any
+}
+
+// parseQuery splits a query into its fuzzy text and structured terms.
+// Terms with an invalid value are treated as plain text.
+func parseQuery(q string) (string, queryTerms) {
+	var terms queryTerms
+	var text []string
+	for _, f := range strings.Fields(q) {
+		name, value, ok := strings.Cut(f, ":")
+		switch {
+		case ok && name == "button" && value != "":
+			terms.button = strings.ToLower(value)
+		case ok && name == "streak":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				text = append(text, f)
+				continue
+			}
+			terms.streak = n
+		default:
+			text = append(text, f)
+		}
+	}
+	return strings.Join(text, " "), terms
+}
+
+// match reports whether b satisfies every structured term.
+func (t queryTerms) match(b parser.Keybinding) bool {
+	if t.button == "" && t.streak == 0 {
+		return true
+	}
+	if b.Mouse == nil {
+		return false
+	}
+	if t.button != "" && !strings.HasPrefix(strings.ToLower(b.Mouse.Button), t.button) {
+		return false
+	}
+	if t.streak != 0 && b.Mouse.Streak != t.streak {
+		return false
+	}
+	return true
+}
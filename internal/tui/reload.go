@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sorafujitani/wez-kv/internal/parser"
+	"github.com/sorafujitani/wez-kv/internal/watch"
+)
+
+// noticeDuration is how long a reload notice stays in the title bar.
+const noticeDuration = 3 * time.Second
+
+type (
+	// watchTickMsg reports whether the watched files changed since the
+	// previous tick.
+	watchTickMsg struct{ changed bool }
+	// reloadedMsg carries the outcome of reloading an already shown keymap.
+	reloadedMsg loadedMsg
+	// clearNoticeMsg hides the notice with the given sequence number.
+	clearNoticeMsg struct{ seq int }
+)
+
+// WithWatch reloads the keymap whenever one of the files listed by files
+// changes, checking every interval.
+func WithWatch(files func() []string, interval time.Duration) Option {
+	return func(m *Model) {
+		m.poller = watch.NewPoller(files)
+		m.watchInterval = interval
+	}
+}
+
+// WithoutReload disables reloading, for sources that can only be read
+// once such as stdin.
+func WithoutReload() Option {
+	return func(m *Model) {
+		m.noReload = true
+	}
+}
+
+func (m Model) canReload() bool {
+	return m.src != nil && !m.noReload
+}
+
+func (m Model) watchTick() tea.Cmd {
+	if m.poller == nil {
+		return nil
+	}
+	// Stat the files in the command rather than in Update. Only one tick
+	// is in flight at a time, so the poller is never used concurrently.
+	poller := m.poller
+	return tea.Tick(m.watchInterval, func(time.Time) tea.Msg {
+		return watchTickMsg{changed: poller.Poll()}
+	})
+}
+
+// handleWatchTick reloads the keymap if the watched files changed. A
+// change seen while a load or reload is running is kept pending until
+// it finishes, so that the keymap on screen does not miss it.
+func (m Model) handleWatchTick(msg watchTickMsg) (Model, tea.Cmd) {
+	m.pendingChange = m.pendingChange || msg.changed
+	if !m.pendingChange || m.loading || m.reloading || !m.canReload() {
+		return m, m.watchTick()
+	}
+	m.pendingChange = false
+	if m.loadErr != nil {
+		// The config may have been fixed; start over.
+		m, cmd := m.startLoad()
+		return m, tea.Batch(cmd, m.watchTick())
+	}
+	m, cmd := m.startReload()
+	return m, tea.Batch(cmd, m.watchTick())
+}
+
+// startReload loads the keymap again in the background while the
+// current one stays on screen. Nothing is reloaded while the keymap is
+// still loading.
+func (m Model) startReload() (Model, tea.Cmd) {
+	if !m.canReload() || m.reloading || m.loading {
+		return m, nil
+	}
+	m.reloading = true
+	load := m.loadCmd(true)
+	return m, func() tea.Msg {
+		return reloadedMsg(load().(loadedMsg))
+	}
+}
+
+func (m Model) handleReloaded(msg reloadedMsg) (Model, tea.Cmd) {
+	revalidating := m.revalidating
+	m.reloading = false
+	m.revalidating = false
+	if msg.err != nil {
+		return m.showNotice("reload failed: "+msg.err.Error(), true)
+	}
+
+	added, removed := diffBindings(m.bindings, msg.result.Bindings)
+	m.replaceResult(msg.result)
+	if revalidating && added+removed == 0 {
+		// The cache was current; nothing to report.
+		return m, nil
+	}
+	m, cmd := m.showNotice(fmt.Sprintf("reloaded: +%d −%d %s", added, removed, plural(added+removed, "binding", "bindings")), false)
+	return m, tea.Batch(cmd, m.analyzeCmd())
+}
+
+// replaceResult swaps in a reloaded keymap, keeping the active table,
+// query and cursor position.
+func (m *Model) replaceResult(result parser.ParseResult) {
+	var table string
+	if m.activeTable >= 0 && m.activeTable < len(m.tables) {
+		table = m.tables[m.activeTable]
+	}
+	cursor, offset := m.cursor, m.offset
+
+	m.activeTable = -1
+	if i := slices.Index(result.Tables, table); table != "" && i >= 0 {
+		m.activeTable = i
+	}
+	m.setResult(result)
+
+	m.cursor = min(cursor, max(0, len(m.filtered)-1))
+	m.offset = min(offset, m.cursor)
+	m.clampView()
+}
+
+func (m Model) showNotice(text string, isErr bool) (Model, tea.Cmd) {
+	m.noticeSeq++
+	m.notice = text
+	m.noticeErr = isErr
+	seq := m.noticeSeq
+	return m, tea.Tick(noticeDuration, func(time.Time) tea.Msg { return clearNoticeMsg{seq: seq} })
+}
+
+// diffBindings counts the bindings added and removed between two
+// versions of a keymap. Bindings are compared by table, chord and action.
+func diffBindings(old, new []parser.Keybinding) (added, removed int) {
+	counts := make(map[string]int)
+	for _, b := range old {
+		counts[bindingID(b)]++
+	}
+	for _, b := range new {
+		counts[bindingID(b)]--
+	}
+	for _, n := range counts {
+		if n > 0 {
+			removed += n
+		} else {
+			added -= n
+		}
+	}
+	return added, removed
+}
+
+func bindingID(b parser.Keybinding) string {
+	return b.Table + "\x00" + b.Chord().String() + "\x00" + b.Action
+}
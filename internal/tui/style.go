@@ -1,6 +1,11 @@
 package tui
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sorafujitani/wez-kv/internal/defaults"
+)
 
 var (
 	titleStyle = lipgloss.NewStyle().
@@ -10,6 +15,9 @@ var (
 	leaderStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("243"))
 
+	sourceStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("241"))
+
 	leaderValueStyle = lipgloss.NewStyle().
 				Bold(true).
 				Foreground(lipgloss.Color("213"))
@@ -54,12 +62,61 @@ var (
 	helpKeyStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("69"))
 
+	warningStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("214"))
+
+	spinnerStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("69"))
+
+	loadingStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("245"))
+
+	errorStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("203"))
+
+	bannerStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(lipgloss.Color("0")).
+			Background(lipgloss.Color("214"))
+
+	noticeStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("114"))
+
+	stderrStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("217"))
+
+	removedActionStyle = lipgloss.NewStyle().
+				Foreground(lipgloss.Color("243")).
+				Strikethrough(true)
+
+	locationStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("110"))
+
+	handlerStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("245"))
+
+	conflictStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("203"))
+
+	duplicateStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214"))
+
+	protocolStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("180"))
+
+	violationStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("199"))
+
 	fuzzyMatchStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("69")).
 			Bold(true)
 )
 
 func modifierStyle(mod string) lipgloss.Style {
+	// Side-specific modifiers share the color of their base modifier.
+	mod = strings.TrimPrefix(strings.TrimPrefix(mod, "LEFT_"), "RIGHT_")
 	switch mod {
 	case "CTRL":
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("6")) // Cyan
@@ -69,7 +126,22 @@ func modifierStyle(mod string) lipgloss.Style {
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("5")) // Magenta
 	case "SUPER":
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("2")) // Green
+	case "LEADER":
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("213")).Bold(true) // Pink
 	default:
 		return lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
 	}
 }
+
+func originStyle(o defaults.Origin) lipgloss.Style {
+	switch o {
+	case defaults.OriginOverridden:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("214")) // Orange
+	case defaults.OriginAdded:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("114")) // Green
+	case defaults.OriginRemoved:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("203")) // Red
+	default:
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	}
+}
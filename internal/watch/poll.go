@@ -0,0 +1,52 @@
+// Package watch detects changes to files by polling their modification
+// time and size, which works the same on every platform and on network
+// file systems where change notifications are unreliable.
+package watch
+
+import (
+	"maps"
+	"os"
+)
+
+type stamp struct {
+	modTime int64 // UnixNano
+	size    int64
+	exists  bool
+}
+
+// Poller reports whether a set of files changed since it last looked.
+type Poller struct {
+	files  func() []string
+	stamps map[string]stamp
+}
+
+// NewPoller returns a Poller for the files listed by files, which is
+// called on every poll so that the set can change over time. The
+// current state of the files is recorded as the baseline.
+func NewPoller(files func() []string) *Poller {
+	p := &Poller{files: files}
+	p.stamps = p.scan()
+	return p
+}
+
+// Poll reports whether any file was created, modified or removed, or
+// the set of files changed, since the previous call.
+func (p *Poller) Poll() bool {
+	stamps := p.scan()
+	changed := !maps.Equal(stamps, p.stamps)
+	p.stamps = stamps
+	return changed
+}
+
+func (p *Poller) scan() map[string]stamp {
+	stamps := make(map[string]stamp)
+	for _, path := range p.files() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			stamps[path] = stamp{}
+			continue
+		}
+		stamps[path] = stamp{modTime: fi.ModTime().UnixNano(), size: fi.Size(), exists: true}
+	}
+	return stamps
+}
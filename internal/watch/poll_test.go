@@ -0,0 +1,60 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPoller(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.lua")
+	b := filepath.Join(dir, "b.lua")
+	if err := os.WriteFile(a, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := []string{a}
+	p := NewPoller(func() []string { return files })
+	if p.Poll() {
+		t.Error("expected no change right after NewPoller")
+	}
+
+	if err := os.WriteFile(a, []byte("two!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Poll() {
+		t.Error("expected change after write")
+	}
+	if p.Poll() {
+		t.Error("expected change to be reported once")
+	}
+
+	// A file that does not exist yet is watched for creation.
+	files = []string{a, b}
+	if !p.Poll() {
+		t.Error("expected change when the file set grows")
+	}
+	if err := os.WriteFile(b, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Poll() {
+		t.Error("expected change after creation")
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(b, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Poll() {
+		t.Error("expected change after touch")
+	}
+
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Poll() {
+		t.Error("expected change after removal")
+	}
+}